@@ -2,11 +2,25 @@ package orka
 
 import (
 	"errors"
+
+	"github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/models"
 )
 
 // Artifact represents an Orka image as the result of a Packer build.
 type Artifact struct {
 	imageId string
+
+	// stateData holds details about the builder VM, keyed by state name.
+	stateData map[string]interface{}
+}
+
+// NewArtifact returns an artifact for an Orka image, so post-processors creating images can hand them
+// to other post-processors the way the builder does.
+func NewArtifact(imageId string, stateData map[string]interface{}) *Artifact {
+	if stateData == nil {
+		stateData = map[string]interface{}{}
+	}
+	return &Artifact{imageId: imageId, stateData: stateData}
 }
 
 // BuilderId returns the builder Id.
@@ -29,11 +43,27 @@ func (a *Artifact) Id() string {
 	return a.imageId
 }
 
+// State returns details about the builder VM the image was built on, such as
+// `vm_node_name`, `vm_host_ip`, `vm_ssh_port`, `vm_vnc_port` or `vm_screen_share_port`.
 func (a *Artifact) State(name string) interface{} {
-	return nil
+	return a.stateData[name]
 }
 
 // String returns the string representation of the artifact.
 func (a *Artifact) String() string {
 	return a.imageId
 }
+
+// vmInfoStateData returns the artifact state for the builder VM.
+func vmInfoStateData(info models.OrkaVMInfoModel) map[string]interface{} {
+	return map[string]interface{}{
+		"vm_ip":                info.IP,
+		"vm_host_ip":           info.HostIP,
+		"vm_node_name":         info.NodeName,
+		"vm_memory":            info.Memory,
+		"vm_ssh_port":          info.SSHPort,
+		"vm_vnc_port":          info.VNCPort,
+		"vm_screen_share_port": info.ScreenSharePort,
+		"vm_port_warnings":     info.PortWarnings,
+	}
+}
@@ -0,0 +1,211 @@
+package orka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// BuildSlotsAnnotationKey holds the orka_build_concurrency_key of a build slots ConfigMap.
+	BuildSlotsAnnotationKey = "orka.macstadium.com/packer-build-slots"
+
+	// buildSlotsStateKey is the ConfigMap key holding the build slots state.
+	buildSlotsStateKey = "slots.json"
+
+	// Builds that did not renew their slot or queue entry for buildSlotTTL are dropped,
+	// so builds that were killed do not hold slots forever.
+	buildSlotTTL           = 2 * time.Minute
+	buildSlotRenewInterval = 30 * time.Second
+
+	// Number of attempts to update the build slots when other builds update them at the same time.
+	buildSlotsUpdateAttempts = 10
+)
+
+// buildSlotsState is the state of a build slots ConfigMap.
+type buildSlotsState struct {
+	// Holders holds the last renewal of each build holding a slot, keyed by build ID.
+	Holders map[string]time.Time `json:"holders"`
+
+	// Queue holds the builds waiting for a slot, in order.
+	Queue []buildSlotsEntry `json:"queue"`
+}
+
+type buildSlotsEntry struct {
+	ID      string    `json:"id"`
+	Renewed time.Time `json:"renewed"`
+}
+
+// dropExpired removes the builds that did not renew their slot or queue entry in time.
+func (s *buildSlotsState) dropExpired(now time.Time) {
+	for id, renewed := range s.Holders {
+		if now.Sub(renewed) > buildSlotTTL {
+			delete(s.Holders, id)
+		}
+	}
+
+	queue := s.Queue[:0]
+	for _, entry := range s.Queue {
+		if now.Sub(entry.Renewed) <= buildSlotTTL {
+			queue = append(queue, entry)
+		}
+	}
+	s.Queue = queue
+}
+
+// remove removes the build from the holders and the queue.
+func (s *buildSlotsState) remove(id string) {
+	delete(s.Holders, id)
+
+	queue := s.Queue[:0]
+	for _, entry := range s.Queue {
+		if entry.ID != id {
+			queue = append(queue, entry)
+		}
+	}
+	s.Queue = queue
+}
+
+// buildSlots is a counting semaphore shared by the builds using the same ConfigMap. Concurrent updates
+// are detected with the resource version of the ConfigMap, waiting builds are served in order.
+type buildSlots struct {
+	orkaClient OrkaClient
+	namespace  string
+	name       string
+	key        string
+	id         string
+	limit      int
+}
+
+// tryAcquire takes a slot if one is free and the build is next in the queue, otherwise the build
+// is queued. It returns whether the build holds a slot, its position in the queue and the slots in use.
+func (b *buildSlots) tryAcquire(ctx context.Context) (acquired bool, position, inUse int, err error) {
+	err = b.update(ctx, func(state *buildSlotsState, now time.Time) {
+		if _, ok := state.Holders[b.id]; ok {
+			state.Holders[b.id] = now
+			acquired = true
+			return
+		}
+
+		position = -1
+		for i := range state.Queue {
+			if state.Queue[i].ID == b.id {
+				state.Queue[i].Renewed = now
+				position = i
+			}
+		}
+		if position < 0 {
+			state.Queue = append(state.Queue, buildSlotsEntry{ID: b.id, Renewed: now})
+			position = len(state.Queue) - 1
+		}
+
+		if position < b.limit-len(state.Holders) {
+			state.remove(b.id)
+			state.Holders[b.id] = now
+			acquired = true
+		}
+		inUse = len(state.Holders)
+	})
+	return acquired, position, inUse, err
+}
+
+// renew records that the build still holds its slot. A slot dropped because renewals failed for too
+// long is taken again only if one is free, otherwise a buildSlotLostError is returned.
+func (b *buildSlots) renew(ctx context.Context) error {
+	lost := false
+	err := b.update(ctx, func(state *buildSlotsState, now time.Time) {
+		lost = false
+		if _, ok := state.Holders[b.id]; !ok && len(state.Holders) >= b.limit {
+			lost = true
+			return
+		}
+		state.remove(b.id)
+		state.Holders[b.id] = now
+	})
+	if err == nil && lost {
+		return &buildSlotLostError{name: b.name, limit: b.limit}
+	}
+	return err
+}
+
+// release frees the slot of the build or removes it from the queue.
+func (b *buildSlots) release(ctx context.Context) error {
+	return b.update(ctx, func(state *buildSlotsState, now time.Time) {
+		state.remove(b.id)
+	})
+}
+
+// update applies fn to the state of the ConfigMap, creating it if needed, and retries on conflicts.
+func (b *buildSlots) update(ctx context.Context, fn func(state *buildSlotsState, now time.Time)) error {
+	var err error
+	for attempt := 0; attempt < buildSlotsUpdateAttempts; attempt++ {
+		err = b.tryUpdate(ctx, fn)
+		if !apierrors.IsConflict(err) && !apierrors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("build slots [%s] are updated too often: %w", b.name, err)
+}
+
+func (b *buildSlots) tryUpdate(ctx context.Context, fn func(state *buildSlotsState, now time.Time)) error {
+	configMap := &corev1.ConfigMap{}
+	err := b.orkaClient.Get(ctx, client.ObjectKey{Namespace: b.namespace, Name: b.name}, configMap)
+	notFound := apierrors.IsNotFound(err)
+	if err != nil && !notFound {
+		return fmt.Errorf("failed to get build slots [%s]: %w", b.name, err)
+	}
+
+	state := &buildSlotsState{}
+	if data := configMap.Data[buildSlotsStateKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), state); err != nil {
+			return fmt.Errorf("failed to read build slots [%s]: %w", b.name, err)
+		}
+	}
+	if state.Holders == nil {
+		state.Holders = map[string]time.Time{}
+	}
+
+	now := time.Now().UTC()
+	state.dropExpired(now)
+	fn(state, now)
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	if notFound {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:   b.namespace,
+				Name:        b.name,
+				Annotations: map[string]string{BuildSlotsAnnotationKey: b.key},
+			},
+			Data: map[string]string{buildSlotsStateKey: string(data)},
+		}
+		return b.orkaClient.Create(ctx, configMap)
+	}
+
+	patch := client.MergeFromWithOptions(configMap.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[buildSlotsStateKey] = string(data)
+	return b.orkaClient.Patch(ctx, configMap, patch)
+}
+
+// buildSlotLostError is returned when the slot of the build expired and other builds took all the slots.
+type buildSlotLostError struct {
+	name  string
+	limit int
+}
+
+func (e *buildSlotLostError) Error() string {
+	return fmt.Sprintf("build slot [%s] expired and all %d slots were taken by other builds", e.name, e.limit)
+}
@@ -0,0 +1,207 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestBuildSlotsStateDropExpired(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	fresh := now.Add(-buildSlotRenewInterval)
+	expired := now.Add(-buildSlotTTL - time.Second)
+
+	tests := []struct {
+		name        string
+		state       buildSlotsState
+		wantHolders []string
+		wantQueue   []string
+	}{
+		{
+			name:  "empty",
+			state: buildSlotsState{Holders: map[string]time.Time{}},
+		},
+		{
+			name: "renewed in time",
+			state: buildSlotsState{
+				Holders: map[string]time.Time{"a": fresh, "b": now.Add(-buildSlotTTL)},
+				Queue:   []buildSlotsEntry{{ID: "c", Renewed: fresh}},
+			},
+			wantHolders: []string{"a", "b"},
+			wantQueue:   []string{"c"},
+		},
+		{
+			name: "expired holders and queue entries",
+			state: buildSlotsState{
+				Holders: map[string]time.Time{"a": expired, "b": fresh},
+				Queue:   []buildSlotsEntry{{ID: "c", Renewed: expired}, {ID: "d", Renewed: fresh}, {ID: "e", Renewed: expired}},
+			},
+			wantHolders: []string{"b"},
+			wantQueue:   []string{"d"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.state.dropExpired(now)
+			if got := holderIDs(&tt.state); !reflect.DeepEqual(got, tt.wantHolders) {
+				t.Errorf("holders = %v, want %v", got, tt.wantHolders)
+			}
+			if got := queueIDs(&tt.state); !reflect.DeepEqual(got, tt.wantQueue) {
+				t.Errorf("queue = %v, want %v", got, tt.wantQueue)
+			}
+		})
+	}
+}
+
+func TestBuildSlotsStateRemove(t *testing.T) {
+	now := time.Now()
+	state := buildSlotsState{
+		Holders: map[string]time.Time{"a": now, "b": now},
+		Queue:   []buildSlotsEntry{{ID: "c", Renewed: now}, {ID: "d", Renewed: now}},
+	}
+
+	state.remove("a")
+	state.remove("c")
+
+	if got, want := holderIDs(&state), []string{"b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("holders = %v, want %v", got, want)
+	}
+	if got, want := queueIDs(&state), []string{"d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("queue = %v, want %v", got, want)
+	}
+}
+
+func TestBuildSlotsTryAcquire(t *testing.T) {
+	orkaClient := newObjectClient()
+	slots := func(id string) *buildSlots {
+		return &buildSlots{orkaClient: orkaClient, namespace: DefaultOrkaNamespace, name: buildSlotsName("default"), id: id, limit: 2}
+	}
+	ctx := context.Background()
+
+	steps := []struct {
+		id           string
+		release      bool
+		wantAcquired bool
+		wantPosition int
+		wantInUse    int
+	}{
+		{id: "a", wantAcquired: true, wantInUse: 1},
+		{id: "b", wantAcquired: true, wantInUse: 2},
+		{id: "c", wantPosition: 0, wantInUse: 2},
+		{id: "d", wantPosition: 1, wantInUse: 2},
+		// Queued builds keep their position.
+		{id: "c", wantPosition: 0, wantInUse: 2},
+		// Holders keep their slot.
+		{id: "a", wantAcquired: true},
+		{id: "a", release: true},
+		// Builds are served in order.
+		{id: "d", wantPosition: 1, wantInUse: 1},
+		{id: "c", wantAcquired: true, wantInUse: 2},
+		{id: "d", wantPosition: 0, wantInUse: 2},
+	}
+	for i, step := range steps {
+		if step.release {
+			if err := slots(step.id).release(ctx); err != nil {
+				t.Fatalf("step %d: release: %s", i, err)
+			}
+			continue
+		}
+
+		acquired, position, inUse, err := slots(step.id).tryAcquire(ctx)
+		if err != nil {
+			t.Fatalf("step %d: tryAcquire: %s", i, err)
+		}
+		if acquired != step.wantAcquired {
+			t.Fatalf("step %d: build %s acquired = %v, want %v", i, step.id, acquired, step.wantAcquired)
+		}
+		if !acquired && (position != step.wantPosition || inUse != step.wantInUse) {
+			t.Fatalf("step %d: build %s position, in use = %d, %d, want %d, %d", i, step.id, position, inUse, step.wantPosition, step.wantInUse)
+		}
+	}
+}
+
+func TestBuildSlotsRenew(t *testing.T) {
+	now := time.Now().UTC()
+	expired := now.Add(-buildSlotTTL - time.Second)
+
+	tests := []struct {
+		name     string
+		holders  map[string]time.Time
+		wantLost bool
+	}{
+		{"held", map[string]time.Time{"a": now, "b": now}, false},
+		{"expired with a free slot", map[string]time.Time{"a": expired, "b": now}, false},
+		{"expired and taken", map[string]time.Time{"a": expired, "b": now, "c": now}, true},
+		{"dropped and taken", map[string]time.Time{"b": now, "c": now}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orkaClient := newObjectClient()
+			ctx := context.Background()
+			setup := &buildSlots{orkaClient: orkaClient, namespace: DefaultOrkaNamespace, name: buildSlotsName("default"), limit: 2}
+			if err := setup.update(ctx, func(state *buildSlotsState, _ time.Time) {
+				state.Holders = tt.holders
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			slots := &buildSlots{orkaClient: orkaClient, namespace: DefaultOrkaNamespace, name: buildSlotsName("default"), id: "a", limit: 2}
+			err := slots.renew(ctx)
+			var lost *buildSlotLostError
+			if errors.As(err, &lost) != tt.wantLost {
+				t.Fatalf("renew error = %v, want lost %v", err, tt.wantLost)
+			}
+			if !tt.wantLost && err != nil {
+				t.Fatalf("renew: %s", err)
+			}
+
+			var state buildSlotsState
+			if err := setup.update(ctx, func(s *buildSlotsState, _ time.Time) { state = *s }); err != nil {
+				t.Fatal(err)
+			}
+			if _, held := state.Holders["a"]; held == tt.wantLost {
+				t.Errorf("build holds a slot = %v, want %v", held, !tt.wantLost)
+			}
+			if len(state.Holders) > slots.limit {
+				t.Errorf("%d slots are held, limit is %d", len(state.Holders), slots.limit)
+			}
+		})
+	}
+}
+
+func holderIDs(state *buildSlotsState) []string {
+	var ids []string
+	for id := range state.Holders {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func queueIDs(state *buildSlotsState) []string {
+	var ids []string
+	for _, entry := range state.Queue {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func TestBuildSlotsName(t *testing.T) {
+	names := map[string]string{}
+	for _, key := range []string{"default", "M2_Pro", "Mac Minis", "mac-minis", strings.Repeat("a", 300)} {
+		name := buildSlotsName(key)
+		if es := validation.IsDNS1123Subdomain(name); len(es) > 0 {
+			t.Errorf("buildSlotsName(%q) = %q is not a valid object name: %s", key, name, strings.Join(es, "; "))
+		}
+		if other, ok := names[name]; ok {
+			t.Errorf("buildSlotsName(%q) = buildSlotsName(%q) = %q", key, other, name)
+		}
+		names[name] = key
+	}
+}
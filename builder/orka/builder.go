@@ -3,14 +3,18 @@ package orka
 import (
 	"context"
 	"fmt"
+	"reflect"
+	"time"
 
 	"github.com/hashicorp/hcl/v2/hcldec"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/multistep/commonsteps"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/macstadium/packer-plugin-macstadium-orka/mocks"
+	"github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/models"
 )
 
 const BuilderId = "orka"
@@ -18,6 +22,16 @@ const BuilderId = "orka"
 const (
 	DescriptionAnnotationKey = "orka.macstadium.com/description"
 	DefaultOrkaNamespace     = "orka-default"
+
+	PackerBuilderLabelKey        = "orka.macstadium.com/packer-builder"
+	PackerBuildIDLabelKey        = "orka.macstadium.com/packer-build-id"
+	PackerExpiresAtAnnotationKey = "orka.macstadium.com/packer-expires-at"
+	PackerHeartbeatAnnotationKey = "orka.macstadium.com/packer-heartbeat"
+
+	// PackerHeartbeatTimeoutAnnotationKey holds the orka_vm_heartbeat_timeout of the build owning the VM.
+	PackerHeartbeatTimeoutAnnotationKey = "orka.macstadium.com/packer-heartbeat-timeout"
+	// PackerKeepAnnotationKey marks builder VMs kept by no_delete_vm, which are never reaped.
+	PackerKeepAnnotationKey = "orka.macstadium.com/packer-keep"
 )
 
 const (
@@ -26,8 +40,25 @@ const (
 	StateSshHost    = "ssh_host"
 	StateSshPort    = "ssh_port"
 	StateOrkaClient = "orka_client"
+	StateVmInfo     = "vm_info"
+
+	// StateSourceImage holds the name of the image the builder VM is deployed from, if it differs from source_image.
+	StateSourceImage = "source_image"
+
+	// StateImageDigest holds the manifest digest of the image pushed to an OCI registry.
+	StateImageDigest = "image_digest"
+
+	// StateFailBuild holds the context.CancelCauseFunc background tasks fail the build with.
+	StateFailBuild = "fail_build"
+
+	// StateBuildFailure holds the error a background task failed the build with. Such a build is
+	// cancelled, so cleanups check it to tell it apart from a build cancelled by the user.
+	StateBuildFailure = "build_failure"
 )
 
+// Time allowed to send the trace of a build.
+const traceExportTimeout = 30 * time.Second
+
 // Builder ...
 type Builder struct {
 	config Config
@@ -43,11 +74,54 @@ func (b *Builder) Prepare(raws ...interface{}) ([]string, []string, error) {
 	return nil, warnings, errs
 }
 func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (packer.Artifact, error) {
+	// Background tasks, such as the renewal of the build slot, cancel the build with the error it fails with.
+	ctx, fail := context.WithCancelCause(ctx)
+	defer fail(nil)
+
 	// Setup the state bag and initial state for the steps.
 	state := multistep.BasicStateBag{}
 	state.Put("hook", hook) // needed for the common provisioning step
 	state.Put(StateConfig, &b.config)
 	state.Put(StateUi, ui)
+	state.Put(StateFailBuild, fail)
+
+	// The event log records the phases of the build for the metrics even if it is not written.
+	buildEvents := newEventLog(b.config.OrkaVMBuilderBuildID)
+	if b.config.EventLog != "" {
+		var err error
+		if buildEvents, err = openEventLog(b.config.EventLog, b.config.OrkaVMBuilderBuildID); err != nil {
+			return nil, err
+		}
+		defer buildEvents.Close()
+	}
+	state.Put(StateEventLog, buildEvents)
+	emitEvent(&state, EventBuildStart, "", map[string]interface{}{
+		"vm_name":      b.config.OrkaVMBuilderName,
+		"vm_namespace": b.config.OrkaVMBuilderNamespace,
+		"source_image": b.config.SourceImage,
+		"image":        b.config.ImageName,
+		"mode":         b.config.ImageSaveMode,
+	})
+
+	var buildTracer *tracer
+	if b.config.TracingEndpoint != "" || b.config.TracingFile != "" {
+		var err error
+		buildTracer, err = newTracer(ctx, &b.config, "packer build",
+			attribute.String("packer.build_id", b.config.OrkaVMBuilderBuildID),
+			attribute.String("vm.name", b.config.OrkaVMBuilderName),
+			attribute.String("vm.namespace", b.config.OrkaVMBuilderNamespace),
+			attribute.String("image.name", b.config.ImageName),
+			attribute.String("image.save_mode", b.config.ImageSaveMode),
+		)
+		if err != nil {
+			return nil, err
+		}
+		state.Put(StateTracer, buildTracer)
+		defer b.exportTrace(ui, &state, buildTracer)
+	}
+	if b.config.MetricsPushgatewayURL != "" || b.config.MetricsTextfile != "" {
+		defer b.exportMetrics(ui, &state)
+	}
 
 	var commStep, provisionStep, syncDiskStep multistep.Step
 	var client OrkaClient
@@ -72,30 +146,169 @@ func (b *Builder) Run(ctx context.Context, ui packer.Ui, hook packer.Hook) (pack
 		provisionStep = &mocks.StepProvision{}
 		syncDiskStep = &mocks.StepProvision{}
 	}
+	if buildTracer != nil {
+		client = &tracingOrkaClient{OrkaClient: client, tracer: buildTracer}
+		commStep = &tracedStep{name: "communicator", step: commStep}
+		provisionStep = &tracedStep{name: "provision", step: provisionStep}
+		syncDiskStep = &tracedStep{name: "stepSyncDisk", step: syncDiskStep}
+	}
 	state.Put(StateOrkaClient, client)
 
-	steps := []multistep.Step{
-		&stepCreateVm{},
-		commStep,
-		provisionStep,
-		syncDiskStep,
-		&stepCreateImage{},
+	var steps []multistep.Step
+	switch b.config.OrkaVMReaper {
+	case ReaperModeOnly:
+		steps = []multistep.Step{
+			&stepReapVms{failOnError: true},
+		}
+	case ReaperModeAuto:
+		steps = append(steps, &stepReapVms{})
+		fallthrough
+	default:
+		steps = append(steps, &stepCheckImageName{})
+		if b.config.SourceImagePull {
+			steps = append(steps, &stepPullImage{})
+		}
+		if b.config.OrkaPrecacheImage {
+			steps = append(steps, &stepCacheImage{})
+		}
+		if b.config.OrkaBuildConcurrencyLimit > 0 {
+			steps = append(steps, &stepAcquireBuildSlot{})
+		}
+		steps = append(steps,
+			&stepCreateVm{},
+			commStep,
+			&stepEmitEvent{event: EventSSHConnected, since: EventVmRunning},
+			provisionStep,
+			syncDiskStep,
+			&stepCreateImage{},
+		)
+		if b.config.ImageSigningKey != "" {
+			steps = append(steps, &stepSignImage{})
+		}
+	}
+
+	if buildTracer != nil {
+		for i, step := range steps {
+			switch step.(type) {
+			case *tracedStep, *stepEmitEvent:
+				continue
+			}
+			steps[i] = &tracedStep{name: reflect.TypeOf(step).Elem().Name(), step: step}
+		}
 	}
 
 	// Run!
 	runner := commonsteps.NewRunner(steps, b.config.PackerConfig, ui)
 	runner.Run(ctx, &state)
 
+	// A build failed by a background task is cancelled, report why it failed instead.
+	if cause := context.Cause(ctx); cause != nil && cause != ctx.Err() {
+		ui.Error(cause.Error())
+		state.Put("error", cause)
+	}
+
 	// If there was an error, return that.
 	if rawErr, ok := state.GetOk("error"); ok {
+		emitEvent(&state, EventBuildEnd, EventBuildStart, map[string]interface{}{"outcome": "failed", "error": rawErr.(error).Error()})
 		return nil, rawErr.(error)
 	}
 
 	// If it was cancelled, then just return.
 	if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		emitEvent(&state, EventBuildEnd, EventBuildStart, map[string]interface{}{"outcome": "cancelled"})
+		return nil, nil
+	}
+
+	// Reaping only, there is no image to report.
+	if b.config.OrkaVMReaper == ReaperModeOnly {
 		return nil, nil
 	}
 
 	// No errors, must've worked.
-	return &Artifact{imageId: b.config.ImageName}, nil
+	artifact := &Artifact{
+		imageId:   b.config.ImageName,
+		stateData: map[string]interface{}{},
+	}
+	if info, ok := state.GetOk(StateVmInfo); ok {
+		artifact.stateData = vmInfoStateData(info.(models.OrkaVMInfoModel))
+	}
+	if digest, ok := state.GetOk(StateImageDigest); ok {
+		// Pin OCI images to the pushed digest, so the artifact keeps referring to them if the tag moves.
+		if pinned, err := pinnedImageReference(b.config.ImageName, digest.(string)); err == nil {
+			artifact.imageId = pinned
+		}
+		artifact.stateData["image_reference"] = b.config.ImageName
+		artifact.stateData["image_digest"] = digest
+	}
+	emitEvent(&state, EventBuildEnd, EventBuildStart, map[string]interface{}{"outcome": "succeeded", "image": artifact.imageId})
+	return artifact, nil
+}
+
+// failBuild cancels the build, which then fails with err. It is used by tasks running in the background
+// of the steps.
+func failBuild(state multistep.StateBag, err error) {
+	if fail, ok := state.GetOk(StateFailBuild); ok {
+		if _, failed := state.GetOk(StateBuildFailure); !failed {
+			state.Put(StateBuildFailure, err)
+		}
+		fail.(context.CancelCauseFunc)(err)
+	}
+}
+
+// buildFailed reports whether the build failed, rather than succeeded or was cancelled by the user.
+func buildFailed(state multistep.StateBag) bool {
+	_, halted := state.GetOk(multistep.StateHalted)
+	_, cancelled := state.GetOk(multistep.StateCancelled)
+	_, failed := state.GetOk(StateBuildFailure)
+	return halted && !cancelled || failed
+}
+
+// exportTrace ends the root span of the build with its outcome and exports the trace. Failing to
+// export the trace does not fail the build.
+func (b *Builder) exportTrace(ui packer.Ui, state multistep.StateBag, buildTracer *tracer) {
+	outcome := "succeeded"
+	var err error
+	if rawErr, ok := state.GetOk("error"); ok {
+		outcome = "failed"
+		err = rawErr.(error)
+	} else if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		outcome = "cancelled"
+	}
+	buildTracer.root.SetAttributes(
+		attribute.String("packer.outcome", outcome),
+		attribute.String("image.name", b.config.ImageName),
+	)
+	if info, ok := state.GetOk(StateVmInfo); ok {
+		buildTracer.root.SetAttributes(attribute.String("vm.node", info.(models.OrkaVMInfoModel).NodeName))
+	}
+	endSpan(buildTracer.root, err)
+
+	// The build context may be cancelled already.
+	ctx, cancel := context.WithTimeout(context.Background(), traceExportTimeout)
+	defer cancel()
+	if err := buildTracer.shutdown(ctx); err != nil {
+		ui.Error(fmt.Sprintf("failed to export the trace of the build: %s", err))
+	}
+}
+
+// exportMetrics writes the metrics of the build to the textfile and pushes them to the pushgateway.
+// Failing to export the metrics does not fail the build.
+func (b *Builder) exportMetrics(ui packer.Ui, state multistep.StateBag) {
+	if b.config.OrkaVMReaper == ReaperModeOnly {
+		return
+	}
+
+	// The build context may be cancelled already.
+	ctx, cancel := context.WithTimeout(context.Background(), metricsWriteTimeout)
+	defer cancel()
+	if b.config.MetricsTextfile != "" {
+		if err := writeMetricsTextfile(ctx, state, &b.config); err != nil {
+			ui.Error(fmt.Sprintf("failed to write the metrics of the build: %s", err))
+		}
+	}
+	if b.config.MetricsPushgatewayURL != "" {
+		if err := pushMetrics(ctx, state, &b.config); err != nil {
+			ui.Error(fmt.Sprintf("failed to push the metrics of the build: %s", err))
+		}
+	}
 }
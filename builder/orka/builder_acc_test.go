@@ -95,6 +95,11 @@ func TestSuccessfulOrkaBuilder(t *testing.T) {
 				return fmt.Errorf("does not contain the expected SSH server message: %q", expectedSshMessage)
 			}
 
+			const expectedVncMessage = "VNC console will be available at [vnc://1.2.3.4:5999]"
+			if !strings.Contains(logsString, expectedVncMessage) {
+				return fmt.Errorf("does not contain the expected VNC console message: %q", expectedVncMessage)
+			}
+
 			const expectedImageSavedMessage = "image [my-packer-image] saved successfully"
 			if !strings.Contains(logsString, expectedImageSavedMessage) {
 				return fmt.Errorf("does not contain the image saved message: %q", expectedImageSavedMessage)
@@ -0,0 +1,58 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestBuildFailed(t *testing.T) {
+	tests := []struct {
+		name      string
+		halted    bool
+		cancelled bool
+		failure   error
+		want      bool
+	}{
+		{name: "succeeded"},
+		{name: "halted", halted: true, want: true},
+		{name: "cancelled", halted: true, cancelled: true},
+		{name: "failed by a background task", halted: true, cancelled: true, failure: errors.New("lost"), want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := &multistep.BasicStateBag{}
+			if tt.halted {
+				state.Put(multistep.StateHalted, true)
+			}
+			if tt.cancelled {
+				state.Put(multistep.StateCancelled, true)
+			}
+			if tt.failure != nil {
+				state.Put(StateBuildFailure, tt.failure)
+			}
+			if got := buildFailed(state); got != tt.want {
+				t.Errorf("buildFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailBuild(t *testing.T) {
+	ctx, fail := context.WithCancelCause(context.Background())
+	state := &multistep.BasicStateBag{}
+	state.Put(StateFailBuild, fail)
+
+	first := errors.New("build slot lost")
+	failBuild(state, first)
+	failBuild(state, errors.New("image lock lost"))
+
+	if cause := context.Cause(ctx); cause != first {
+		t.Errorf("context.Cause() = %v, want %v", cause, first)
+	}
+	if failure, _ := state.GetOk(StateBuildFailure); failure != first {
+		t.Errorf("build failure = %v, want %v", failure, first)
+	}
+}
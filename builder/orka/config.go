@@ -1,18 +1,21 @@
-//go:generate packer-sdc mapstructure-to-hcl2 -type Config,MockOptions
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,MockOptions,RegistryCredentials
 
 package orka
 
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/docker/distribution/reference"
 	"github.com/hashicorp/packer-plugin-sdk/common"
 	"github.com/hashicorp/packer-plugin-sdk/communicator"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	"github.com/hashicorp/packer-plugin-sdk/template/config"
 	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
@@ -20,6 +23,12 @@ const (
 	defaultPassword = "admin"
 )
 
+const (
+	ReaperModeOff  = "off"
+	ReaperModeAuto = "auto"
+	ReaperModeOnly = "only"
+)
+
 type Config struct {
 	common.PackerConfig `mapstructure:",squash"`
 
@@ -35,15 +44,119 @@ type Config struct {
 	OrkaVMTag              string `mapstructure:"orka_vm_tag"`
 	OrkaVMTagRequired      bool   `mapstructure:"orka_vm_tag_required"`
 
+	// Identifies the build that owns the builder VM. Defaults to a random UUID.
+	OrkaVMBuilderBuildID string `mapstructure:"orka_vm_builder_build_id"`
+
+	// Minutes after which an abandoned builder VM is considered expired and may be reaped.
+	OrkaVMBuilderTTL int `mapstructure:"orka_vm_builder_ttl"`
+
+	// Minutes between heartbeats of a running build on its builder VM.
+	OrkaVMHeartbeatInterval int `mapstructure:"orka_vm_heartbeat_interval"`
+
+	// Minutes without a heartbeat after which a builder VM is considered abandoned.
+	OrkaVMHeartbeatTimeout int `mapstructure:"orka_vm_heartbeat_timeout"`
+
+	// Maximum number of builds with the same `orka_build_concurrency_key` running at a time. 0 means no limit.
+	OrkaBuildConcurrencyLimit int `mapstructure:"orka_build_concurrency_limit"`
+
+	// Groups the builds sharing the concurrency limit. Defaults to `orka_vm_tag`, or `default`.
+	OrkaBuildConcurrencyKey string `mapstructure:"orka_build_concurrency_key"`
+
+	// Minutes to wait for a build slot.
+	OrkaBuildConcurrencyTimeout int `mapstructure:"orka_build_concurrency_timeout"`
+
+	// File the phases of the build are appended to as JSON lines.
+	EventLog string `mapstructure:"event_log"`
+
+	// OTLP/HTTP endpoint the trace of the build is sent to, such as `http://localhost:4318`.
+	TracingEndpoint string `mapstructure:"tracing_endpoint"`
+
+	// Headers sent with the trace, such as an authorization header of the collector.
+	TracingHeaders map[string]string `mapstructure:"tracing_headers"`
+
+	// File the spans of the build are appended to as JSON lines.
+	TracingFile string `mapstructure:"tracing_file"`
+
+	// Prometheus pushgateway the metrics of the build are pushed to, such as `http://localhost:9091`.
+	MetricsPushgatewayURL string `mapstructure:"metrics_pushgateway_url"`
+
+	// File of the node exporter textfile collector the metrics of the build are added to.
+	MetricsTextfile string `mapstructure:"metrics_textfile"`
+
+	// Job of the pushgateway group the metrics are pushed to. Defaults to `packer_orka`.
+	MetricsJob string `mapstructure:"metrics_job"`
+
+	// Labels identifying the metrics of the builds, such as the template.
+	MetricsLabels map[string]string `mapstructure:"metrics_labels"`
+
+	// Reaping of expired builder VMs. One of `off`, `auto` (before each build) or `only` (reap and exit).
+	OrkaVMReaper string `mapstructure:"orka_vm_reaper"`
+
 	// Name of the VM Config to launch from
 	SourceImage string `mapstructure:"source_image" required:"true"`
 
+	// Pull `source_image` from an OCI registry into an Orka image before deploying the builder VM.
+	SourceImagePull bool `mapstructure:"source_image_pull"`
+
+	// Name of the Orka image `source_image` is pulled into. Defaults to a temporary image deleted after the build.
+	SourceImagePullName string `mapstructure:"source_image_pull_name"`
+
+	// Minutes to wait for `source_image` to be pulled.
+	SourceImagePullTimeout int `mapstructure:"source_image_pull_timeout"`
+
+	// Replace an existing image named `source_image_pull_name`.
+	SourceImagePullForce bool `mapstructure:"source_image_pull_force"`
+
+	// Cache the source image on the nodes the builder VM may be deployed on before deploying it.
+	OrkaPrecacheImage bool `mapstructure:"orka_precache_image"`
+
+	// Nodes to cache the source image on. Defaults to the nodes tagged with `orka_vm_tag`, or all nodes.
+	OrkaPrecacheNodes []string `mapstructure:"orka_precache_nodes"`
+
+	// Minutes to wait for the source image to be cached.
+	OrkaPrecacheTimeout int `mapstructure:"orka_precache_timeout"`
+
 	// The name of the resulting image. Defaults to `packer-{{timestamp}}`
 	// (see configuration templates for more info).
 	ImageName           string `mapstructure:"image_name" required:"false"`
 	ImageDescription    string `mapstructure:"image_description" required:"false"`
 	ImageForceOverwrite bool   `mapstructure:"image_force_overwrite" required:"false"`
 
+	// What to do when an image with the same name exists. One of `error` or `suffix`.
+	ImageNameConflict string `mapstructure:"image_name_conflict"`
+
+	// Locking of the image name against other builds writing it. One of `off`, `wait` or `fail`.
+	ImageLock string `mapstructure:"image_lock"`
+
+	// Minutes to wait for the image lock.
+	ImageLockTimeout int `mapstructure:"image_lock_timeout"`
+
+	// Namespace of the Leases locking images. Defaults to the namespace of the images.
+	ImageLockNamespace string `mapstructure:"image_lock_namespace"`
+
+	// Save over an existing image under a temporary name and replace the existing image only once
+	// the new one is ready, instead of deleting it before saving.
+	ImageSafeOverwrite bool `mapstructure:"image_safe_overwrite"`
+
+	// How the image is saved. One of `auto` (decided by `image_name`), `nfs`, `oci` or `commit`.
+	ImageSaveMode string `mapstructure:"image_save_mode"`
+
+	// Patterns of the source images that may be updated in place with the `commit` save mode.
+	ImageCommitAllowlist []string `mapstructure:"image_commit_allowlist"`
+
+	// Credentials the plugin uses for the registry the image is pushed to when `image_name` is an OCI
+	// image reference. They are not used by the push itself, the Orka VM push API takes no credentials.
+	ImageRegistryCredentials RegistryCredentials `mapstructure:"image_registry_credentials"`
+
+	// Path to a cosign private key the pushed image is signed with.
+	ImageSigningKey string `mapstructure:"image_signing_key"`
+
+	// Password of `image_signing_key`. Defaults to the COSIGN_PASSWORD environment variable.
+	ImageSigningKeyPassword string `mapstructure:"image_signing_key_password"`
+
+	// Attach a SLSA provenance attestation to the signed image.
+	ImageProvenance bool `mapstructure:"image_provenance"`
+
 	Mock MockOptions `mapstructure:"mock" required:"false"`
 
 	// Do not image after completion, for some manual testing, for internal dev/testing.
@@ -52,6 +165,12 @@ type Config struct {
 	// Do not delete after completion, for some manual testing, for internal dev/testing.
 	NoDeleteVM bool `mapstructure:"no_delete_vm"`
 
+	// Keep the builder VM when the build fails so it can be inspected, delete it otherwise.
+	KeepVMOnFailure bool `mapstructure:"keep_vm_on_failure"`
+
+	// Minutes after which a builder VM kept on failure expires.
+	KeepVMOnFailureTTL int `mapstructure:"keep_vm_on_failure_ttl"`
+
 	// Enable Orka Netboost, this should be kept on unless building for an old MacOS version
 	OrkaNetBoost *bool `mapstructure:"orka_enable_net_boost"`
 
@@ -69,6 +188,15 @@ type Config struct {
 
 	// Configuration for VM Push timeout
 	PackerPushTimeout int `mapstructure:"packer_push_timeout"`
+
+	// How to wait for VMs, images and pushes. One of `watch`, `poll` or `auto` (watch, falling back to polling).
+	OrkaWaitStrategy string `mapstructure:"orka_wait_strategy"`
+
+	// Seconds between two requests when polling.
+	OrkaWaitPollInterval int `mapstructure:"orka_wait_poll_interval"`
+
+	// Number of watcher failures after which the `auto` wait strategy falls back to polling.
+	OrkaWaitWatchFailures int `mapstructure:"orka_wait_watch_failures"`
 }
 
 type MockOptions struct {
@@ -108,6 +236,36 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		errs = packer.MultiErrorAppend(errs, errors.New("API endpoint not set or does not start with `http(s)://`"))
 	}
 
+	if c.TracingEndpoint != "" && !strings.HasPrefix(c.TracingEndpoint, "http://") && !strings.HasPrefix(c.TracingEndpoint, "https://") {
+		errs = packer.MultiErrorAppend(errs, errors.New("tracing_endpoint must start with `http(s)://`"))
+	}
+
+	if c.MetricsPushgatewayURL != "" && !strings.HasPrefix(c.MetricsPushgatewayURL, "http://") && !strings.HasPrefix(c.MetricsPushgatewayURL, "https://") {
+		errs = packer.MultiErrorAppend(errs, errors.New("metrics_pushgateway_url must start with `http(s)://`"))
+	}
+
+	if c.MetricsTextfile != "" && !strings.HasSuffix(c.MetricsTextfile, ".prom") {
+		errs = packer.MultiErrorAppend(errs, errors.New("metrics_textfile must end with `.prom` to be read by the textfile collector"))
+	}
+
+	if c.MetricsJob == "" {
+		c.MetricsJob = DefaultMetricsJob
+	}
+
+	for name, value := range c.MetricsLabels {
+		if !metricsLabelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("metrics_labels: invalid label name %q", name))
+		}
+		for _, reserved := range reservedMetricsLabels {
+			if name == reserved {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("metrics_labels: label %q is set by the builder", name))
+			}
+		}
+		if value == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("metrics_labels: label %q has no value", name))
+		}
+	}
+
 	if c.OrkaAuthToken == "" {
 		errs = packer.MultiErrorAppend(errs, errors.New("A valid authentication token must be specified"))
 	}
@@ -117,6 +275,29 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		errs = packer.MultiErrorAppend(errs, errors.New("No source image specified! Please specify source_image in the builder options. This should be an orka_vm_name from 'orka vm configs'"))
 	}
 
+	if c.SourceImagePull {
+		if _, err := reference.ParseNormalizedNamed(c.SourceImage); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("source_image must be an OCI image reference when source_image_pull is set: %w", err))
+		}
+		if c.SourceImagePullName != "" {
+			if es := validation.IsDNS1123Subdomain(c.SourceImagePullName); len(es) > 0 {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("source_image_pull_name is not a valid image name: %s", strings.Join(es, "; ")))
+			}
+		}
+	}
+
+	if c.SourceImagePullTimeout == 0 {
+		c.SourceImagePullTimeout = 60
+	}
+
+	if es := c.ImageRegistryCredentials.Validate("image_registry_credentials"); len(es) > 0 {
+		errs = packer.MultiErrorAppend(errs, es...)
+	}
+
+	if c.OrkaPrecacheTimeout == 0 {
+		c.OrkaPrecacheTimeout = 30
+	}
+
 	// If our builder VM prefix wasn't given, default to packer.
 	if c.OrkaVMBuilderName == "" {
 		var nameTemplate string
@@ -137,6 +318,86 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		c.OrkaVMBuilderNamespace = DefaultOrkaNamespace
 	}
 
+	if c.OrkaVMBuilderBuildID == "" {
+		id, err := interpolate.Render("{{uuid}}", nil)
+		if err != nil {
+			return nil, err
+		}
+		c.OrkaVMBuilderBuildID = id
+	} else if es := validation.IsValidLabelValue(c.OrkaVMBuilderBuildID); len(es) > 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("orka_vm_builder_build_id is not a valid label value: %s", strings.Join(es, "; ")))
+	}
+
+	if c.OrkaVMBuilderTTL == 0 {
+		c.OrkaVMBuilderTTL = 1440
+	}
+
+	if c.KeepVMOnFailureTTL == 0 {
+		c.KeepVMOnFailureTTL = 1440
+	}
+
+	if c.OrkaVMHeartbeatInterval == 0 {
+		c.OrkaVMHeartbeatInterval = 1
+	}
+
+	if c.OrkaVMHeartbeatTimeout == 0 {
+		c.OrkaVMHeartbeatTimeout = 10
+	}
+
+	for _, minutes := range []struct {
+		name  string
+		value int
+	}{
+		{"orka_vm_builder_ttl", c.OrkaVMBuilderTTL},
+		{"keep_vm_on_failure_ttl", c.KeepVMOnFailureTTL},
+		{"orka_vm_heartbeat_interval", c.OrkaVMHeartbeatInterval},
+		{"orka_vm_heartbeat_timeout", c.OrkaVMHeartbeatTimeout},
+		{"orka_precache_timeout", c.OrkaPrecacheTimeout},
+		{"source_image_pull_timeout", c.SourceImagePullTimeout},
+	} {
+		if minutes.value < 0 {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("%s must not be negative", minutes.name))
+		}
+	}
+
+	if c.OrkaVMHeartbeatTimeout <= c.OrkaVMHeartbeatInterval {
+		errs = packer.MultiErrorAppend(errs, errors.New("orka_vm_heartbeat_timeout must be greater than orka_vm_heartbeat_interval"))
+	}
+
+	if c.OrkaBuildConcurrencyLimit < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("orka_build_concurrency_limit must not be negative"))
+	}
+
+	if c.OrkaBuildConcurrencyKey == "" {
+		c.OrkaBuildConcurrencyKey = c.OrkaVMTag
+	}
+	if c.OrkaBuildConcurrencyKey == "" {
+		c.OrkaBuildConcurrencyKey = "default"
+	}
+
+	if c.OrkaBuildConcurrencyTimeout == 0 {
+		c.OrkaBuildConcurrencyTimeout = 120
+	} else if c.OrkaBuildConcurrencyTimeout < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("orka_build_concurrency_timeout must not be negative"))
+	}
+
+	switch c.OrkaVMReaper {
+	case "":
+		c.OrkaVMReaper = ReaperModeOff
+	case ReaperModeOff, ReaperModeAuto, ReaperModeOnly:
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("orka_vm_reaper must be one of %q, %q or %q", ReaperModeOff, ReaperModeAuto, ReaperModeOnly))
+	}
+
+	// Commits update the source image, so the image name can only be the source image.
+	if c.ImageSaveMode == ImageSaveModeCommit {
+		if c.ImageName == "" {
+			c.ImageName = c.SourceImage
+		} else if c.ImageName != c.SourceImage {
+			errs = packer.MultiErrorAppend(errs, errors.New("image_name must be empty or match source_image when image_save_mode is commit"))
+		}
+	}
+
 	// If our image name isn't set, we'll use a default name.
 	if c.ImageName == "" {
 		name, err := interpolate.Render("packer-{{timestamp}}", nil)
@@ -147,6 +408,86 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		c.ImageName = name
 	}
 
+	switch c.ImageSaveMode {
+	case "", ImageSaveModeAuto:
+		c.ImageSaveMode = imageSaveModeFor(c.ImageName)
+	case ImageSaveModeNFS, ImageSaveModeOCI, ImageSaveModeCommit:
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("image_save_mode must be one of %q, %q, %q or %q", ImageSaveModeAuto, ImageSaveModeNFS, ImageSaveModeOCI, ImageSaveModeCommit))
+	}
+
+	switch c.ImageSaveMode {
+	case ImageSaveModeNFS:
+		if err := validateNFSImageName(c.ImageName); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("image_name: %w", err))
+		}
+	case ImageSaveModeOCI:
+		if err := validateOCIImageName(c.ImageName); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("image_name: %w", err))
+		}
+	case ImageSaveModeCommit:
+		if c.SourceImagePull {
+			errs = packer.MultiErrorAppend(errs, errors.New("image_save_mode commit cannot be used with source_image_pull"))
+		}
+		if c.ImageForceOverwrite {
+			errs = packer.MultiErrorAppend(errs, errors.New("image_force_overwrite cannot be used when image_save_mode is commit"))
+		}
+		if err := checkImageCommitAllowed(c.SourceImage, c.ImageCommitAllowlist); err != nil {
+			errs = packer.MultiErrorAppend(errs, err)
+		}
+	}
+
+	switch c.ImageNameConflict {
+	case "":
+		c.ImageNameConflict = ImageNameConflictError
+	case ImageNameConflictError, ImageNameConflictSuffix:
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("image_name_conflict must be one of %q or %q", ImageNameConflictError, ImageNameConflictSuffix))
+	}
+
+	switch c.ImageLock {
+	case "":
+		c.ImageLock = ImageLockOff
+	case ImageLockOff, ImageLockWait, ImageLockFail:
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("image_lock must be one of %q, %q or %q", ImageLockOff, ImageLockWait, ImageLockFail))
+	}
+
+	if c.ImageLockTimeout == 0 {
+		c.ImageLockTimeout = 120
+	} else if c.ImageLockTimeout < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("image_lock_timeout must not be negative"))
+	}
+
+	if c.ImageLockNamespace == "" {
+		c.ImageLockNamespace = DefaultOrkaNamespace
+	} else if es := validation.IsDNS1123Label(c.ImageLockNamespace); len(es) > 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("image_lock_namespace is not valid: %s", strings.Join(es, "; ")))
+	}
+
+	if c.ImageSafeOverwrite {
+		if !c.ImageForceOverwrite {
+			errs = packer.MultiErrorAppend(errs, errors.New("image_safe_overwrite requires image_force_overwrite"))
+		}
+		if c.ImageSaveMode != ImageSaveModeNFS {
+			errs = packer.MultiErrorAppend(errs, errors.New("image_safe_overwrite can only be used when the image is saved to Orka"))
+		}
+	}
+
+	if c.ImageSigningKey != "" {
+		if c.ImageSigningKeyPassword == "" {
+			c.ImageSigningKeyPassword = os.Getenv("COSIGN_PASSWORD")
+		}
+		if c.ImageSaveMode != ImageSaveModeOCI {
+			errs = packer.MultiErrorAppend(errs, errors.New("image_signing_key can only be used when the image is pushed to an OCI registry"))
+		}
+		if _, err := loadSigningKey(c.ImageSigningKey, c.ImageSigningKeyPassword); err != nil {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("image_signing_key: %w", err))
+		}
+	} else if c.ImageProvenance {
+		errs = packer.MultiErrorAppend(errs, errors.New("image_provenance requires image_signing_key"))
+	}
+
 	// If we didn't specify the number of cores, set it to the default of 3.
 	if c.OrkaVMCPUCore == 0 {
 		c.OrkaVMCPUCore = 3
@@ -170,6 +511,26 @@ func (c *Config) Prepare(raws ...interface{}) ([]string, error) {
 		c.PackerPushTimeout = 60
 	}
 
+	switch c.OrkaWaitStrategy {
+	case "":
+		c.OrkaWaitStrategy = WaitStrategyWatch
+	case WaitStrategyWatch, WaitStrategyPoll, WaitStrategyAuto:
+	default:
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("orka_wait_strategy must be one of %q, %q or %q", WaitStrategyWatch, WaitStrategyPoll, WaitStrategyAuto))
+	}
+
+	if c.OrkaWaitPollInterval == 0 {
+		c.OrkaWaitPollInterval = 10
+	} else if c.OrkaWaitPollInterval < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("orka_wait_poll_interval must be positive"))
+	}
+
+	if c.OrkaWaitWatchFailures == 0 {
+		c.OrkaWaitWatchFailures = 3
+	} else if c.OrkaWaitWatchFailures < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("orka_wait_watch_failures must be positive"))
+	}
+
 	if es := c.CommConfig.Prepare(nil); len(es) > 0 {
 		errs = packer.MultiErrorAppend(errs, es...)
 	}
@@ -10,84 +10,123 @@ import (
 // FlatConfig is an auto-generated flat version of Config.
 // Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
 type FlatConfig struct {
-	PackerBuildName           *string           `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
-	PackerBuilderType         *string           `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
-	PackerCoreVersion         *string           `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
-	PackerDebug               *bool             `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
-	PackerForce               *bool             `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
-	PackerOnError             *string           `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
-	PackerUserVars            map[string]string `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
-	PackerSensitiveVars       []string          `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
-	Type                      *string           `mapstructure:"communicator" cty:"communicator" hcl:"communicator"`
-	PauseBeforeConnect        *string           `mapstructure:"pause_before_connecting" cty:"pause_before_connecting" hcl:"pause_before_connecting"`
-	SSHHost                   *string           `mapstructure:"ssh_host" cty:"ssh_host" hcl:"ssh_host"`
-	SSHPort                   *int              `mapstructure:"ssh_port" cty:"ssh_port" hcl:"ssh_port"`
-	SSHUsername               *string           `mapstructure:"ssh_username" cty:"ssh_username" hcl:"ssh_username"`
-	SSHPassword               *string           `mapstructure:"ssh_password" cty:"ssh_password" hcl:"ssh_password"`
-	SSHKeyPairName            *string           `mapstructure:"ssh_keypair_name" undocumented:"true" cty:"ssh_keypair_name" hcl:"ssh_keypair_name"`
-	SSHTemporaryKeyPairName   *string           `mapstructure:"temporary_key_pair_name" undocumented:"true" cty:"temporary_key_pair_name" hcl:"temporary_key_pair_name"`
-	SSHTemporaryKeyPairType   *string           `mapstructure:"temporary_key_pair_type" cty:"temporary_key_pair_type" hcl:"temporary_key_pair_type"`
-	SSHTemporaryKeyPairBits   *int              `mapstructure:"temporary_key_pair_bits" cty:"temporary_key_pair_bits" hcl:"temporary_key_pair_bits"`
-	SSHCiphers                []string          `mapstructure:"ssh_ciphers" cty:"ssh_ciphers" hcl:"ssh_ciphers"`
-	SSHClearAuthorizedKeys    *bool             `mapstructure:"ssh_clear_authorized_keys" cty:"ssh_clear_authorized_keys" hcl:"ssh_clear_authorized_keys"`
-	SSHKEXAlgos               []string          `mapstructure:"ssh_key_exchange_algorithms" cty:"ssh_key_exchange_algorithms" hcl:"ssh_key_exchange_algorithms"`
-	SSHPrivateKeyFile         *string           `mapstructure:"ssh_private_key_file" undocumented:"true" cty:"ssh_private_key_file" hcl:"ssh_private_key_file"`
-	SSHCertificateFile        *string           `mapstructure:"ssh_certificate_file" cty:"ssh_certificate_file" hcl:"ssh_certificate_file"`
-	SSHPty                    *bool             `mapstructure:"ssh_pty" cty:"ssh_pty" hcl:"ssh_pty"`
-	SSHTimeout                *string           `mapstructure:"ssh_timeout" cty:"ssh_timeout" hcl:"ssh_timeout"`
-	SSHWaitTimeout            *string           `mapstructure:"ssh_wait_timeout" undocumented:"true" cty:"ssh_wait_timeout" hcl:"ssh_wait_timeout"`
-	SSHAgentAuth              *bool             `mapstructure:"ssh_agent_auth" undocumented:"true" cty:"ssh_agent_auth" hcl:"ssh_agent_auth"`
-	SSHDisableAgentForwarding *bool             `mapstructure:"ssh_disable_agent_forwarding" cty:"ssh_disable_agent_forwarding" hcl:"ssh_disable_agent_forwarding"`
-	SSHHandshakeAttempts      *int              `mapstructure:"ssh_handshake_attempts" cty:"ssh_handshake_attempts" hcl:"ssh_handshake_attempts"`
-	SSHBastionHost            *string           `mapstructure:"ssh_bastion_host" cty:"ssh_bastion_host" hcl:"ssh_bastion_host"`
-	SSHBastionPort            *int              `mapstructure:"ssh_bastion_port" cty:"ssh_bastion_port" hcl:"ssh_bastion_port"`
-	SSHBastionAgentAuth       *bool             `mapstructure:"ssh_bastion_agent_auth" cty:"ssh_bastion_agent_auth" hcl:"ssh_bastion_agent_auth"`
-	SSHBastionUsername        *string           `mapstructure:"ssh_bastion_username" cty:"ssh_bastion_username" hcl:"ssh_bastion_username"`
-	SSHBastionPassword        *string           `mapstructure:"ssh_bastion_password" cty:"ssh_bastion_password" hcl:"ssh_bastion_password"`
-	SSHBastionInteractive     *bool             `mapstructure:"ssh_bastion_interactive" cty:"ssh_bastion_interactive" hcl:"ssh_bastion_interactive"`
-	SSHBastionPrivateKeyFile  *string           `mapstructure:"ssh_bastion_private_key_file" cty:"ssh_bastion_private_key_file" hcl:"ssh_bastion_private_key_file"`
-	SSHBastionCertificateFile *string           `mapstructure:"ssh_bastion_certificate_file" cty:"ssh_bastion_certificate_file" hcl:"ssh_bastion_certificate_file"`
-	SSHFileTransferMethod     *string           `mapstructure:"ssh_file_transfer_method" cty:"ssh_file_transfer_method" hcl:"ssh_file_transfer_method"`
-	SSHProxyHost              *string           `mapstructure:"ssh_proxy_host" cty:"ssh_proxy_host" hcl:"ssh_proxy_host"`
-	SSHProxyPort              *int              `mapstructure:"ssh_proxy_port" cty:"ssh_proxy_port" hcl:"ssh_proxy_port"`
-	SSHProxyUsername          *string           `mapstructure:"ssh_proxy_username" cty:"ssh_proxy_username" hcl:"ssh_proxy_username"`
-	SSHProxyPassword          *string           `mapstructure:"ssh_proxy_password" cty:"ssh_proxy_password" hcl:"ssh_proxy_password"`
-	SSHKeepAliveInterval      *string           `mapstructure:"ssh_keep_alive_interval" cty:"ssh_keep_alive_interval" hcl:"ssh_keep_alive_interval"`
-	SSHReadWriteTimeout       *string           `mapstructure:"ssh_read_write_timeout" cty:"ssh_read_write_timeout" hcl:"ssh_read_write_timeout"`
-	SSHRemoteTunnels          []string          `mapstructure:"ssh_remote_tunnels" cty:"ssh_remote_tunnels" hcl:"ssh_remote_tunnels"`
-	SSHLocalTunnels           []string          `mapstructure:"ssh_local_tunnels" cty:"ssh_local_tunnels" hcl:"ssh_local_tunnels"`
-	SSHPublicKey              []byte            `mapstructure:"ssh_public_key" undocumented:"true" cty:"ssh_public_key" hcl:"ssh_public_key"`
-	SSHPrivateKey             []byte            `mapstructure:"ssh_private_key" undocumented:"true" cty:"ssh_private_key" hcl:"ssh_private_key"`
-	WinRMUser                 *string           `mapstructure:"winrm_username" cty:"winrm_username" hcl:"winrm_username"`
-	WinRMPassword             *string           `mapstructure:"winrm_password" cty:"winrm_password" hcl:"winrm_password"`
-	WinRMHost                 *string           `mapstructure:"winrm_host" cty:"winrm_host" hcl:"winrm_host"`
-	WinRMNoProxy              *bool             `mapstructure:"winrm_no_proxy" cty:"winrm_no_proxy" hcl:"winrm_no_proxy"`
-	WinRMPort                 *int              `mapstructure:"winrm_port" cty:"winrm_port" hcl:"winrm_port"`
-	WinRMTimeout              *string           `mapstructure:"winrm_timeout" cty:"winrm_timeout" hcl:"winrm_timeout"`
-	WinRMUseSSL               *bool             `mapstructure:"winrm_use_ssl" cty:"winrm_use_ssl" hcl:"winrm_use_ssl"`
-	WinRMInsecure             *bool             `mapstructure:"winrm_insecure" cty:"winrm_insecure" hcl:"winrm_insecure"`
-	WinRMUseNTLM              *bool             `mapstructure:"winrm_use_ntlm" cty:"winrm_use_ntlm" hcl:"winrm_use_ntlm"`
-	OrkaEndpoint              *string           `mapstructure:"orka_endpoint" required:"true" cty:"orka_endpoint" hcl:"orka_endpoint"`
-	OrkaAuthToken             *string           `mapstructure:"orka_auth_token" required:"true" cty:"orka_auth_token" hcl:"orka_auth_token"`
-	OrkaVMBuilderPrefix       *string           `mapstructure:"orka_vm_builder_prefix" cty:"orka_vm_builder_prefix" hcl:"orka_vm_builder_prefix"`
-	OrkaVMBuilderNamespace    *string           `mapstructure:"orka_vm_builder_namespace" cty:"orka_vm_builder_namespace" hcl:"orka_vm_builder_namespace"`
-	OrkaVMBuilderName         *string           `mapstructure:"orka_vm_builder_name" cty:"orka_vm_builder_name" hcl:"orka_vm_builder_name"`
-	OrkaVMCPUCore             *int              `mapstructure:"orka_vm_cpu_core" cty:"orka_vm_cpu_core" hcl:"orka_vm_cpu_core"`
-	OrkaVMTag                 *string           `mapstructure:"orka_vm_tag" cty:"orka_vm_tag" hcl:"orka_vm_tag"`
-	OrkaVMTagRequired         *bool             `mapstructure:"orka_vm_tag_required" cty:"orka_vm_tag_required" hcl:"orka_vm_tag_required"`
-	SourceImage               *string           `mapstructure:"source_image" required:"true" cty:"source_image" hcl:"source_image"`
-	ImageName                 *string           `mapstructure:"image_name" required:"false" cty:"image_name" hcl:"image_name"`
-	ImageDescription          *string           `mapstructure:"image_description" required:"false" cty:"image_description" hcl:"image_description"`
-	ImageForceOverwrite       *bool             `mapstructure:"image_force_overwrite" required:"false" cty:"image_force_overwrite" hcl:"image_force_overwrite"`
-	Mock                      *FlatMockOptions  `mapstructure:"mock" required:"false" cty:"mock" hcl:"mock"`
-	NoCreateImage             *bool             `mapstructure:"no_create_image" cty:"no_create_image" hcl:"no_create_image"`
-	NoDeleteVM                *bool             `mapstructure:"no_delete_vm" cty:"no_delete_vm" hcl:"no_delete_vm"`
-	OrkaNetBoost              *bool             `mapstructure:"orka_enable_net_boost" cty:"orka_enable_net_boost" hcl:"orka_enable_net_boost"`
-	OrkaLegacyIO              *bool             `mapstructure:"orka_enable_legacy_io" cty:"orka_enable_legacy_io" hcl:"orka_enable_legacy_io"`
-	EnableOrkaNodeIPMapping   *bool             `mapstructure:"enable_orka_node_ip_mapping" cty:"enable_orka_node_ip_mapping" hcl:"enable_orka_node_ip_mapping"`
-	OrkaNodeIPMap             map[string]string `mapstructure:"orka_node_ip_map" cty:"orka_node_ip_map" hcl:"orka_node_ip_map"`
-	PackerVMWaitTimeout       *int              `mapstructure:"packer_vm_timeout" cty:"packer_vm_timeout" hcl:"packer_vm_timeout"`
-	PackerPushTimeout         *int              `mapstructure:"packer_push_timeout" cty:"packer_push_timeout" hcl:"packer_push_timeout"`
+	PackerBuildName             *string                  `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType           *string                  `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion           *string                  `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug                 *bool                    `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce                 *bool                    `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError               *string                  `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars              map[string]string        `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars         []string                 `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	Type                        *string                  `mapstructure:"communicator" cty:"communicator" hcl:"communicator"`
+	PauseBeforeConnect          *string                  `mapstructure:"pause_before_connecting" cty:"pause_before_connecting" hcl:"pause_before_connecting"`
+	SSHHost                     *string                  `mapstructure:"ssh_host" cty:"ssh_host" hcl:"ssh_host"`
+	SSHPort                     *int                     `mapstructure:"ssh_port" cty:"ssh_port" hcl:"ssh_port"`
+	SSHUsername                 *string                  `mapstructure:"ssh_username" cty:"ssh_username" hcl:"ssh_username"`
+	SSHPassword                 *string                  `mapstructure:"ssh_password" cty:"ssh_password" hcl:"ssh_password"`
+	SSHKeyPairName              *string                  `mapstructure:"ssh_keypair_name" undocumented:"true" cty:"ssh_keypair_name" hcl:"ssh_keypair_name"`
+	SSHTemporaryKeyPairName     *string                  `mapstructure:"temporary_key_pair_name" undocumented:"true" cty:"temporary_key_pair_name" hcl:"temporary_key_pair_name"`
+	SSHTemporaryKeyPairType     *string                  `mapstructure:"temporary_key_pair_type" cty:"temporary_key_pair_type" hcl:"temporary_key_pair_type"`
+	SSHTemporaryKeyPairBits     *int                     `mapstructure:"temporary_key_pair_bits" cty:"temporary_key_pair_bits" hcl:"temporary_key_pair_bits"`
+	SSHCiphers                  []string                 `mapstructure:"ssh_ciphers" cty:"ssh_ciphers" hcl:"ssh_ciphers"`
+	SSHClearAuthorizedKeys      *bool                    `mapstructure:"ssh_clear_authorized_keys" cty:"ssh_clear_authorized_keys" hcl:"ssh_clear_authorized_keys"`
+	SSHKEXAlgos                 []string                 `mapstructure:"ssh_key_exchange_algorithms" cty:"ssh_key_exchange_algorithms" hcl:"ssh_key_exchange_algorithms"`
+	SSHPrivateKeyFile           *string                  `mapstructure:"ssh_private_key_file" undocumented:"true" cty:"ssh_private_key_file" hcl:"ssh_private_key_file"`
+	SSHCertificateFile          *string                  `mapstructure:"ssh_certificate_file" cty:"ssh_certificate_file" hcl:"ssh_certificate_file"`
+	SSHPty                      *bool                    `mapstructure:"ssh_pty" cty:"ssh_pty" hcl:"ssh_pty"`
+	SSHTimeout                  *string                  `mapstructure:"ssh_timeout" cty:"ssh_timeout" hcl:"ssh_timeout"`
+	SSHWaitTimeout              *string                  `mapstructure:"ssh_wait_timeout" undocumented:"true" cty:"ssh_wait_timeout" hcl:"ssh_wait_timeout"`
+	SSHAgentAuth                *bool                    `mapstructure:"ssh_agent_auth" undocumented:"true" cty:"ssh_agent_auth" hcl:"ssh_agent_auth"`
+	SSHDisableAgentForwarding   *bool                    `mapstructure:"ssh_disable_agent_forwarding" cty:"ssh_disable_agent_forwarding" hcl:"ssh_disable_agent_forwarding"`
+	SSHHandshakeAttempts        *int                     `mapstructure:"ssh_handshake_attempts" cty:"ssh_handshake_attempts" hcl:"ssh_handshake_attempts"`
+	SSHBastionHost              *string                  `mapstructure:"ssh_bastion_host" cty:"ssh_bastion_host" hcl:"ssh_bastion_host"`
+	SSHBastionPort              *int                     `mapstructure:"ssh_bastion_port" cty:"ssh_bastion_port" hcl:"ssh_bastion_port"`
+	SSHBastionAgentAuth         *bool                    `mapstructure:"ssh_bastion_agent_auth" cty:"ssh_bastion_agent_auth" hcl:"ssh_bastion_agent_auth"`
+	SSHBastionUsername          *string                  `mapstructure:"ssh_bastion_username" cty:"ssh_bastion_username" hcl:"ssh_bastion_username"`
+	SSHBastionPassword          *string                  `mapstructure:"ssh_bastion_password" cty:"ssh_bastion_password" hcl:"ssh_bastion_password"`
+	SSHBastionInteractive       *bool                    `mapstructure:"ssh_bastion_interactive" cty:"ssh_bastion_interactive" hcl:"ssh_bastion_interactive"`
+	SSHBastionPrivateKeyFile    *string                  `mapstructure:"ssh_bastion_private_key_file" cty:"ssh_bastion_private_key_file" hcl:"ssh_bastion_private_key_file"`
+	SSHBastionCertificateFile   *string                  `mapstructure:"ssh_bastion_certificate_file" cty:"ssh_bastion_certificate_file" hcl:"ssh_bastion_certificate_file"`
+	SSHFileTransferMethod       *string                  `mapstructure:"ssh_file_transfer_method" cty:"ssh_file_transfer_method" hcl:"ssh_file_transfer_method"`
+	SSHProxyHost                *string                  `mapstructure:"ssh_proxy_host" cty:"ssh_proxy_host" hcl:"ssh_proxy_host"`
+	SSHProxyPort                *int                     `mapstructure:"ssh_proxy_port" cty:"ssh_proxy_port" hcl:"ssh_proxy_port"`
+	SSHProxyUsername            *string                  `mapstructure:"ssh_proxy_username" cty:"ssh_proxy_username" hcl:"ssh_proxy_username"`
+	SSHProxyPassword            *string                  `mapstructure:"ssh_proxy_password" cty:"ssh_proxy_password" hcl:"ssh_proxy_password"`
+	SSHKeepAliveInterval        *string                  `mapstructure:"ssh_keep_alive_interval" cty:"ssh_keep_alive_interval" hcl:"ssh_keep_alive_interval"`
+	SSHReadWriteTimeout         *string                  `mapstructure:"ssh_read_write_timeout" cty:"ssh_read_write_timeout" hcl:"ssh_read_write_timeout"`
+	SSHRemoteTunnels            []string                 `mapstructure:"ssh_remote_tunnels" cty:"ssh_remote_tunnels" hcl:"ssh_remote_tunnels"`
+	SSHLocalTunnels             []string                 `mapstructure:"ssh_local_tunnels" cty:"ssh_local_tunnels" hcl:"ssh_local_tunnels"`
+	SSHPublicKey                []byte                   `mapstructure:"ssh_public_key" undocumented:"true" cty:"ssh_public_key" hcl:"ssh_public_key"`
+	SSHPrivateKey               []byte                   `mapstructure:"ssh_private_key" undocumented:"true" cty:"ssh_private_key" hcl:"ssh_private_key"`
+	WinRMUser                   *string                  `mapstructure:"winrm_username" cty:"winrm_username" hcl:"winrm_username"`
+	WinRMPassword               *string                  `mapstructure:"winrm_password" cty:"winrm_password" hcl:"winrm_password"`
+	WinRMHost                   *string                  `mapstructure:"winrm_host" cty:"winrm_host" hcl:"winrm_host"`
+	WinRMNoProxy                *bool                    `mapstructure:"winrm_no_proxy" cty:"winrm_no_proxy" hcl:"winrm_no_proxy"`
+	WinRMPort                   *int                     `mapstructure:"winrm_port" cty:"winrm_port" hcl:"winrm_port"`
+	WinRMTimeout                *string                  `mapstructure:"winrm_timeout" cty:"winrm_timeout" hcl:"winrm_timeout"`
+	WinRMUseSSL                 *bool                    `mapstructure:"winrm_use_ssl" cty:"winrm_use_ssl" hcl:"winrm_use_ssl"`
+	WinRMInsecure               *bool                    `mapstructure:"winrm_insecure" cty:"winrm_insecure" hcl:"winrm_insecure"`
+	WinRMUseNTLM                *bool                    `mapstructure:"winrm_use_ntlm" cty:"winrm_use_ntlm" hcl:"winrm_use_ntlm"`
+	OrkaEndpoint                *string                  `mapstructure:"orka_endpoint" required:"true" cty:"orka_endpoint" hcl:"orka_endpoint"`
+	OrkaAuthToken               *string                  `mapstructure:"orka_auth_token" required:"true" cty:"orka_auth_token" hcl:"orka_auth_token"`
+	OrkaVMBuilderPrefix         *string                  `mapstructure:"orka_vm_builder_prefix" cty:"orka_vm_builder_prefix" hcl:"orka_vm_builder_prefix"`
+	OrkaVMBuilderNamespace      *string                  `mapstructure:"orka_vm_builder_namespace" cty:"orka_vm_builder_namespace" hcl:"orka_vm_builder_namespace"`
+	OrkaVMBuilderName           *string                  `mapstructure:"orka_vm_builder_name" cty:"orka_vm_builder_name" hcl:"orka_vm_builder_name"`
+	OrkaVMCPUCore               *int                     `mapstructure:"orka_vm_cpu_core" cty:"orka_vm_cpu_core" hcl:"orka_vm_cpu_core"`
+	OrkaVMTag                   *string                  `mapstructure:"orka_vm_tag" cty:"orka_vm_tag" hcl:"orka_vm_tag"`
+	OrkaVMTagRequired           *bool                    `mapstructure:"orka_vm_tag_required" cty:"orka_vm_tag_required" hcl:"orka_vm_tag_required"`
+	OrkaVMBuilderBuildID        *string                  `mapstructure:"orka_vm_builder_build_id" cty:"orka_vm_builder_build_id" hcl:"orka_vm_builder_build_id"`
+	OrkaVMBuilderTTL            *int                     `mapstructure:"orka_vm_builder_ttl" cty:"orka_vm_builder_ttl" hcl:"orka_vm_builder_ttl"`
+	OrkaVMHeartbeatInterval     *int                     `mapstructure:"orka_vm_heartbeat_interval" cty:"orka_vm_heartbeat_interval" hcl:"orka_vm_heartbeat_interval"`
+	OrkaVMHeartbeatTimeout      *int                     `mapstructure:"orka_vm_heartbeat_timeout" cty:"orka_vm_heartbeat_timeout" hcl:"orka_vm_heartbeat_timeout"`
+	OrkaBuildConcurrencyLimit   *int                     `mapstructure:"orka_build_concurrency_limit" cty:"orka_build_concurrency_limit" hcl:"orka_build_concurrency_limit"`
+	OrkaBuildConcurrencyKey     *string                  `mapstructure:"orka_build_concurrency_key" cty:"orka_build_concurrency_key" hcl:"orka_build_concurrency_key"`
+	OrkaBuildConcurrencyTimeout *int                     `mapstructure:"orka_build_concurrency_timeout" cty:"orka_build_concurrency_timeout" hcl:"orka_build_concurrency_timeout"`
+	EventLog                    *string                  `mapstructure:"event_log" cty:"event_log" hcl:"event_log"`
+	TracingEndpoint             *string                  `mapstructure:"tracing_endpoint" cty:"tracing_endpoint" hcl:"tracing_endpoint"`
+	TracingHeaders              map[string]string        `mapstructure:"tracing_headers" cty:"tracing_headers" hcl:"tracing_headers"`
+	TracingFile                 *string                  `mapstructure:"tracing_file" cty:"tracing_file" hcl:"tracing_file"`
+	MetricsPushgatewayURL       *string                  `mapstructure:"metrics_pushgateway_url" cty:"metrics_pushgateway_url" hcl:"metrics_pushgateway_url"`
+	MetricsTextfile             *string                  `mapstructure:"metrics_textfile" cty:"metrics_textfile" hcl:"metrics_textfile"`
+	MetricsJob                  *string                  `mapstructure:"metrics_job" cty:"metrics_job" hcl:"metrics_job"`
+	MetricsLabels               map[string]string        `mapstructure:"metrics_labels" cty:"metrics_labels" hcl:"metrics_labels"`
+	OrkaVMReaper                *string                  `mapstructure:"orka_vm_reaper" cty:"orka_vm_reaper" hcl:"orka_vm_reaper"`
+	SourceImage                 *string                  `mapstructure:"source_image" required:"true" cty:"source_image" hcl:"source_image"`
+	SourceImagePull             *bool                    `mapstructure:"source_image_pull" cty:"source_image_pull" hcl:"source_image_pull"`
+	SourceImagePullName         *string                  `mapstructure:"source_image_pull_name" cty:"source_image_pull_name" hcl:"source_image_pull_name"`
+	SourceImagePullTimeout      *int                     `mapstructure:"source_image_pull_timeout" cty:"source_image_pull_timeout" hcl:"source_image_pull_timeout"`
+	SourceImagePullForce        *bool                    `mapstructure:"source_image_pull_force" cty:"source_image_pull_force" hcl:"source_image_pull_force"`
+	OrkaPrecacheImage           *bool                    `mapstructure:"orka_precache_image" cty:"orka_precache_image" hcl:"orka_precache_image"`
+	OrkaPrecacheNodes           []string                 `mapstructure:"orka_precache_nodes" cty:"orka_precache_nodes" hcl:"orka_precache_nodes"`
+	OrkaPrecacheTimeout         *int                     `mapstructure:"orka_precache_timeout" cty:"orka_precache_timeout" hcl:"orka_precache_timeout"`
+	ImageName                   *string                  `mapstructure:"image_name" required:"false" cty:"image_name" hcl:"image_name"`
+	ImageDescription            *string                  `mapstructure:"image_description" required:"false" cty:"image_description" hcl:"image_description"`
+	ImageForceOverwrite         *bool                    `mapstructure:"image_force_overwrite" required:"false" cty:"image_force_overwrite" hcl:"image_force_overwrite"`
+	ImageNameConflict           *string                  `mapstructure:"image_name_conflict" cty:"image_name_conflict" hcl:"image_name_conflict"`
+	ImageLock                   *string                  `mapstructure:"image_lock" cty:"image_lock" hcl:"image_lock"`
+	ImageLockTimeout            *int                     `mapstructure:"image_lock_timeout" cty:"image_lock_timeout" hcl:"image_lock_timeout"`
+	ImageLockNamespace          *string                  `mapstructure:"image_lock_namespace" cty:"image_lock_namespace" hcl:"image_lock_namespace"`
+	ImageSafeOverwrite          *bool                    `mapstructure:"image_safe_overwrite" cty:"image_safe_overwrite" hcl:"image_safe_overwrite"`
+	ImageSaveMode               *string                  `mapstructure:"image_save_mode" cty:"image_save_mode" hcl:"image_save_mode"`
+	ImageCommitAllowlist        []string                 `mapstructure:"image_commit_allowlist" cty:"image_commit_allowlist" hcl:"image_commit_allowlist"`
+	ImageRegistryCredentials    *FlatRegistryCredentials `mapstructure:"image_registry_credentials" cty:"image_registry_credentials" hcl:"image_registry_credentials"`
+	ImageSigningKey             *string                  `mapstructure:"image_signing_key" cty:"image_signing_key" hcl:"image_signing_key"`
+	ImageSigningKeyPassword     *string                  `mapstructure:"image_signing_key_password" cty:"image_signing_key_password" hcl:"image_signing_key_password"`
+	ImageProvenance             *bool                    `mapstructure:"image_provenance" cty:"image_provenance" hcl:"image_provenance"`
+	Mock                        *FlatMockOptions         `mapstructure:"mock" required:"false" cty:"mock" hcl:"mock"`
+	NoCreateImage               *bool                    `mapstructure:"no_create_image" cty:"no_create_image" hcl:"no_create_image"`
+	NoDeleteVM                  *bool                    `mapstructure:"no_delete_vm" cty:"no_delete_vm" hcl:"no_delete_vm"`
+	KeepVMOnFailure             *bool                    `mapstructure:"keep_vm_on_failure" cty:"keep_vm_on_failure" hcl:"keep_vm_on_failure"`
+	KeepVMOnFailureTTL          *int                     `mapstructure:"keep_vm_on_failure_ttl" cty:"keep_vm_on_failure_ttl" hcl:"keep_vm_on_failure_ttl"`
+	OrkaNetBoost                *bool                    `mapstructure:"orka_enable_net_boost" cty:"orka_enable_net_boost" hcl:"orka_enable_net_boost"`
+	OrkaLegacyIO                *bool                    `mapstructure:"orka_enable_legacy_io" cty:"orka_enable_legacy_io" hcl:"orka_enable_legacy_io"`
+	EnableOrkaNodeIPMapping     *bool                    `mapstructure:"enable_orka_node_ip_mapping" cty:"enable_orka_node_ip_mapping" hcl:"enable_orka_node_ip_mapping"`
+	OrkaNodeIPMap               map[string]string        `mapstructure:"orka_node_ip_map" cty:"orka_node_ip_map" hcl:"orka_node_ip_map"`
+	PackerVMWaitTimeout         *int                     `mapstructure:"packer_vm_timeout" cty:"packer_vm_timeout" hcl:"packer_vm_timeout"`
+	PackerPushTimeout           *int                     `mapstructure:"packer_push_timeout" cty:"packer_push_timeout" hcl:"packer_push_timeout"`
+	OrkaWaitStrategy            *string                  `mapstructure:"orka_wait_strategy" cty:"orka_wait_strategy" hcl:"orka_wait_strategy"`
+	OrkaWaitPollInterval        *int                     `mapstructure:"orka_wait_poll_interval" cty:"orka_wait_poll_interval" hcl:"orka_wait_poll_interval"`
+	OrkaWaitWatchFailures       *int                     `mapstructure:"orka_wait_watch_failures" cty:"orka_wait_watch_failures" hcl:"orka_wait_watch_failures"`
 }
 
 // FlatMapstructure returns a new FlatConfig.
@@ -102,84 +141,123 @@ func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec }
 // The decoded values from this spec will then be applied to a FlatConfig.
 func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
 	s := map[string]hcldec.Spec{
-		"packer_build_name":            &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
-		"packer_builder_type":          &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
-		"packer_core_version":          &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
-		"packer_debug":                 &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
-		"packer_force":                 &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
-		"packer_on_error":              &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
-		"packer_user_variables":        &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
-		"packer_sensitive_variables":   &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
-		"communicator":                 &hcldec.AttrSpec{Name: "communicator", Type: cty.String, Required: false},
-		"pause_before_connecting":      &hcldec.AttrSpec{Name: "pause_before_connecting", Type: cty.String, Required: false},
-		"ssh_host":                     &hcldec.AttrSpec{Name: "ssh_host", Type: cty.String, Required: false},
-		"ssh_port":                     &hcldec.AttrSpec{Name: "ssh_port", Type: cty.Number, Required: false},
-		"ssh_username":                 &hcldec.AttrSpec{Name: "ssh_username", Type: cty.String, Required: false},
-		"ssh_password":                 &hcldec.AttrSpec{Name: "ssh_password", Type: cty.String, Required: false},
-		"ssh_keypair_name":             &hcldec.AttrSpec{Name: "ssh_keypair_name", Type: cty.String, Required: false},
-		"temporary_key_pair_name":      &hcldec.AttrSpec{Name: "temporary_key_pair_name", Type: cty.String, Required: false},
-		"temporary_key_pair_type":      &hcldec.AttrSpec{Name: "temporary_key_pair_type", Type: cty.String, Required: false},
-		"temporary_key_pair_bits":      &hcldec.AttrSpec{Name: "temporary_key_pair_bits", Type: cty.Number, Required: false},
-		"ssh_ciphers":                  &hcldec.AttrSpec{Name: "ssh_ciphers", Type: cty.List(cty.String), Required: false},
-		"ssh_clear_authorized_keys":    &hcldec.AttrSpec{Name: "ssh_clear_authorized_keys", Type: cty.Bool, Required: false},
-		"ssh_key_exchange_algorithms":  &hcldec.AttrSpec{Name: "ssh_key_exchange_algorithms", Type: cty.List(cty.String), Required: false},
-		"ssh_private_key_file":         &hcldec.AttrSpec{Name: "ssh_private_key_file", Type: cty.String, Required: false},
-		"ssh_certificate_file":         &hcldec.AttrSpec{Name: "ssh_certificate_file", Type: cty.String, Required: false},
-		"ssh_pty":                      &hcldec.AttrSpec{Name: "ssh_pty", Type: cty.Bool, Required: false},
-		"ssh_timeout":                  &hcldec.AttrSpec{Name: "ssh_timeout", Type: cty.String, Required: false},
-		"ssh_wait_timeout":             &hcldec.AttrSpec{Name: "ssh_wait_timeout", Type: cty.String, Required: false},
-		"ssh_agent_auth":               &hcldec.AttrSpec{Name: "ssh_agent_auth", Type: cty.Bool, Required: false},
-		"ssh_disable_agent_forwarding": &hcldec.AttrSpec{Name: "ssh_disable_agent_forwarding", Type: cty.Bool, Required: false},
-		"ssh_handshake_attempts":       &hcldec.AttrSpec{Name: "ssh_handshake_attempts", Type: cty.Number, Required: false},
-		"ssh_bastion_host":             &hcldec.AttrSpec{Name: "ssh_bastion_host", Type: cty.String, Required: false},
-		"ssh_bastion_port":             &hcldec.AttrSpec{Name: "ssh_bastion_port", Type: cty.Number, Required: false},
-		"ssh_bastion_agent_auth":       &hcldec.AttrSpec{Name: "ssh_bastion_agent_auth", Type: cty.Bool, Required: false},
-		"ssh_bastion_username":         &hcldec.AttrSpec{Name: "ssh_bastion_username", Type: cty.String, Required: false},
-		"ssh_bastion_password":         &hcldec.AttrSpec{Name: "ssh_bastion_password", Type: cty.String, Required: false},
-		"ssh_bastion_interactive":      &hcldec.AttrSpec{Name: "ssh_bastion_interactive", Type: cty.Bool, Required: false},
-		"ssh_bastion_private_key_file": &hcldec.AttrSpec{Name: "ssh_bastion_private_key_file", Type: cty.String, Required: false},
-		"ssh_bastion_certificate_file": &hcldec.AttrSpec{Name: "ssh_bastion_certificate_file", Type: cty.String, Required: false},
-		"ssh_file_transfer_method":     &hcldec.AttrSpec{Name: "ssh_file_transfer_method", Type: cty.String, Required: false},
-		"ssh_proxy_host":               &hcldec.AttrSpec{Name: "ssh_proxy_host", Type: cty.String, Required: false},
-		"ssh_proxy_port":               &hcldec.AttrSpec{Name: "ssh_proxy_port", Type: cty.Number, Required: false},
-		"ssh_proxy_username":           &hcldec.AttrSpec{Name: "ssh_proxy_username", Type: cty.String, Required: false},
-		"ssh_proxy_password":           &hcldec.AttrSpec{Name: "ssh_proxy_password", Type: cty.String, Required: false},
-		"ssh_keep_alive_interval":      &hcldec.AttrSpec{Name: "ssh_keep_alive_interval", Type: cty.String, Required: false},
-		"ssh_read_write_timeout":       &hcldec.AttrSpec{Name: "ssh_read_write_timeout", Type: cty.String, Required: false},
-		"ssh_remote_tunnels":           &hcldec.AttrSpec{Name: "ssh_remote_tunnels", Type: cty.List(cty.String), Required: false},
-		"ssh_local_tunnels":            &hcldec.AttrSpec{Name: "ssh_local_tunnels", Type: cty.List(cty.String), Required: false},
-		"ssh_public_key":               &hcldec.AttrSpec{Name: "ssh_public_key", Type: cty.List(cty.Number), Required: false},
-		"ssh_private_key":              &hcldec.AttrSpec{Name: "ssh_private_key", Type: cty.List(cty.Number), Required: false},
-		"winrm_username":               &hcldec.AttrSpec{Name: "winrm_username", Type: cty.String, Required: false},
-		"winrm_password":               &hcldec.AttrSpec{Name: "winrm_password", Type: cty.String, Required: false},
-		"winrm_host":                   &hcldec.AttrSpec{Name: "winrm_host", Type: cty.String, Required: false},
-		"winrm_no_proxy":               &hcldec.AttrSpec{Name: "winrm_no_proxy", Type: cty.Bool, Required: false},
-		"winrm_port":                   &hcldec.AttrSpec{Name: "winrm_port", Type: cty.Number, Required: false},
-		"winrm_timeout":                &hcldec.AttrSpec{Name: "winrm_timeout", Type: cty.String, Required: false},
-		"winrm_use_ssl":                &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
-		"winrm_insecure":               &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
-		"winrm_use_ntlm":               &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
-		"orka_endpoint":                &hcldec.AttrSpec{Name: "orka_endpoint", Type: cty.String, Required: false},
-		"orka_auth_token":              &hcldec.AttrSpec{Name: "orka_auth_token", Type: cty.String, Required: false},
-		"orka_vm_builder_prefix":       &hcldec.AttrSpec{Name: "orka_vm_builder_prefix", Type: cty.String, Required: false},
-		"orka_vm_builder_namespace":    &hcldec.AttrSpec{Name: "orka_vm_builder_namespace", Type: cty.String, Required: false},
-		"orka_vm_builder_name":         &hcldec.AttrSpec{Name: "orka_vm_builder_name", Type: cty.String, Required: false},
-		"orka_vm_cpu_core":             &hcldec.AttrSpec{Name: "orka_vm_cpu_core", Type: cty.Number, Required: false},
-		"orka_vm_tag":                  &hcldec.AttrSpec{Name: "orka_vm_tag", Type: cty.String, Required: false},
-		"orka_vm_tag_required":         &hcldec.AttrSpec{Name: "orka_vm_tag_required", Type: cty.Bool, Required: false},
-		"source_image":                 &hcldec.AttrSpec{Name: "source_image", Type: cty.String, Required: false},
-		"image_name":                   &hcldec.AttrSpec{Name: "image_name", Type: cty.String, Required: false},
-		"image_description":            &hcldec.AttrSpec{Name: "image_description", Type: cty.String, Required: false},
-		"image_force_overwrite":        &hcldec.AttrSpec{Name: "image_force_overwrite", Type: cty.Bool, Required: false},
-		"mock":                         &hcldec.BlockSpec{TypeName: "mock", Nested: hcldec.ObjectSpec((*FlatMockOptions)(nil).HCL2Spec())},
-		"no_create_image":              &hcldec.AttrSpec{Name: "no_create_image", Type: cty.Bool, Required: false},
-		"no_delete_vm":                 &hcldec.AttrSpec{Name: "no_delete_vm", Type: cty.Bool, Required: false},
-		"orka_enable_net_boost":        &hcldec.AttrSpec{Name: "orka_enable_net_boost", Type: cty.Bool, Required: false},
-		"orka_enable_legacy_io":        &hcldec.AttrSpec{Name: "orka_enable_legacy_io", Type: cty.Bool, Required: false},
-		"enable_orka_node_ip_mapping":  &hcldec.AttrSpec{Name: "enable_orka_node_ip_mapping", Type: cty.Bool, Required: false},
-		"orka_node_ip_map":             &hcldec.AttrSpec{Name: "orka_node_ip_map", Type: cty.Map(cty.String), Required: false},
-		"packer_vm_timeout":            &hcldec.AttrSpec{Name: "packer_vm_timeout", Type: cty.Number, Required: false},
-		"packer_push_timeout":          &hcldec.AttrSpec{Name: "packer_push_timeout", Type: cty.Number, Required: false},
+		"packer_build_name":              &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":            &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":            &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":                   &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":                   &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":                &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":          &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables":     &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"communicator":                   &hcldec.AttrSpec{Name: "communicator", Type: cty.String, Required: false},
+		"pause_before_connecting":        &hcldec.AttrSpec{Name: "pause_before_connecting", Type: cty.String, Required: false},
+		"ssh_host":                       &hcldec.AttrSpec{Name: "ssh_host", Type: cty.String, Required: false},
+		"ssh_port":                       &hcldec.AttrSpec{Name: "ssh_port", Type: cty.Number, Required: false},
+		"ssh_username":                   &hcldec.AttrSpec{Name: "ssh_username", Type: cty.String, Required: false},
+		"ssh_password":                   &hcldec.AttrSpec{Name: "ssh_password", Type: cty.String, Required: false},
+		"ssh_keypair_name":               &hcldec.AttrSpec{Name: "ssh_keypair_name", Type: cty.String, Required: false},
+		"temporary_key_pair_name":        &hcldec.AttrSpec{Name: "temporary_key_pair_name", Type: cty.String, Required: false},
+		"temporary_key_pair_type":        &hcldec.AttrSpec{Name: "temporary_key_pair_type", Type: cty.String, Required: false},
+		"temporary_key_pair_bits":        &hcldec.AttrSpec{Name: "temporary_key_pair_bits", Type: cty.Number, Required: false},
+		"ssh_ciphers":                    &hcldec.AttrSpec{Name: "ssh_ciphers", Type: cty.List(cty.String), Required: false},
+		"ssh_clear_authorized_keys":      &hcldec.AttrSpec{Name: "ssh_clear_authorized_keys", Type: cty.Bool, Required: false},
+		"ssh_key_exchange_algorithms":    &hcldec.AttrSpec{Name: "ssh_key_exchange_algorithms", Type: cty.List(cty.String), Required: false},
+		"ssh_private_key_file":           &hcldec.AttrSpec{Name: "ssh_private_key_file", Type: cty.String, Required: false},
+		"ssh_certificate_file":           &hcldec.AttrSpec{Name: "ssh_certificate_file", Type: cty.String, Required: false},
+		"ssh_pty":                        &hcldec.AttrSpec{Name: "ssh_pty", Type: cty.Bool, Required: false},
+		"ssh_timeout":                    &hcldec.AttrSpec{Name: "ssh_timeout", Type: cty.String, Required: false},
+		"ssh_wait_timeout":               &hcldec.AttrSpec{Name: "ssh_wait_timeout", Type: cty.String, Required: false},
+		"ssh_agent_auth":                 &hcldec.AttrSpec{Name: "ssh_agent_auth", Type: cty.Bool, Required: false},
+		"ssh_disable_agent_forwarding":   &hcldec.AttrSpec{Name: "ssh_disable_agent_forwarding", Type: cty.Bool, Required: false},
+		"ssh_handshake_attempts":         &hcldec.AttrSpec{Name: "ssh_handshake_attempts", Type: cty.Number, Required: false},
+		"ssh_bastion_host":               &hcldec.AttrSpec{Name: "ssh_bastion_host", Type: cty.String, Required: false},
+		"ssh_bastion_port":               &hcldec.AttrSpec{Name: "ssh_bastion_port", Type: cty.Number, Required: false},
+		"ssh_bastion_agent_auth":         &hcldec.AttrSpec{Name: "ssh_bastion_agent_auth", Type: cty.Bool, Required: false},
+		"ssh_bastion_username":           &hcldec.AttrSpec{Name: "ssh_bastion_username", Type: cty.String, Required: false},
+		"ssh_bastion_password":           &hcldec.AttrSpec{Name: "ssh_bastion_password", Type: cty.String, Required: false},
+		"ssh_bastion_interactive":        &hcldec.AttrSpec{Name: "ssh_bastion_interactive", Type: cty.Bool, Required: false},
+		"ssh_bastion_private_key_file":   &hcldec.AttrSpec{Name: "ssh_bastion_private_key_file", Type: cty.String, Required: false},
+		"ssh_bastion_certificate_file":   &hcldec.AttrSpec{Name: "ssh_bastion_certificate_file", Type: cty.String, Required: false},
+		"ssh_file_transfer_method":       &hcldec.AttrSpec{Name: "ssh_file_transfer_method", Type: cty.String, Required: false},
+		"ssh_proxy_host":                 &hcldec.AttrSpec{Name: "ssh_proxy_host", Type: cty.String, Required: false},
+		"ssh_proxy_port":                 &hcldec.AttrSpec{Name: "ssh_proxy_port", Type: cty.Number, Required: false},
+		"ssh_proxy_username":             &hcldec.AttrSpec{Name: "ssh_proxy_username", Type: cty.String, Required: false},
+		"ssh_proxy_password":             &hcldec.AttrSpec{Name: "ssh_proxy_password", Type: cty.String, Required: false},
+		"ssh_keep_alive_interval":        &hcldec.AttrSpec{Name: "ssh_keep_alive_interval", Type: cty.String, Required: false},
+		"ssh_read_write_timeout":         &hcldec.AttrSpec{Name: "ssh_read_write_timeout", Type: cty.String, Required: false},
+		"ssh_remote_tunnels":             &hcldec.AttrSpec{Name: "ssh_remote_tunnels", Type: cty.List(cty.String), Required: false},
+		"ssh_local_tunnels":              &hcldec.AttrSpec{Name: "ssh_local_tunnels", Type: cty.List(cty.String), Required: false},
+		"ssh_public_key":                 &hcldec.AttrSpec{Name: "ssh_public_key", Type: cty.List(cty.Number), Required: false},
+		"ssh_private_key":                &hcldec.AttrSpec{Name: "ssh_private_key", Type: cty.List(cty.Number), Required: false},
+		"winrm_username":                 &hcldec.AttrSpec{Name: "winrm_username", Type: cty.String, Required: false},
+		"winrm_password":                 &hcldec.AttrSpec{Name: "winrm_password", Type: cty.String, Required: false},
+		"winrm_host":                     &hcldec.AttrSpec{Name: "winrm_host", Type: cty.String, Required: false},
+		"winrm_no_proxy":                 &hcldec.AttrSpec{Name: "winrm_no_proxy", Type: cty.Bool, Required: false},
+		"winrm_port":                     &hcldec.AttrSpec{Name: "winrm_port", Type: cty.Number, Required: false},
+		"winrm_timeout":                  &hcldec.AttrSpec{Name: "winrm_timeout", Type: cty.String, Required: false},
+		"winrm_use_ssl":                  &hcldec.AttrSpec{Name: "winrm_use_ssl", Type: cty.Bool, Required: false},
+		"winrm_insecure":                 &hcldec.AttrSpec{Name: "winrm_insecure", Type: cty.Bool, Required: false},
+		"winrm_use_ntlm":                 &hcldec.AttrSpec{Name: "winrm_use_ntlm", Type: cty.Bool, Required: false},
+		"orka_endpoint":                  &hcldec.AttrSpec{Name: "orka_endpoint", Type: cty.String, Required: false},
+		"orka_auth_token":                &hcldec.AttrSpec{Name: "orka_auth_token", Type: cty.String, Required: false},
+		"orka_vm_builder_prefix":         &hcldec.AttrSpec{Name: "orka_vm_builder_prefix", Type: cty.String, Required: false},
+		"orka_vm_builder_namespace":      &hcldec.AttrSpec{Name: "orka_vm_builder_namespace", Type: cty.String, Required: false},
+		"orka_vm_builder_name":           &hcldec.AttrSpec{Name: "orka_vm_builder_name", Type: cty.String, Required: false},
+		"orka_vm_cpu_core":               &hcldec.AttrSpec{Name: "orka_vm_cpu_core", Type: cty.Number, Required: false},
+		"orka_vm_tag":                    &hcldec.AttrSpec{Name: "orka_vm_tag", Type: cty.String, Required: false},
+		"orka_vm_tag_required":           &hcldec.AttrSpec{Name: "orka_vm_tag_required", Type: cty.Bool, Required: false},
+		"orka_vm_builder_build_id":       &hcldec.AttrSpec{Name: "orka_vm_builder_build_id", Type: cty.String, Required: false},
+		"orka_vm_builder_ttl":            &hcldec.AttrSpec{Name: "orka_vm_builder_ttl", Type: cty.Number, Required: false},
+		"orka_vm_heartbeat_interval":     &hcldec.AttrSpec{Name: "orka_vm_heartbeat_interval", Type: cty.Number, Required: false},
+		"orka_vm_heartbeat_timeout":      &hcldec.AttrSpec{Name: "orka_vm_heartbeat_timeout", Type: cty.Number, Required: false},
+		"orka_build_concurrency_limit":   &hcldec.AttrSpec{Name: "orka_build_concurrency_limit", Type: cty.Number, Required: false},
+		"orka_build_concurrency_key":     &hcldec.AttrSpec{Name: "orka_build_concurrency_key", Type: cty.String, Required: false},
+		"orka_build_concurrency_timeout": &hcldec.AttrSpec{Name: "orka_build_concurrency_timeout", Type: cty.Number, Required: false},
+		"event_log":                      &hcldec.AttrSpec{Name: "event_log", Type: cty.String, Required: false},
+		"tracing_endpoint":               &hcldec.AttrSpec{Name: "tracing_endpoint", Type: cty.String, Required: false},
+		"tracing_headers":                &hcldec.AttrSpec{Name: "tracing_headers", Type: cty.Map(cty.String), Required: false},
+		"tracing_file":                   &hcldec.AttrSpec{Name: "tracing_file", Type: cty.String, Required: false},
+		"metrics_pushgateway_url":        &hcldec.AttrSpec{Name: "metrics_pushgateway_url", Type: cty.String, Required: false},
+		"metrics_textfile":               &hcldec.AttrSpec{Name: "metrics_textfile", Type: cty.String, Required: false},
+		"metrics_job":                    &hcldec.AttrSpec{Name: "metrics_job", Type: cty.String, Required: false},
+		"metrics_labels":                 &hcldec.AttrSpec{Name: "metrics_labels", Type: cty.Map(cty.String), Required: false},
+		"orka_vm_reaper":                 &hcldec.AttrSpec{Name: "orka_vm_reaper", Type: cty.String, Required: false},
+		"source_image":                   &hcldec.AttrSpec{Name: "source_image", Type: cty.String, Required: false},
+		"source_image_pull":              &hcldec.AttrSpec{Name: "source_image_pull", Type: cty.Bool, Required: false},
+		"source_image_pull_name":         &hcldec.AttrSpec{Name: "source_image_pull_name", Type: cty.String, Required: false},
+		"source_image_pull_timeout":      &hcldec.AttrSpec{Name: "source_image_pull_timeout", Type: cty.Number, Required: false},
+		"source_image_pull_force":        &hcldec.AttrSpec{Name: "source_image_pull_force", Type: cty.Bool, Required: false},
+		"orka_precache_image":            &hcldec.AttrSpec{Name: "orka_precache_image", Type: cty.Bool, Required: false},
+		"orka_precache_nodes":            &hcldec.AttrSpec{Name: "orka_precache_nodes", Type: cty.List(cty.String), Required: false},
+		"orka_precache_timeout":          &hcldec.AttrSpec{Name: "orka_precache_timeout", Type: cty.Number, Required: false},
+		"image_name":                     &hcldec.AttrSpec{Name: "image_name", Type: cty.String, Required: false},
+		"image_description":              &hcldec.AttrSpec{Name: "image_description", Type: cty.String, Required: false},
+		"image_force_overwrite":          &hcldec.AttrSpec{Name: "image_force_overwrite", Type: cty.Bool, Required: false},
+		"image_name_conflict":            &hcldec.AttrSpec{Name: "image_name_conflict", Type: cty.String, Required: false},
+		"image_lock":                     &hcldec.AttrSpec{Name: "image_lock", Type: cty.String, Required: false},
+		"image_lock_timeout":             &hcldec.AttrSpec{Name: "image_lock_timeout", Type: cty.Number, Required: false},
+		"image_lock_namespace":           &hcldec.AttrSpec{Name: "image_lock_namespace", Type: cty.String, Required: false},
+		"image_safe_overwrite":           &hcldec.AttrSpec{Name: "image_safe_overwrite", Type: cty.Bool, Required: false},
+		"image_save_mode":                &hcldec.AttrSpec{Name: "image_save_mode", Type: cty.String, Required: false},
+		"image_commit_allowlist":         &hcldec.AttrSpec{Name: "image_commit_allowlist", Type: cty.List(cty.String), Required: false},
+		"image_registry_credentials":     &hcldec.BlockSpec{TypeName: "image_registry_credentials", Nested: hcldec.ObjectSpec((*FlatRegistryCredentials)(nil).HCL2Spec())},
+		"image_signing_key":              &hcldec.AttrSpec{Name: "image_signing_key", Type: cty.String, Required: false},
+		"image_signing_key_password":     &hcldec.AttrSpec{Name: "image_signing_key_password", Type: cty.String, Required: false},
+		"image_provenance":               &hcldec.AttrSpec{Name: "image_provenance", Type: cty.Bool, Required: false},
+		"mock":                           &hcldec.BlockSpec{TypeName: "mock", Nested: hcldec.ObjectSpec((*FlatMockOptions)(nil).HCL2Spec())},
+		"no_create_image":                &hcldec.AttrSpec{Name: "no_create_image", Type: cty.Bool, Required: false},
+		"no_delete_vm":                   &hcldec.AttrSpec{Name: "no_delete_vm", Type: cty.Bool, Required: false},
+		"keep_vm_on_failure":             &hcldec.AttrSpec{Name: "keep_vm_on_failure", Type: cty.Bool, Required: false},
+		"keep_vm_on_failure_ttl":         &hcldec.AttrSpec{Name: "keep_vm_on_failure_ttl", Type: cty.Number, Required: false},
+		"orka_enable_net_boost":          &hcldec.AttrSpec{Name: "orka_enable_net_boost", Type: cty.Bool, Required: false},
+		"orka_enable_legacy_io":          &hcldec.AttrSpec{Name: "orka_enable_legacy_io", Type: cty.Bool, Required: false},
+		"enable_orka_node_ip_mapping":    &hcldec.AttrSpec{Name: "enable_orka_node_ip_mapping", Type: cty.Bool, Required: false},
+		"orka_node_ip_map":               &hcldec.AttrSpec{Name: "orka_node_ip_map", Type: cty.Map(cty.String), Required: false},
+		"packer_vm_timeout":              &hcldec.AttrSpec{Name: "packer_vm_timeout", Type: cty.Number, Required: false},
+		"packer_push_timeout":            &hcldec.AttrSpec{Name: "packer_push_timeout", Type: cty.Number, Required: false},
+		"orka_wait_strategy":             &hcldec.AttrSpec{Name: "orka_wait_strategy", Type: cty.String, Required: false},
+		"orka_wait_poll_interval":        &hcldec.AttrSpec{Name: "orka_wait_poll_interval", Type: cty.Number, Required: false},
+		"orka_wait_watch_failures":       &hcldec.AttrSpec{Name: "orka_wait_watch_failures", Type: cty.Number, Required: false},
 	}
 	return s
 }
@@ -206,3 +284,32 @@ func (*FlatMockOptions) HCL2Spec() map[string]hcldec.Spec {
 	}
 	return s
 }
+
+// FlatRegistryCredentials is an auto-generated flat version of RegistryCredentials.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatRegistryCredentials struct {
+	Username         *string `mapstructure:"username" cty:"username" hcl:"username"`
+	Password         *string `mapstructure:"password" cty:"password" hcl:"password"`
+	Token            *string `mapstructure:"token" cty:"token" hcl:"token"`
+	DockerConfigJSON *string `mapstructure:"docker_config_json" cty:"docker_config_json" hcl:"docker_config_json"`
+}
+
+// FlatMapstructure returns a new FlatRegistryCredentials.
+// FlatRegistryCredentials is an auto-generated flat version of RegistryCredentials.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*RegistryCredentials) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatRegistryCredentials)
+}
+
+// HCL2Spec returns the hcl spec of a RegistryCredentials.
+// This spec is used by HCL to read the fields of RegistryCredentials.
+// The decoded values from this spec will then be applied to a FlatRegistryCredentials.
+func (*FlatRegistryCredentials) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"username":           &hcldec.AttrSpec{Name: "username", Type: cty.String, Required: false},
+		"password":           &hcldec.AttrSpec{Name: "password", Type: cty.String, Required: false},
+		"token":              &hcldec.AttrSpec{Name: "token", Type: cty.String, Required: false},
+		"docker_config_json": &hcldec.AttrSpec{Name: "docker_config_json", Type: cty.String, Required: false},
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+package orka
+
+import (
+	"strings"
+	"testing"
+)
+
+// testConfigRaw returns the smallest valid configuration of the builder with the given options set.
+func testConfigRaw(options map[string]interface{}) map[string]interface{} {
+	raw := map[string]interface{}{
+		"orka_endpoint":   "http://10.221.188.20",
+		"orka_auth_token": "token",
+		"source_image":    "sonoma-base",
+	}
+	for k, v := range options {
+		raw[k] = v
+	}
+	return raw
+}
+
+func TestConfigPrepare(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]interface{}
+		wantErr string
+	}{
+		{"defaults", nil, ""},
+		{"builder ttl", map[string]interface{}{"orka_vm_builder_ttl": 60}, ""},
+		{"negative builder ttl", map[string]interface{}{"orka_vm_builder_ttl": -1}, "orka_vm_builder_ttl must not be negative"},
+		{"negative keep vm ttl", map[string]interface{}{"keep_vm_on_failure_ttl": -1}, "keep_vm_on_failure_ttl must not be negative"},
+		{"negative heartbeat interval", map[string]interface{}{"orka_vm_heartbeat_interval": -1}, "orka_vm_heartbeat_interval must not be negative"},
+		{"negative heartbeat timeout", map[string]interface{}{"orka_vm_heartbeat_timeout": -1}, "orka_vm_heartbeat_timeout must not be negative"},
+		{"negative precache timeout", map[string]interface{}{"orka_precache_timeout": -1}, "orka_precache_timeout must not be negative"},
+		{"negative pull timeout", map[string]interface{}{"source_image_pull_timeout": -1}, "source_image_pull_timeout must not be negative"},
+		{"heartbeat timeout not above interval", map[string]interface{}{"orka_vm_heartbeat_interval": 5, "orka_vm_heartbeat_timeout": 5}, "orka_vm_heartbeat_timeout must be greater than orka_vm_heartbeat_interval"},
+		{"pull force", map[string]interface{}{"source_image_pull": true, "source_image": "ghcr.io/org/sonoma:latest", "source_image_pull_force": true}, ""},
+		{"pull of an invalid reference", map[string]interface{}{"source_image_pull": true, "source_image": "ghcr.io/Org/sonoma"}, "source_image must be an OCI image reference"},
+		{"nfs image name", map[string]interface{}{"image_name": "sonoma-xcode"}, ""},
+		{"oci image name", map[string]interface{}{"image_name": "ghcr.io/org/sonoma:latest"}, ""},
+		{"invalid nfs image name", map[string]interface{}{"image_name": "Sonoma_Xcode", "image_save_mode": "nfs"}, "is not a valid Orka image name"},
+		{"oci image name without tag", map[string]interface{}{"image_name": "ghcr.io/org/sonoma"}, "a tag or a digest is required"},
+		{"unknown save mode", map[string]interface{}{"image_save_mode": "disk"}, "image_save_mode must be one of"},
+		{"commit of an allowed image", map[string]interface{}{"image_save_mode": "commit", "image_commit_allowlist": []string{"sonoma-*"}}, ""},
+		{"commit of a protected image", map[string]interface{}{"image_save_mode": "commit"}, "is protected from commits"},
+		{"commit to another image", map[string]interface{}{"image_save_mode": "commit", "image_commit_allowlist": []string{"sonoma-*"}, "image_name": "sonoma-copy"}, "image_name must be empty or match source_image"},
+		{"negative concurrency limit", map[string]interface{}{"orka_build_concurrency_limit": -1}, "orka_build_concurrency_limit must not be negative"},
+		{"negative concurrency timeout", map[string]interface{}{"orka_build_concurrency_timeout": -1}, "orka_build_concurrency_timeout must not be negative"},
+		{"safe overwrite", map[string]interface{}{"image_name": "sonoma-xcode", "image_force_overwrite": true, "image_safe_overwrite": true}, ""},
+		{"safe overwrite without force overwrite", map[string]interface{}{"image_name": "sonoma-xcode", "image_safe_overwrite": true}, "image_safe_overwrite requires image_force_overwrite"},
+		{"safe overwrite of an oci image", map[string]interface{}{"image_name": "ghcr.io/org/sonoma:latest", "image_force_overwrite": true, "image_safe_overwrite": true}, "image_safe_overwrite can only be used when the image is saved to Orka"},
+		{"image lock namespace", map[string]interface{}{"image_lock": "wait", "image_lock_namespace": "orka-locks"}, ""},
+		{"invalid image lock namespace", map[string]interface{}{"image_lock_namespace": "Orka Locks"}, "image_lock_namespace is not valid"},
+		{"negative image lock timeout", map[string]interface{}{"image_lock_timeout": -1}, "image_lock_timeout must not be negative"},
+		{"wait options", map[string]interface{}{"orka_wait_strategy": "auto", "orka_wait_poll_interval": 5, "orka_wait_watch_failures": 1}, ""},
+		{"negative wait poll interval", map[string]interface{}{"orka_wait_poll_interval": -1}, "orka_wait_poll_interval must be positive"},
+		{"negative wait watch failures", map[string]interface{}{"orka_wait_watch_failures": -1}, "orka_wait_watch_failures must be positive"},
+		{"concurrency key that is not an object name", map[string]interface{}{"orka_build_concurrency_limit": 2, "orka_build_concurrency_key": "Mac Minis"}, ""},
+		{"tag that is not an object name", map[string]interface{}{"orka_vm_tag": "M2_Pro"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Config
+			_, err := c.Prepare(testConfigRaw(tt.options))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package orka
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociConfigMediaType   = "application/vnd.oci.image.config.v1+json"
+
+	cosignSignatureMediaType     = "application/vnd.dev.cosign.simplesigning.v1+json"
+	cosignSignatureAnnotationKey = "dev.cosignproject.cosign/signature"
+	cosignSignatureType          = "cosign container image signature"
+
+	dsseMediaType           = "application/vnd.dsse.envelope.v1+json"
+	inTotoPayloadType       = "application/vnd.in-toto+json"
+	inTotoStatementType     = "https://in-toto.io/Statement/v0.1"
+	predicateTypeKey        = "predicateType"
+	slsaProvenanceV02Type   = "https://slsa.dev/provenance/v0.2"
+	cosignSignatureTagExt   = "sig"
+	cosignAttestationTagExt = "att"
+)
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Size        int               `json:"size"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	ImageConfig   ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// cosignTag returns the tag cosign stores the signatures or attestations of a manifest digest under,
+// such as `sha256-<hex>.sig`.
+func cosignTag(digest, ext string) string {
+	return strings.Replace(digest, ":", "-", 1) + "." + ext
+}
+
+// cosignSignaturePayload returns the simple signing payload cosign signs for an image.
+func cosignSignaturePayload(repository, digest string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"critical": map[string]interface{}{
+			"identity": map[string]string{"docker-reference": repository},
+			"image":    map[string]string{"docker-manifest-digest": digest},
+			"type":     cosignSignatureType,
+		},
+		"optional": nil,
+	})
+}
+
+// signPayload signs the SHA-256 of the payload and returns the base64 encoded ASN.1 signature.
+func signPayload(key *ecdsa.PrivateKey, payload []byte) (string, error) {
+	hash := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign payload: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// dsseEnvelope signs an in-toto statement into a DSSE envelope, as attached by `cosign attest`.
+func dsseEnvelope(key *ecdsa.PrivateKey, statement []byte) ([]byte, error) {
+	// DSSE signs the pre-authentication encoding of the payload type and payload.
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(inTotoPayloadType), inTotoPayloadType, len(statement), statement)
+	signature, err := signPayload(key, []byte(pae))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"payloadType": inTotoPayloadType,
+		"payload":     base64.StdEncoding.EncodeToString(statement),
+		"signatures": []map[string]string{
+			{"keyid": "", "sig": signature},
+		},
+	})
+}
+
+// attachCosignLayer uploads the layer and adds it to the signature or attestation manifest of
+// the digest, keeping the signatures or attestations already attached to it.
+func attachCosignLayer(ctx context.Context, registry *registryClient, digest, ext, mediaType string, layer []byte, annotations map[string]string) error {
+	tag := cosignTag(digest, ext)
+
+	manifest := ociManifest{SchemaVersion: 2, MediaType: ociManifestMediaType}
+	existing, err := registry.getManifest(ctx, tag, ociManifestMediaType)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(existing, &manifest); err != nil {
+			return fmt.Errorf("failed to unmarshal manifest [%s]: %w", tag, err)
+		}
+	case !errors.Is(err, errRegistryNotFound):
+		return err
+	}
+
+	layerDigest, err := registry.putBlob(ctx, layer)
+	if err != nil {
+		return fmt.Errorf("failed to upload layer: %w", err)
+	}
+
+	descriptor := ociDescriptor{MediaType: mediaType, Size: len(layer), Digest: layerDigest, Annotations: annotations}
+	replaced := false
+	for i, l := range manifest.Layers {
+		if l.Digest == layerDigest {
+			manifest.Layers[i] = descriptor
+			replaced = true
+		}
+	}
+	if !replaced {
+		manifest.Layers = append(manifest.Layers, descriptor)
+	}
+
+	diffIDs := make([]string, 0, len(manifest.Layers))
+	for _, l := range manifest.Layers {
+		diffIDs = append(diffIDs, l.Digest)
+	}
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": "",
+		"os":           "",
+		"config":       map[string]interface{}{},
+		"rootfs":       map[string]interface{}{"type": "layers", "diff_ids": diffIDs},
+	})
+	if err != nil {
+		return err
+	}
+	configDigest, err := registry.putBlob(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to upload config: %w", err)
+	}
+	manifest.ImageConfig = ociDescriptor{MediaType: ociConfigMediaType, Size: len(config), Digest: configDigest}
+
+	manifestJSON, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := registry.putManifest(ctx, tag, ociManifestMediaType, manifestJSON); err != nil {
+		return fmt.Errorf("failed to upload manifest [%s]: %w", tag, err)
+	}
+	return nil
+}
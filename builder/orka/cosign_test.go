@@ -0,0 +1,134 @@
+package orka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCosignTag(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	tests := []struct {
+		ext  string
+		want string
+	}{
+		{cosignSignatureTagExt, "sha256-" + strings.Repeat("a", 64) + ".sig"},
+		{cosignAttestationTagExt, "sha256-" + strings.Repeat("a", 64) + ".att"},
+	}
+	for _, tt := range tests {
+		if got := cosignTag(digest, tt.ext); got != tt.want {
+			t.Errorf("cosignTag(%q) = %q, want %q", tt.ext, got, tt.want)
+		}
+	}
+}
+
+func TestCosignSignaturePayload(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	payload, err := cosignSignaturePayload("ghcr.io/org/sonoma", digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(payload, &got); err != nil {
+		t.Fatalf("payload is not JSON: %s", err)
+	}
+	want := map[string]interface{}{
+		"critical": map[string]interface{}{
+			"identity": map[string]interface{}{"docker-reference": "ghcr.io/org/sonoma"},
+			"image":    map[string]interface{}{"docker-manifest-digest": digest},
+			"type":     "cosign container image signature",
+		},
+		"optional": nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("payload = %s, want %v", payload, want)
+	}
+}
+
+func TestSignPayload(t *testing.T) {
+	key := testSigningKey(t)
+	payload := []byte(`{"critical":{}}`)
+
+	signature, err := signPayload(key, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifySignature(t, &key.PublicKey, payload, signature) {
+		t.Errorf("signature does not verify against the payload")
+	}
+	if verifySignature(t, &key.PublicKey, []byte(`{"critical":null}`), signature) {
+		t.Errorf("signature verifies against another payload")
+	}
+}
+
+func TestDsseEnvelope(t *testing.T) {
+	key := testSigningKey(t)
+	statement := []byte(`{"_type":"https://in-toto.io/Statement/v0.1","predicateType":"https://slsa.dev/provenance/v0.2"}`)
+
+	envelope, err := dsseEnvelope(key, statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		PayloadType string `json:"payloadType"`
+		Payload     string `json:"payload"`
+		Signatures  []struct {
+			KeyID string `json:"keyid"`
+			Sig   string `json:"sig"`
+		} `json:"signatures"`
+	}
+	if err := json.Unmarshal(envelope, &got); err != nil {
+		t.Fatalf("envelope is not JSON: %s", err)
+	}
+	if got.PayloadType != inTotoPayloadType {
+		t.Errorf("payloadType = %q, want %q", got.PayloadType, inTotoPayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(got.Payload)
+	if err != nil || string(payload) != string(statement) {
+		t.Errorf("payload = %q (%v), want the statement", payload, err)
+	}
+	if len(got.Signatures) != 1 {
+		t.Fatalf("envelope has %d signatures, want 1", len(got.Signatures))
+	}
+
+	// The signature is over the pre-authentication encoding, not the bare statement.
+	pae := fmt.Sprintf("DSSEv1 %d %s %d %s", len(inTotoPayloadType), inTotoPayloadType, len(statement), statement)
+	if !verifySignature(t, &key.PublicKey, []byte(pae), got.Signatures[0].Sig) {
+		t.Errorf("signature does not verify against the pre-authentication encoding")
+	}
+	if verifySignature(t, &key.PublicKey, statement, got.Signatures[0].Sig) {
+		t.Errorf("signature verifies against the bare statement")
+	}
+}
+
+func testSigningKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func verifySignature(t *testing.T, key *ecdsa.PublicKey, payload []byte, signature string) bool {
+	t.Helper()
+
+	raw, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		t.Fatalf("signature is not base64: %s", err)
+	}
+	hash := sha256.Sum256(payload)
+	return ecdsa.VerifyASN1(key, hash[:], raw)
+}
@@ -0,0 +1,178 @@
+package orka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+// Events written to `event_log`.
+const (
+	EventBuildStart     = "build_start"
+	EventBuildEnd       = "build_end"
+	EventVmCreate       = "vm_create"
+	EventVmScheduled    = "vm_scheduled"
+	EventVmPhase        = "vm_phase"
+	EventVmRunning      = "vm_running"
+	EventSSHConnected   = "ssh_connected"
+	EventSyncStart      = "sync_start"
+	EventSyncDone       = "sync_done"
+	EventSaveStart      = "save_start"
+	EventPushJobStarted = "push_job_started"
+	EventImageReady     = "image_ready"
+	EventCleanup        = "cleanup"
+)
+
+// StateEventLog holds the event log of the build, if `event_log` is set.
+const StateEventLog = "event_log"
+
+// buildEvent is a line of the event log.
+type buildEvent struct {
+	Time    time.Time `json:"time"`
+	BuildID string    `json:"build_id"`
+	Event   string    `json:"event"`
+
+	// Duration is the time in seconds since the event the phase started with, if any.
+	Duration *float64 `json:"duration_seconds,omitempty"`
+
+	// Elapsed is the time in seconds since the build started.
+	Elapsed float64 `json:"elapsed_seconds"`
+
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// eventLog writes the phases of a build as JSON lines, so dashboards can follow builds without
+// parsing the Packer output. Without a file it only records when each phase happened, for the build
+// metrics. A nil eventLog discards events.
+type eventLog struct {
+	mu      sync.Mutex
+	f       *os.File
+	buildID string
+	start   time.Time
+
+	// seen holds the time each event was last written, to compute phase durations.
+	seen map[string]time.Time
+}
+
+func openEventLog(path, buildID string) (*eventLog, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	l := newEventLog(buildID)
+	l.f = f
+	return l, nil
+}
+
+// newEventLog returns an event log that records events without writing them.
+func newEventLog(buildID string) *eventLog {
+	return &eventLog{
+		buildID: buildID,
+		start:   time.Now(),
+		seen:    map[string]time.Time{},
+	}
+}
+
+// emit writes an event. If since is the name of an earlier event, the time since that event is
+// recorded as the duration of the phase.
+func (l *eventLog) emit(event, since string, fields map[string]interface{}) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	e := buildEvent{
+		Time:    now.UTC(),
+		BuildID: l.buildID,
+		Event:   event,
+		Elapsed: now.Sub(l.start).Seconds(),
+		Fields:  fields,
+	}
+	if started, ok := l.seen[since]; ok {
+		duration := now.Sub(started).Seconds()
+		e.Duration = &duration
+	}
+	l.seen[event] = now
+	if l.f == nil {
+		return
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("failed to encode event [%s]: %s", event, err)
+		return
+	}
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		log.Printf("failed to write event [%s]: %s", event, err)
+	}
+}
+
+// between returns the time from the last since event to the last event, if both happened in that order.
+func (l *eventLog) between(since, event string) (time.Duration, bool) {
+	if l == nil {
+		return 0, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	started, ok := l.seen[since]
+	ended, ok2 := l.seen[event]
+	if !ok || !ok2 || ended.Before(started) {
+		return 0, false
+	}
+	return ended.Sub(started), true
+}
+
+// happened reports whether the event was emitted.
+func (l *eventLog) happened(event string) bool {
+	if l == nil {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ok := l.seen[event]
+	return ok
+}
+
+func (l *eventLog) Close() error {
+	if l == nil || l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// stepEmitEvent writes an event for a phase run by a step of the SDK, such as the communicator.
+type stepEmitEvent struct {
+	event string
+	since string
+}
+
+func (s *stepEmitEvent) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	emitEvent(state, s.event, s.since, nil)
+	return multistep.ActionContinue
+}
+
+func (s *stepEmitEvent) Cleanup(state multistep.StateBag) {}
+
+// emitEvent writes an event to the event log of the build, if any.
+func emitEvent(state multistep.StateBag, event, since string, fields map[string]interface{}) {
+	events(state).emit(event, since, fields)
+}
+
+// events returns the event log of the build, or nil if `event_log` is not set.
+func events(state multistep.StateBag) *eventLog {
+	if l, ok := state.GetOk(StateEventLog); ok {
+		return l.(*eventLog)
+	}
+	return nil
+}
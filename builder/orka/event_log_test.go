@@ -0,0 +1,135 @@
+package orka
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventLogEmit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	l, err := openEventLog(path, "build-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.emit(EventBuildStart, "", nil)
+	l.emit(EventVmCreate, EventBuildStart, map[string]interface{}{"vm_name": "vm"})
+	l.emit(EventVmRunning, EventVmCreate, nil)
+	l.emit(EventSaveStart, EventSyncStart, nil)
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var events []buildEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e buildEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("invalid event line %q: %s", scanner.Text(), err)
+		}
+		events = append(events, e)
+	}
+
+	tests := []struct {
+		event        string
+		wantDuration bool
+		wantFields   map[string]interface{}
+	}{
+		{event: EventBuildStart},
+		{event: EventVmCreate, wantDuration: true, wantFields: map[string]interface{}{"vm_name": "vm"}},
+		{event: EventVmRunning, wantDuration: true},
+		// The phase started with an event that never happened, so it has no duration.
+		{event: EventSaveStart},
+	}
+	if len(events) != len(tests) {
+		t.Fatalf("wrote %d events, want %d", len(events), len(tests))
+	}
+	for i, tt := range tests {
+		e := events[i]
+		if e.Event != tt.event || e.BuildID != "build-a" {
+			t.Errorf("event %d = %s of build %s, want %s of build-a", i, e.Event, e.BuildID, tt.event)
+		}
+		if (e.Duration != nil) != tt.wantDuration {
+			t.Errorf("event %s duration = %v, want duration %v", e.Event, e.Duration, tt.wantDuration)
+		}
+		if e.Duration != nil && (*e.Duration < 0 || *e.Duration > e.Elapsed) {
+			t.Errorf("event %s duration = %f, want between 0 and the elapsed %f", e.Event, *e.Duration, e.Elapsed)
+		}
+		if !reflect.DeepEqual(e.Fields, tt.wantFields) {
+			t.Errorf("event %s fields = %v, want %v", e.Event, e.Fields, tt.wantFields)
+		}
+		if i > 0 && (e.Time.Before(events[i-1].Time) || e.Elapsed < events[i-1].Elapsed) {
+			t.Errorf("event %s is before event %s", e.Event, events[i-1].Event)
+		}
+	}
+}
+
+func TestEventLogBetween(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := newEventLog("build-a")
+	l.seen = map[string]time.Time{
+		EventVmCreate:  start,
+		EventVmRunning: start.Add(90 * time.Second),
+		EventSyncStart: start.Add(2 * time.Minute),
+	}
+
+	tests := []struct {
+		name   string
+		log    *eventLog
+		since  string
+		event  string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"in order", l, EventVmCreate, EventVmRunning, 90 * time.Second, true},
+		{"same event", l, EventVmCreate, EventVmCreate, 0, true},
+		{"out of order", l, EventSyncStart, EventVmRunning, 0, false},
+		{"start missing", l, EventSaveStart, EventVmRunning, 0, false},
+		{"end missing", l, EventVmCreate, EventImageReady, 0, false},
+		{"nil log", nil, EventVmCreate, EventVmRunning, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.log.between(tt.since, tt.event)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("between() = %s, %v, want %s, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestEventLogNil(t *testing.T) {
+	var l *eventLog
+	l.emit(EventBuildStart, "", nil)
+	if l.happened(EventBuildStart) {
+		t.Error("a nil event log recorded an event")
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
+
+func TestEventLogWithoutFile(t *testing.T) {
+	l := newEventLog("build-a")
+	l.emit(EventVmCreate, "", nil)
+	l.emit(EventVmRunning, EventVmCreate, nil)
+
+	if !l.happened(EventVmCreate) || !l.happened(EventVmRunning) || l.happened(EventImageReady) {
+		t.Error("events were not recorded without a file")
+	}
+	if _, ok := l.between(EventVmCreate, EventVmRunning); !ok {
+		t.Error("phase was not recorded without a file")
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+}
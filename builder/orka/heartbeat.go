@@ -0,0 +1,129 @@
+package orka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// vmHeartbeat periodically records on the builder VM that the build owning it is still alive.
+type vmHeartbeat struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startVmHeartbeat starts updating the heartbeat annotation of the given VM every interval.
+// The heartbeat stops when ctx is cancelled or Stop is called. Repeated failures are reported on ui,
+// and onLost is called before the last heartbeat gets older than timeout, after which the VM could be
+// reaped as abandoned.
+func startVmHeartbeat(ctx context.Context, orkaClient OrkaClient, ui packer.Ui, namespace, name string, interval, timeout time.Duration, onLost func(err error)) *vmHeartbeat {
+	ctx, cancel := context.WithCancel(ctx)
+	h := &vmHeartbeat{
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(h.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// The VM is created with a heartbeat.
+		lastBeat := time.Now()
+		failures := 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				now := time.Now()
+				err := patchVmAnnotations(ctx, orkaClient, namespace, name, heartbeatAnnotations(now))
+				if ctx.Err() != nil {
+					return
+				}
+				if err == nil {
+					lastBeat = now
+					failures = 0
+					continue
+				}
+
+				failures++
+				log.Printf("failed to update heartbeat of VM [%s]: %s", name, err)
+				if heartbeatExpiring(lastBeat, now, interval, timeout) {
+					onLost(&vmHeartbeatLostError{name: name, lastBeat: lastBeat, err: err})
+					return
+				}
+				if failures > 1 {
+					ui.Error(fmt.Sprintf("failed to update heartbeat of VM [%s] %d times in a row: %s", name, failures, err))
+				}
+			}
+		}
+	}()
+
+	return h
+}
+
+// heartbeatExpiring reports whether the last heartbeat would be older than timeout by the next one.
+func heartbeatExpiring(lastBeat, now time.Time, interval, timeout time.Duration) bool {
+	return now.Add(interval).Sub(lastBeat) >= timeout
+}
+
+// Stop stops the heartbeat and waits for any in-flight update to finish.
+func (h *vmHeartbeat) Stop() {
+	if h == nil {
+		return
+	}
+
+	h.cancel()
+	<-h.done
+}
+
+func heartbeatAnnotations(now time.Time) map[string]*string {
+	heartbeat := now.UTC().Format(time.RFC3339)
+	return map[string]*string{PackerHeartbeatAnnotationKey: &heartbeat}
+}
+
+// patchVmAnnotations merges the given annotations into the VM. A nil value removes the annotation.
+func patchVmAnnotations(ctx context.Context, orkaClient OrkaClient, namespace, name string, annotations map[string]*string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	vmi := &orkav1.VirtualMachineInstance{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+	}
+	return orkaClient.Patch(ctx, vmi, client.RawPatch(types.MergePatchType, patch))
+}
+
+// vmHeartbeatLostError is returned when the heartbeat of the builder VM could not be updated for
+// almost the heartbeat timeout, so other builds would soon reap the VM as abandoned.
+type vmHeartbeatLostError struct {
+	name     string
+	lastBeat time.Time
+	err      error
+}
+
+func (e *vmHeartbeatLostError) Error() string {
+	return fmt.Sprintf("failed to update heartbeat of VM [%s] since %s, it would be reaped as abandoned: %s", e.name, e.lastBeat.UTC().Format(time.RFC3339), e.err)
+}
+
+func (e *vmHeartbeatLostError) Unwrap() error {
+	return e.err
+}
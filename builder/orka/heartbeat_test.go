@@ -0,0 +1,79 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/macstadium/packer-plugin-macstadium-orka/mocks"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// failingPatchClient is the mock Orka client whose patches always fail.
+type failingPatchClient struct {
+	mocks.OrkaClient
+}
+
+func (c *failingPatchClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return errors.New("connection refused")
+}
+
+func TestHeartbeatExpiring(t *testing.T) {
+	lastBeat := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		since time.Duration
+		want  bool
+	}{
+		{"just beat", 0, false},
+		{"next beat within the timeout", 8 * time.Minute, false},
+		{"next beat at the timeout", 9 * time.Minute, true},
+		{"past the timeout", 11 * time.Minute, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := heartbeatExpiring(lastBeat, lastBeat.Add(tt.since), time.Minute, 10*time.Minute); got != tt.want {
+				t.Errorf("heartbeatExpiring() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVmHeartbeatLost(t *testing.T) {
+	ui := &packer.MockUi{}
+	lost := make(chan error, 1)
+	h := startVmHeartbeat(context.Background(), &failingPatchClient{}, ui, "orka-default", "vm", 10*time.Millisecond, 100*time.Millisecond, func(err error) {
+		lost <- err
+	})
+
+	select {
+	case err := <-lost:
+		var lostErr *vmHeartbeatLostError
+		if !errors.As(err, &lostErr) {
+			t.Errorf("onLost() error = %v, want a vmHeartbeatLostError", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("onLost was not called")
+	}
+	h.Stop()
+
+	if !ui.ErrorCalled {
+		t.Error("repeated heartbeat failures were not reported")
+	}
+}
+
+func TestVmHeartbeatKeepsBeating(t *testing.T) {
+	objects := newObjectClient()
+	h := startVmHeartbeat(context.Background(), objects, &packer.MockUi{}, "orka-default", "vm", 10*time.Millisecond, 30*time.Millisecond, func(err error) {
+		t.Errorf("onLost() called with %v", err)
+	})
+	time.Sleep(100 * time.Millisecond)
+	h.Stop()
+
+	if len(objects.objects) != 1 {
+		t.Errorf("patched %d objects, want 1", len(objects.objects))
+	}
+}
@@ -0,0 +1,113 @@
+package orka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CopyImage copies the source image to a new image with the destination name and waits up to timeout
+// minutes for the copy to be ready. An existing destination image is reported as an error, or replaced
+// if overwrite is set. Orka cannot replace an image in place, so the source is first copied to a temporary
+// image. The destination is only deleted once that copy is ready, and a failed copy leaves it in place.
+func CopyImage(ctx context.Context, orkaClient OrkaClient, source, destination, description string, overwrite bool, timeout int) error {
+	exists, err := imageExists(ctx, orkaClient, destination)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return copyImage(ctx, orkaClient, source, destination, description, timeout)
+	}
+	if !overwrite {
+		return fmt.Errorf("image [%s] already exists, set image_force_overwrite to replace it", destination)
+	}
+
+	temporary, err := temporaryImageName(destination)
+	if err != nil {
+		return err
+	}
+	if err := copyImage(ctx, orkaClient, source, temporary, description, timeout); err != nil {
+		if deleteErr := deleteImage(ctx, orkaClient, temporary); deleteErr != nil {
+			return fmt.Errorf("%w, and failed to delete image [%s]: %s", err, temporary, deleteErr)
+		}
+		return err
+	}
+	if err := replaceImage(ctx, orkaClient, temporary, destination, description, timeout); err != nil {
+		return err
+	}
+	if err := deleteImage(ctx, orkaClient, temporary); err != nil {
+		return fmt.Errorf("failed to delete image [%s]: %w", temporary, err)
+	}
+	return nil
+}
+
+// replaceImage replaces the destination image with a copy of the source image, which must be ready, and
+// waits up to timeout minutes for the copy to be ready. Orka cannot replace an image in place, so the
+// destination name does not exist from the moment it is deleted until the copy is ready. The source image
+// is kept, so nothing is lost if the copy fails.
+func replaceImage(ctx context.Context, orkaClient OrkaClient, source, destination, description string, timeout int) error {
+	if err := deleteImage(ctx, orkaClient, destination); err != nil {
+		return fmt.Errorf("failed to delete existing image [%s]: %w", destination, err)
+	}
+	if err := copyImage(ctx, orkaClient, source, destination, description, timeout); err != nil {
+		return fmt.Errorf("image [%s] was deleted and its replacement is kept as image [%s]: %w", destination, source, err)
+	}
+	return nil
+}
+
+// copyImage copies the source image to a new image and waits up to timeout minutes for it to be ready.
+func copyImage(ctx context.Context, orkaClient OrkaClient, source, destination, description string, timeout int) error {
+	image := &orkav1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultOrkaNamespace,
+			Name:      destination,
+			Annotations: map[string]string{
+				DescriptionAnnotationKey: description,
+			},
+		},
+		Spec: orkav1.ImageSpec{
+			Source:     source,
+			SourceType: orkav1.Local,
+		},
+	}
+	if err := orkaClient.Create(ctx, image); err != nil {
+		return fmt.Errorf("failed to create an image copy request: %w", err)
+	}
+
+	if err := orkaClient.WaitForImage(ctx, destination, timeout); err != nil {
+		return fmt.Errorf("failed to copy image [%s] to [%s]: %w", source, destination, err)
+	}
+	return nil
+}
+
+func imageExists(ctx context.Context, orkaClient OrkaClient, name string) (bool, error) {
+	err := orkaClient.Get(ctx, client.ObjectKey{Namespace: DefaultOrkaNamespace, Name: name}, &orkav1.Image{})
+	if client.IgnoreNotFound(err) != nil {
+		return false, fmt.Errorf("failed to get image [%s]: %w", name, err)
+	}
+	return err == nil, nil
+}
+
+func deleteImage(ctx context.Context, orkaClient OrkaClient, name string) error {
+	image := &orkav1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultOrkaNamespace,
+			Name:      name,
+		},
+	}
+	return client.IgnoreNotFound(orkaClient.Delete(ctx, image))
+}
+
+// temporaryImageName returns a unique name for an image that is copied to the given name once ready.
+func temporaryImageName(name string) (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("failed to generate a temporary image name: %w", err)
+	}
+	return fmt.Sprintf("%s-tmp-%s", name, hex.EncodeToString(suffix)), nil
+}
@@ -0,0 +1,87 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// imageCopyClient stores the images it is given, and fails to copy to the names matched by fail.
+type imageCopyClient struct {
+	*objectClient
+
+	fail func(name string) bool
+}
+
+func (c *imageCopyClient) WaitForImage(ctx context.Context, name string, timeout int) error {
+	if c.fail != nil && c.fail(name) {
+		return errors.New("image copy failed")
+	}
+	return nil
+}
+
+// images returns the names of the stored images with the source each was copied from. The temporary
+// image is named "tmp".
+func (c *imageCopyClient) images() map[string]string {
+	temporary := func(name string) string {
+		if strings.HasPrefix(name, "latest-tmp-") {
+			return "tmp"
+		}
+		return name
+	}
+	images := map[string]string{}
+	for _, obj := range c.objects {
+		if image, ok := obj.(*orkav1.Image); ok {
+			images[temporary(image.Name)] = temporary(image.Spec.Source)
+		}
+	}
+	return images
+}
+
+func TestCopyImage(t *testing.T) {
+	isTemporary := func(name string) bool { return strings.HasPrefix(name, "latest-tmp-") }
+	isLatest := func(name string) bool { return name == "latest" }
+
+	tests := []struct {
+		name      string
+		existing  bool
+		overwrite bool
+		fail      func(name string) bool
+		wantErr   string
+		// wantImages maps the images left behind to the image each was copied from.
+		wantImages map[string]string
+	}{
+		{name: "new image", wantImages: map[string]string{"latest": "build"}},
+		{name: "existing image", existing: true, wantErr: "already exists", wantImages: map[string]string{"latest": "old"}},
+		{name: "overwrite", existing: true, overwrite: true, wantImages: map[string]string{"latest": "tmp"}},
+		{name: "failed copy keeps the existing image", existing: true, overwrite: true, fail: isTemporary, wantErr: "image copy failed", wantImages: map[string]string{"latest": "old"}},
+		{name: "failed replacement keeps the copy", existing: true, overwrite: true, fail: isLatest, wantErr: "its replacement is kept", wantImages: map[string]string{"latest": "tmp", "tmp": "build"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &imageCopyClient{objectClient: newObjectClient(), fail: tt.fail}
+			if tt.existing {
+				c.Create(context.Background(), &orkav1.Image{
+					ObjectMeta: metav1.ObjectMeta{Namespace: DefaultOrkaNamespace, Name: "latest"},
+					Spec:       orkav1.ImageSpec{Source: "old"},
+				})
+			}
+
+			err := CopyImage(context.Background(), c, "build", "latest", "Copied from build", tt.overwrite, 60)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if images := c.images(); !reflect.DeepEqual(images, tt.wantImages) {
+				t.Errorf("images = %v, want %v", images, tt.wantImages)
+			}
+		})
+	}
+}
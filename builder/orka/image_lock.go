@@ -0,0 +1,231 @@
+package orka
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	ImageLockOff  = "off"
+	ImageLockWait = "wait"
+	ImageLockFail = "fail"
+
+	// ImageLockAnnotationKey holds the name of the image a Lease locks.
+	ImageLockAnnotationKey = "orka.macstadium.com/packer-image-lock"
+
+	// A lock not renewed for imageLockDuration expires, so locks of builds that were killed are taken over.
+	imageLockDuration      = 2 * time.Minute
+	imageLockRenewInterval = 30 * time.Second
+	imageLockPollInterval  = 10 * time.Second
+)
+
+// imageLock is a Lease held by a build while it writes an image, so builds writing the same image
+// name do not race. The Lease lives in the given namespace, the namespace of the images by default, and is
+// named after a hash of the image name, which may be an OCI reference.
+type imageLock struct {
+	orkaClient OrkaClient
+	image      string
+	holder     string
+	lease      *coordinationv1.Lease
+
+	// onLost is called when the lock expired and another build took it.
+	onLost func(err error)
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newImageLock(orkaClient OrkaClient, namespace, image, holder string, onLost func(err error)) *imageLock {
+	sum := sha256.Sum256([]byte(image))
+	return &imageLock{
+		orkaClient: orkaClient,
+		image:      image,
+		holder:     holder,
+		onLost:     onLost,
+		lease: &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: namespace,
+				Name:      fmt.Sprintf("packer-image-lock-%s", hex.EncodeToString(sum[:8])),
+			},
+		},
+	}
+}
+
+// tryLock takes the lock if it is free, expired or already held by the build. Otherwise it returns
+// false and the current holder.
+func (l *imageLock) tryLock(ctx context.Context) (bool, string, error) {
+	lease := &coordinationv1.Lease{}
+	err := l.orkaClient.Get(ctx, client.ObjectKeyFromObject(l.lease), lease)
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(imageLockDuration.Seconds())
+
+	if apierrors.IsNotFound(err) {
+		lease = l.lease.DeepCopy()
+		lease.Annotations = map[string]string{ImageLockAnnotationKey: l.image}
+		lease.Spec = coordinationv1.LeaseSpec{
+			HolderIdentity:       &l.holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		}
+		if err := l.orkaClient.Create(ctx, lease); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				return false, "", nil
+			}
+			return false, "", fmt.Errorf("failed to create image lock: %w", err)
+		}
+		l.lease = lease
+		return true, l.holder, nil
+	}
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get image lock: %w", err)
+	}
+
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if holder != "" && holder != l.holder && !leaseExpired(lease, now.Time) {
+		return false, holder, nil
+	}
+
+	patch := client.MergeFromWithOptions(lease.DeepCopy(), client.MergeFromWithOptimisticLock{})
+	lease.Spec.HolderIdentity = &l.holder
+	lease.Spec.LeaseDurationSeconds = &duration
+	if holder != l.holder {
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.RenewTime = &now
+	if err := l.orkaClient.Patch(ctx, lease, patch); err != nil {
+		if apierrors.IsConflict(err) {
+			return false, "", nil
+		}
+		return false, "", fmt.Errorf("failed to take image lock: %w", err)
+	}
+	l.lease = lease
+	return true, l.holder, nil
+}
+
+// lock takes the lock, waiting up to timeout minutes for it if wait is set. onWait is called with
+// the holder whenever another build holds the lock.
+func (l *imageLock) lock(ctx context.Context, wait bool, timeout int, onWait func(holder string)) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Minute)
+	defer cancel()
+
+	lastHolder := ""
+	err := pollUntil(ctx, imageLockPollInterval, func(ctx context.Context) (bool, error) {
+		locked, holder, err := l.tryLock(ctx)
+		if err != nil || locked {
+			return true, err
+		}
+		if holder == "" {
+			// Another build changed the lock at the same time, try again.
+			return false, nil
+		}
+		if !wait {
+			return true, &imageLockedError{image: l.image, holder: holder}
+		}
+		if holder != lastHolder {
+			onWait(holder)
+			lastHolder = holder
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.startRenewal()
+	return nil
+}
+
+// startRenewal renews the lock until it is unlocked. Renewal stops and onLost is called if another
+// build took the lock.
+func (l *imageLock) startRenewal() {
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	l.done = make(chan struct{})
+
+	go func() {
+		defer close(l.done)
+
+		ticker := time.NewTicker(imageLockRenewInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if locked, holder, err := l.tryLock(ctx); err != nil && ctx.Err() == nil {
+					log.Printf("failed to renew lock of image [%s]: %s", l.image, err)
+				} else if !locked && holder != "" {
+					l.onLost(&imageLockLostError{image: l.image, holder: holder})
+					return
+				}
+			}
+		}
+	}()
+}
+
+// unlock stops renewing the lock and deletes the Lease if the build still holds it.
+func (l *imageLock) unlock(ctx context.Context) error {
+	if l.cancel != nil {
+		l.cancel()
+		<-l.done
+		l.cancel = nil
+	}
+
+	lease := &coordinationv1.Lease{}
+	if err := l.orkaClient.Get(ctx, client.ObjectKeyFromObject(l.lease), lease); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.holder {
+		return nil
+	}
+
+	resourceVersion := lease.ResourceVersion
+	err := l.orkaClient.Delete(ctx, lease, client.Preconditions{ResourceVersion: &resourceVersion})
+	if apierrors.IsConflict(err) {
+		// Another build took the lock in the meantime.
+		return nil
+	}
+	return client.IgnoreNotFound(err)
+}
+
+// imageLockedError is returned when another build holds the lock of an image and the build does not wait for it.
+type imageLockedError struct {
+	image  string
+	holder string
+}
+
+func (e *imageLockedError) Error() string {
+	return fmt.Sprintf("image [%s] is being written by build [%s]", e.image, e.holder)
+}
+
+// imageLockLostError is returned when the lock of an image expired and another build took it.
+type imageLockLostError struct {
+	image  string
+	holder string
+}
+
+func (e *imageLockLostError) Error() string {
+	return fmt.Sprintf("lock of image [%s] expired and was taken by build [%s]", e.image, e.holder)
+}
+
+// leaseExpired reports whether the lease was not renewed within its duration.
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	return now.After(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second))
+}
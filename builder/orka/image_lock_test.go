@@ -0,0 +1,122 @@
+package orka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestLeaseExpired(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	renewed := func(d time.Duration) *metav1.MicroTime {
+		renewTime := metav1.NewMicroTime(now.Add(d))
+		return &renewTime
+	}
+	seconds := func(s int32) *int32 { return &s }
+
+	tests := []struct {
+		name string
+		spec coordinationv1.LeaseSpec
+		want bool
+	}{
+		{"renewed within its duration", coordinationv1.LeaseSpec{RenewTime: renewed(-time.Minute), LeaseDurationSeconds: seconds(120)}, false},
+		{"renewed at the end of its duration", coordinationv1.LeaseSpec{RenewTime: renewed(-2 * time.Minute), LeaseDurationSeconds: seconds(120)}, false},
+		{"not renewed within its duration", coordinationv1.LeaseSpec{RenewTime: renewed(-3 * time.Minute), LeaseDurationSeconds: seconds(120)}, true},
+		{"never renewed", coordinationv1.LeaseSpec{LeaseDurationSeconds: seconds(120)}, true},
+		{"no duration", coordinationv1.LeaseSpec{RenewTime: renewed(0)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := leaseExpired(&coordinationv1.Lease{Spec: tt.spec}, now); got != tt.want {
+				t.Errorf("leaseExpired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageLockTryLock(t *testing.T) {
+	expired := metav1.NewMicroTime(time.Now().Add(-imageLockDuration - time.Minute))
+	fresh := metav1.NewMicroTime(time.Now())
+	duration := int32(imageLockDuration.Seconds())
+
+	tests := []struct {
+		name       string
+		holder     string
+		renewed    *metav1.MicroTime
+		wantLocked bool
+		wantHolder string
+	}{
+		{name: "free", wantLocked: true, wantHolder: "build-a"},
+		{name: "held by another build", holder: "build-b", renewed: &fresh, wantHolder: "build-b"},
+		{name: "expired", holder: "build-b", renewed: &expired, wantLocked: true, wantHolder: "build-a"},
+		{name: "held by the build", holder: "build-a", renewed: &fresh, wantLocked: true, wantHolder: "build-a"},
+		{name: "released", holder: "", renewed: &fresh, wantLocked: true, wantHolder: "build-a"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			orkaClient := newObjectClient()
+			lock := newImageLock(orkaClient, DefaultOrkaNamespace, "ghcr.io/org/sonoma:latest", "build-a", func(error) {})
+
+			if tt.renewed != nil {
+				lease := lock.lease.DeepCopy()
+				lease.Spec = coordinationv1.LeaseSpec{HolderIdentity: &tt.holder, LeaseDurationSeconds: &duration, RenewTime: tt.renewed}
+				if err := orkaClient.Create(ctx, lease); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			locked, holder, err := lock.tryLock(ctx)
+			if err != nil {
+				t.Fatalf("tryLock: %s", err)
+			}
+			if locked != tt.wantLocked || holder != tt.wantHolder {
+				t.Fatalf("tryLock() = %v, %q, want %v, %q", locked, holder, tt.wantLocked, tt.wantHolder)
+			}
+
+			lease := &coordinationv1.Lease{}
+			if err := orkaClient.Get(ctx, client.ObjectKeyFromObject(lock.lease), lease); err != nil {
+				t.Fatal(err)
+			}
+			if got := *lease.Spec.HolderIdentity; got != tt.wantHolder {
+				t.Errorf("lease holder = %q, want %q", got, tt.wantHolder)
+			}
+			if tt.wantLocked && leaseExpired(lease, time.Now()) {
+				t.Errorf("lease taken by the build is expired")
+			}
+		})
+	}
+}
+
+func TestImageLockUnlock(t *testing.T) {
+	ctx := context.Background()
+	orkaClient := newObjectClient()
+	lock := newImageLock(orkaClient, DefaultOrkaNamespace, "sonoma-xcode", "build-a", func(error) {})
+	other := newImageLock(orkaClient, DefaultOrkaNamespace, "sonoma-xcode", "build-b", func(error) {})
+
+	if locked, _, err := lock.tryLock(ctx); err != nil || !locked {
+		t.Fatalf("tryLock() = %v, %v, want the lock", locked, err)
+	}
+	if locked, holder, err := other.tryLock(ctx); err != nil || locked || holder != "build-a" {
+		t.Fatalf("tryLock() of another build = %v, %q, %v, want the lock held by build-a", locked, holder, err)
+	}
+
+	if err := lock.unlock(ctx); err != nil {
+		t.Fatalf("unlock: %s", err)
+	}
+	if locked, _, err := other.tryLock(ctx); err != nil || !locked {
+		t.Fatalf("tryLock() of another build after unlock = %v, %v, want the lock", locked, err)
+	}
+
+	// Unlocking a lock taken over by another build leaves it alone.
+	if err := lock.unlock(ctx); err != nil {
+		t.Fatalf("unlock: %s", err)
+	}
+	if locked, holder, err := lock.tryLock(ctx); err != nil || locked || holder != "build-b" {
+		t.Fatalf("tryLock() = %v, %q, %v, want the lock held by build-b", locked, holder, err)
+	}
+}
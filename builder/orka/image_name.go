@@ -0,0 +1,98 @@
+package orka
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	ImageSaveModeAuto   = "auto"
+	ImageSaveModeNFS    = "nfs"
+	ImageSaveModeOCI    = "oci"
+	ImageSaveModeCommit = "commit"
+
+	ImageNameConflictError  = "error"
+	ImageNameConflictSuffix = "suffix"
+)
+
+// imageSaveModeFor returns the save mode for an image name in `auto` mode. Names with a registry,
+// repository path, tag or digest separator can only be OCI references, everything else is an NFS image.
+func imageSaveModeFor(name string) string {
+	if strings.ContainsAny(name, "/:@") {
+		return ImageSaveModeOCI
+	}
+	return ImageSaveModeNFS
+}
+
+// validateNFSImageName checks the name is a valid Orka image name.
+func validateNFSImageName(name string) error {
+	if es := validation.IsDNS1123Subdomain(name); len(es) > 0 {
+		return fmt.Errorf("%q is not a valid Orka image name: %s", name, strings.Join(es, "; "))
+	}
+	return nil
+}
+
+// checkImageCommitAllowed checks the source image may be updated in place, which requires it to match
+// one of the allowlist patterns so base images are not committed to by accident.
+func checkImageCommitAllowed(name string, allowlist []string) error {
+	if err := validateNFSImageName(name); err != nil {
+		return fmt.Errorf("source_image: %w", err)
+	}
+	allowed := false
+	for _, pattern := range allowlist {
+		matched, err := path.Match(pattern, name)
+		if err != nil {
+			return fmt.Errorf("image_commit_allowlist: invalid pattern %q: %w", pattern, err)
+		}
+		allowed = allowed || matched
+	}
+	if allowed {
+		return nil
+	}
+	return fmt.Errorf("source image %q is protected from commits, add it to image_commit_allowlist to update it in place", name)
+}
+
+// validateOCIImageName checks the name is a fully qualified OCI image reference with a tag or a digest.
+func validateOCIImageName(name string) error {
+	switch {
+	case strings.HasSuffix(name, ":"):
+		return fmt.Errorf("%q is not a valid OCI image reference: the tag is empty", name)
+	case strings.HasSuffix(name, "@"):
+		return fmt.Errorf("%q is not a valid OCI image reference: the digest is empty", name)
+	}
+
+	named, err := reference.ParseNamed(name)
+	if err != nil {
+		if errors.Is(err, reference.ErrNameNotCanonical) {
+			if normalized, err := reference.ParseNormalizedNamed(name); err == nil {
+				return fmt.Errorf("%q is not a fully qualified OCI image reference, use %q", name, normalized.String())
+			}
+		}
+		return fmt.Errorf("%q is not a valid OCI image reference: %w", name, err)
+	}
+
+	_, tagged := named.(reference.Tagged)
+	_, digested := named.(reference.Digested)
+	if !tagged && !digested {
+		return fmt.Errorf("%q is not a valid OCI image reference: a tag or a digest is required, e.g. %q", name, name+":latest")
+	}
+	return nil
+}
+
+// pinnedImageReference returns the immutable `repository@digest` reference of a pushed image.
+func pinnedImageReference(name, digest string) (string, error) {
+	named, err := reference.ParseNamed(name)
+	if err != nil {
+		return "", err
+	}
+	pinned, err := reference.ParseNamed(reference.TrimNamed(named).String() + "@" + digest)
+	if err != nil {
+		return "", err
+	}
+	return pinned.String(), nil
+}
@@ -0,0 +1,132 @@
+package orka
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImageSaveModeFor(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"sonoma-base", ImageSaveModeNFS},
+		{"sonoma.base-1", ImageSaveModeNFS},
+		{"ghcr.io/org/sonoma:latest", ImageSaveModeOCI},
+		{"registry.local:5000/sonoma", ImageSaveModeOCI},
+		{"ghcr.io/org/sonoma@sha256:0123", ImageSaveModeOCI},
+		{"org/sonoma", ImageSaveModeOCI},
+	}
+	for _, tt := range tests {
+		if got := imageSaveModeFor(tt.name); got != tt.want {
+			t.Errorf("imageSaveModeFor(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateNFSImageName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"sonoma-base", false},
+		{"sonoma.base-1", false},
+		{"Sonoma", true},
+		{"sonoma_base", true},
+		{"-sonoma", true},
+		{"", true},
+		{strings.Repeat("a", 254), true},
+	}
+	for _, tt := range tests {
+		if err := validateNFSImageName(tt.name); (err != nil) != tt.wantErr {
+			t.Errorf("validateNFSImageName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateOCIImageName(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	tests := []struct {
+		name    string
+		wantErr string
+	}{
+		{"ghcr.io/org/sonoma:latest", ""},
+		{"registry.local:5000/sonoma:14.4", ""},
+		{"ghcr.io/org/sonoma@" + digest, ""},
+		{"ghcr.io/org/sonoma:latest@" + digest, ""},
+		{"ghcr.io/org/sonoma:", "the tag is empty"},
+		{"ghcr.io/org/sonoma@", "the digest is empty"},
+		{"ghcr.io/org/sonoma", "a tag or a digest is required"},
+		{"org/sonoma:latest", `use "docker.io/org/sonoma:latest"`},
+		{"ghcr.io/Org/sonoma:latest", "is not a valid OCI image reference"},
+	}
+	for _, tt := range tests {
+		err := validateOCIImageName(tt.name)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("validateOCIImageName(%q) unexpected error: %s", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("validateOCIImageName(%q) error = %v, want it to contain %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckImageCommitAllowed(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowlist []string
+		wantErr   string
+	}{
+		{"sonoma-ci", []string{"sonoma-ci"}, ""},
+		{"sonoma-ci", []string{"ventura-*", "sonoma-*"}, ""},
+		{"sonoma-ci", nil, "is protected from commits"},
+		{"sonoma-ci", []string{"ventura-*"}, "is protected from commits"},
+		{"sonoma-ci", []string{"sonoma-[ci"}, "invalid pattern"},
+		{"ghcr.io/org/sonoma:latest", []string{"*"}, "source_image:"},
+	}
+	for _, tt := range tests {
+		err := checkImageCommitAllowed(tt.name, tt.allowlist)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkImageCommitAllowed(%q, %q) unexpected error: %s", tt.name, tt.allowlist, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("checkImageCommitAllowed(%q, %q) error = %v, want it to contain %q", tt.name, tt.allowlist, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPinnedImageReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"ghcr.io/org/sonoma:latest", "ghcr.io/org/sonoma@" + digest, false},
+		{"registry.local:5000/sonoma:14.4", "registry.local:5000/sonoma@" + digest, false},
+		{"ghcr.io/org/sonoma@sha256:" + strings.Repeat("b", 64), "ghcr.io/org/sonoma@" + digest, false},
+		{"sonoma-base", "", true},
+	}
+	for _, tt := range tests {
+		got, err := pinnedImageReference(tt.name, digest)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("pinnedImageReference(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("pinnedImageReference(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := pinnedImageReference("ghcr.io/org/sonoma:latest", "sha256:short"); err == nil {
+		t.Errorf("pinnedImageReference() with an invalid digest did not fail")
+	}
+}
@@ -0,0 +1,464 @@
+package orka
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	DefaultMetricsJob = "packer_orka"
+
+	metricsPrefix       = "packer_orka_"
+	metricsContentType  = "text/plain; version=0.0.4"
+	metricsWriteTimeout = 30 * time.Second
+	metricsLockInterval = 100 * time.Millisecond
+
+	metricTypeCounter   = "counter"
+	metricTypeGauge     = "gauge"
+	metricTypeHistogram = "histogram"
+)
+
+// Buckets in seconds of the duration histograms, from a quick SSH connection to a long image push.
+var metricsDurationBuckets = []float64{5, 15, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200}
+
+var metricsLabelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Labels the builder sets on series.
+var builderMetricsLabels = []string{"le", "outcome", "error_class", "mode"}
+
+// Labels set by the builder, which `metrics_labels` cannot use. `job` and `build_id` are labels of the
+// pushgateway group.
+var reservedMetricsLabels = append([]string{"job", "build_id"}, builderMetricsLabels...)
+
+// metricFamily is a metric in the Prometheus text format. Histograms hold their _bucket, _sum and
+// _count series.
+type metricFamily struct {
+	name   string
+	typ    string
+	help   string
+	series map[string]float64
+}
+
+// metricSet holds the metrics of a build. Merged with the metrics file, counters and histograms
+// accumulate the values written by earlier builds, so each build adds to them instead of replacing them.
+type metricSet struct {
+	labels   map[string]string
+	families []*metricFamily
+	byName   map[string]*metricFamily
+}
+
+func newMetricSet(labels map[string]string) *metricSet {
+	return &metricSet{labels: labels, byName: map[string]*metricFamily{}}
+}
+
+func (m *metricSet) family(name, typ, help string) *metricFamily {
+	f, ok := m.byName[name]
+	if !ok {
+		f = &metricFamily{name: name, typ: typ, help: help, series: map[string]float64{}}
+		m.families = append(m.families, f)
+		m.byName[name] = f
+	}
+	return f
+}
+
+// seriesKey returns the series of a metric with the labels of the set and the given labels.
+func (m *metricSet) seriesKey(name string, labels map[string]string) string {
+	all := map[string]string{}
+	for k, v := range m.labels {
+		all[k] = v
+	}
+	for k, v := range labels {
+		all[k] = v
+	}
+	return name + formatMetricLabels(all)
+}
+
+func (m *metricSet) add(name, help string, labels map[string]string, value float64) {
+	m.family(name, metricTypeCounter, help).series[m.seriesKey(name, labels)] += value
+}
+
+func (m *metricSet) set(name, help string, labels map[string]string, value float64) {
+	m.family(name, metricTypeGauge, help).series[m.seriesKey(name, labels)] = value
+}
+
+func (m *metricSet) observe(name, help string, labels map[string]string, value float64) {
+	f := m.family(name, metricTypeHistogram, help)
+	buckets := append(append([]float64{}, metricsDurationBuckets...), math.Inf(1))
+	for _, bucket := range buckets {
+		bucketLabels := map[string]string{"le": formatMetricValue(bucket)}
+		for k, v := range labels {
+			bucketLabels[k] = v
+		}
+		count := 0.0
+		if value <= bucket {
+			count = 1
+		}
+		f.series[m.seriesKey(name+"_bucket", bucketLabels)] += count
+	}
+	f.series[m.seriesKey(name+"_sum", labels)] += value
+	f.series[m.seriesKey(name+"_count", labels)]++
+}
+
+// merge adds the series written by earlier builds. Gauges keep the value of this build if it set them.
+func (m *metricSet) merge(previous map[string]float64) {
+	for key, value := range previous {
+		name := key
+		if i := strings.IndexByte(key, '{'); i >= 0 {
+			name = key[:i]
+		}
+
+		f := m.byName[name]
+		if f == nil {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if h := m.byName[strings.TrimSuffix(name, suffix)]; h != nil && h.typ == metricTypeHistogram {
+					f = h
+				}
+			}
+		}
+		if f == nil {
+			continue
+		}
+
+		if f.typ == metricTypeGauge {
+			if _, ok := f.series[key]; !ok {
+				f.series[key] = value
+			}
+		} else {
+			f.series[key] += value
+		}
+	}
+}
+
+// write writes the metrics in the Prometheus text format.
+func (m *metricSet) write(w io.Writer) error {
+	var b bytes.Buffer
+	for _, f := range m.families {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&b, "%s %s\n", key, formatMetricValue(f.series[key]))
+		}
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// parseMetrics reads the series of the Prometheus text format.
+func parseMetrics(r io.Reader) (map[string]float64, error) {
+	series := map[string]float64{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, labels, rest, err := parseMetricLine(line)
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("missing value of metric %s", name)
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value of metric %s: %w", name, err)
+		}
+		series[name+formatMetricLabels(labels)] = value
+	}
+	return series, scanner.Err()
+}
+
+// parseMetricLine splits a series line into the metric name, its labels and the rest of the line.
+func parseMetricLine(line string) (string, map[string]string, string, error) {
+	labels := map[string]string{}
+
+	end := strings.IndexAny(line, "{ \t")
+	if end < 0 {
+		return "", nil, "", fmt.Errorf("invalid metric line %q", line)
+	}
+	name, rest := line[:end], line[end:]
+	if rest[0] != '{' {
+		return name, labels, rest, nil
+	}
+
+	rest = rest[1:]
+	for {
+		rest = strings.TrimLeft(rest, " ,")
+		if strings.HasPrefix(rest, "}") {
+			return name, labels, rest[1:], nil
+		}
+
+		eq := strings.Index(rest, "=\"")
+		if eq < 0 {
+			return "", nil, "", fmt.Errorf("invalid labels of metric %s", name)
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = rest[eq+2:]
+
+		var value strings.Builder
+		closed := false
+		for i := 0; i < len(rest); i++ {
+			c := rest[i]
+			if c == '\\' && i+1 < len(rest) {
+				i++
+				switch rest[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(rest[i])
+				}
+				continue
+			}
+			if c == '"' {
+				rest = rest[i+1:]
+				closed = true
+				break
+			}
+			value.WriteByte(c)
+		}
+		if !closed {
+			return "", nil, "", fmt.Errorf("invalid labels of metric %s", name)
+		}
+		labels[key] = value.String()
+	}
+}
+
+func formatMetricLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, k, escaper.Replace(labels[k])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// buildMetrics returns the metrics of the finished build, with the given labels on every series.
+func buildMetrics(ctx context.Context, state multistep.StateBag, config *Config, labels map[string]string) *metricSet {
+	buildEvents := events(state)
+	m := newMetricSet(labels)
+
+	outcome, errorClass := "succeeded", "none"
+	if _, ok := state.GetOk("error"); ok {
+		outcome, errorClass = "failed", buildErrorClass(buildEvents)
+	} else if _, ok := state.GetOk(multistep.StateCancelled); ok {
+		outcome = "cancelled"
+	}
+
+	m.add(metricsPrefix+"builds_total", "Builds by outcome and by the phase failed builds failed in.",
+		map[string]string{"outcome": outcome, "error_class": errorClass}, 1)
+	m.set(metricsPrefix+"last_build_timestamp_seconds", "Time the last build with the outcome ended.",
+		map[string]string{"outcome": outcome}, float64(time.Now().Unix()))
+	if buildEvents != nil {
+		m.observe(metricsPrefix+"build_duration_seconds", "Duration of builds.",
+			map[string]string{"outcome": outcome}, time.Since(buildEvents.start).Seconds())
+	}
+
+	if d, ok := buildEvents.between(EventVmCreate, EventVmScheduled); ok {
+		m.observe(metricsPrefix+"vm_scheduling_seconds", "Time from deploying the builder VM to its scheduling on a node.", nil, d.Seconds())
+	} else if d, ok := buildEvents.between(EventVmCreate, EventVmRunning); ok {
+		// The VM was running by the time its progress was first checked.
+		m.observe(metricsPrefix+"vm_scheduling_seconds", "Time from deploying the builder VM to its scheduling on a node.", nil, d.Seconds())
+	}
+	if d, ok := buildEvents.between(EventVmRunning, EventSSHConnected); ok {
+		m.observe(metricsPrefix+"ssh_ready_seconds", "Time from the builder VM running to the SSH connection.", nil, d.Seconds())
+	}
+	if d, ok := buildEvents.between(EventSSHConnected, EventSyncStart); ok {
+		m.observe(metricsPrefix+"provision_seconds", "Time spent running the provisioners.", nil, d.Seconds())
+	} else if d, ok := buildEvents.between(EventSSHConnected, EventSaveStart); ok {
+		m.observe(metricsPrefix+"provision_seconds", "Time spent running the provisioners.", nil, d.Seconds())
+	}
+	if d, ok := buildEvents.between(EventSaveStart, EventImageReady); ok {
+		m.observe(metricsPrefix+"image_save_seconds", "Time spent saving, committing or pushing the image.",
+			map[string]string{"mode": config.ImageSaveMode}, d.Seconds())
+	}
+
+	if outcome == "succeeded" && config.ImageSaveMode != ImageSaveModeOCI && !config.NoCreateImage {
+		if orkaClient, ok := state.GetOk(StateOrkaClient); ok {
+			image := &orkav1.Image{}
+			key := client.ObjectKey{Namespace: DefaultOrkaNamespace, Name: config.ImageName}
+			if err := orkaClient.(OrkaClient).Get(ctx, key, image); err == nil && !image.Spec.Size.IsZero() {
+				m.set(metricsPrefix+"image_size_bytes", "Size of the image saved by the last build.",
+					nil, float64(image.Spec.Size.Value()))
+			}
+		}
+	}
+
+	return m
+}
+
+// buildErrorClass returns the phase a failed build failed in, from the last phase it reached.
+func buildErrorClass(buildEvents *eventLog) string {
+	switch {
+	case !buildEvents.happened(EventVmCreate):
+		return "setup"
+	case !buildEvents.happened(EventVmRunning):
+		return "vm_deploy"
+	case !buildEvents.happened(EventSSHConnected):
+		return "ssh"
+	case !buildEvents.happened(EventSaveStart):
+		return "provision"
+	case !buildEvents.happened(EventImageReady):
+		return "image_save"
+	default:
+		return "post_save"
+	}
+}
+
+// writeMetricsTextfile adds the metrics of the build to the file read by the node exporter textfile
+// collector. The file is replaced at once, so the collector never reads a partial file, and builds
+// take turns reading and replacing it through a lock file next to it.
+func writeMetricsTextfile(ctx context.Context, state multistep.StateBag, config *Config) error {
+	m := buildMetrics(ctx, state, config, config.MetricsLabels)
+
+	unlock, err := lockMetricsTextfile(ctx, config.MetricsTextfile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if f, err := os.Open(config.MetricsTextfile); err == nil {
+		previous, err := parseMetrics(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read metrics file: %w", err)
+		}
+		m.merge(previous)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read metrics file: %w", err)
+	}
+
+	tmp := fmt.Sprintf("%s.%d.tmp", config.MetricsTextfile, os.Getpid())
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	err = m.write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, config.MetricsTextfile)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
+
+// lockMetricsTextfile creates the lock file of the metrics file, waiting until the context is done
+// for the build holding it to remove it. The returned function removes the lock file.
+func lockMetricsTextfile(ctx context.Context, path string) (func(), error) {
+	lock := path + ".lock"
+	for {
+		f, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock metrics file: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("metrics file is locked by %s, delete it if no build is writing the file: %w", lock, ctx.Err())
+		case <-time.After(metricsLockInterval):
+		}
+	}
+}
+
+// pushMetrics pushes the metrics of the build to a group of the pushgateway of its own, identified by
+// `metrics_job`, `metrics_labels` and the build ID. Builds never replace each other's group, so builds
+// ending at the same time lose no metrics, and the series of all builds are summed over `build_id`.
+func pushMetrics(ctx context.Context, state multistep.StateBag, config *Config) error {
+	m := buildMetrics(ctx, state, config, nil)
+
+	group := map[string]string{"build_id": config.OrkaVMBuilderBuildID}
+	for k, v := range config.MetricsLabels {
+		group[k] = v
+	}
+
+	var body bytes.Buffer
+	if err := m.write(&body); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, metricsGroupURL(config.MetricsPushgatewayURL, config.MetricsJob, group), &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", metricsContentType)
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		return fmt.Errorf("pushing metrics failed with status code %d: %s", response.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// metricsGroupURL returns the pushgateway URL of a group. Label values are base64 encoded, so they
+// may contain slashes.
+func metricsGroupURL(pushgatewayURL, job string, labels map[string]string) string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(pushgatewayURL, "/"))
+	fmt.Fprintf(&b, "/metrics/job@base64/%s", base64.RawURLEncoding.EncodeToString([]byte(job)))
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "/%s@base64/%s", k, base64.RawURLEncoding.EncodeToString([]byte(labels[k])))
+	}
+	return b.String()
+}
@@ -0,0 +1,262 @@
+package orka
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+)
+
+func TestParseMetricLine(t *testing.T) {
+	tests := []struct {
+		line       string
+		wantName   string
+		wantLabels map[string]string
+		wantRest   string
+		wantErr    bool
+	}{
+		{
+			line:       "packer_orka_builds_total 3",
+			wantName:   "packer_orka_builds_total",
+			wantLabels: map[string]string{},
+			wantRest:   " 3",
+		},
+		{
+			line:       `packer_orka_builds_total{error_class="none",outcome="succeeded"} 3`,
+			wantName:   "packer_orka_builds_total",
+			wantLabels: map[string]string{"error_class": "none", "outcome": "succeeded"},
+			wantRest:   " 3",
+		},
+		{
+			line:       `packer_orka_image_save_seconds_bucket{ le="+Inf" , mode="nfs",} 1 1700000000000`,
+			wantName:   "packer_orka_image_save_seconds_bucket",
+			wantLabels: map[string]string{"le": "+Inf", "mode": "nfs"},
+			wantRest:   " 1 1700000000000",
+		},
+		{
+			line:       `packer_orka_builds_total{template="a \"quoted\", escaped\\ and\nnew line"} 1`,
+			wantName:   "packer_orka_builds_total",
+			wantLabels: map[string]string{"template": "a \"quoted\", escaped\\ and\nnew line"},
+			wantRest:   " 1",
+		},
+		{
+			line:       `packer_orka_builds_total{template="a}b"} 1`,
+			wantName:   "packer_orka_builds_total",
+			wantLabels: map[string]string{"template": "a}b"},
+			wantRest:   " 1",
+		},
+		{line: "packer_orka_builds_total", wantErr: true},
+		{line: `packer_orka_builds_total{outcome} 1`, wantErr: true},
+		{line: `packer_orka_builds_total{outcome="succeeded} 1`, wantErr: true},
+	}
+	for _, tt := range tests {
+		name, labels, rest, err := parseMetricLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseMetricLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if name != tt.wantName || !reflect.DeepEqual(labels, tt.wantLabels) || rest != tt.wantRest {
+			t.Errorf("parseMetricLine(%q) = %q, %v, %q, want %q, %v, %q", tt.line, name, labels, rest, tt.wantName, tt.wantLabels, tt.wantRest)
+		}
+	}
+}
+
+func TestFormatMetricLabels(t *testing.T) {
+	tests := []struct {
+		labels map[string]string
+		want   string
+	}{
+		{nil, ""},
+		{map[string]string{}, ""},
+		{map[string]string{"outcome": "succeeded"}, `{outcome="succeeded"}`},
+		{map[string]string{"outcome": "failed", "error_class": "ssh"}, `{error_class="ssh",outcome="failed"}`},
+		{map[string]string{"template": "a \"b\"\\c\nd"}, `{template="a \"b\"\\c\nd"}`},
+	}
+	for _, tt := range tests {
+		if got := formatMetricLabels(tt.labels); got != tt.want {
+			t.Errorf("formatMetricLabels(%v) = %q, want %q", tt.labels, got, tt.want)
+		}
+	}
+}
+
+func TestFormatMetricLabelsRoundTrip(t *testing.T) {
+	labels := map[string]string{"template": "a \"b\", {c}\\d\ne", "outcome": "succeeded"}
+
+	_, got, _, err := parseMetricLine("m" + formatMetricLabels(labels) + " 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, labels) {
+		t.Errorf("labels = %v, want %v", got, labels)
+	}
+}
+
+func TestParseMetrics(t *testing.T) {
+	const written = `# HELP packer_orka_builds_total Builds by outcome.
+# TYPE packer_orka_builds_total counter
+packer_orka_builds_total{error_class="none",outcome="succeeded",template="sonoma"} 5
+packer_orka_builds_total{error_class="ssh",outcome="failed",template="sonoma"} 1
+
+packer_orka_image_size_bytes{template="sonoma"} 100 1700000000000
+`
+
+	got, err := parseMetrics(strings.NewReader(written))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		`packer_orka_builds_total{error_class="none",outcome="succeeded",template="sonoma"}`: 5,
+		`packer_orka_builds_total{error_class="ssh",outcome="failed",template="sonoma"}`:     1,
+		`packer_orka_image_size_bytes{template="sonoma"}`:                                    100,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMetrics() = %v, want %v", got, want)
+	}
+
+	if _, err := parseMetrics(strings.NewReader("packer_orka_builds_total\n")); err == nil {
+		t.Error("parseMetrics() accepted a series without a value")
+	}
+}
+
+func TestWriteMetricsTextfile(t *testing.T) {
+	const builds = 5
+	config := &Config{
+		MetricsTextfile: filepath.Join(t.TempDir(), "packer.prom"),
+		MetricsLabels:   map[string]string{"template": "sonoma"},
+		ImageSaveMode:   ImageSaveModeNFS,
+	}
+
+	// Builds ending at the same time take turns, so none of them is lost.
+	errs := make(chan error, builds)
+	for i := 0; i < builds; i++ {
+		go func() {
+			errs <- writeMetricsTextfile(context.Background(), &multistep.BasicStateBag{}, config)
+		}()
+	}
+	for i := 0; i < builds; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(config.MetricsTextfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	series, err := parseMetrics(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := `packer_orka_builds_total{error_class="none",outcome="succeeded",template="sonoma"}`
+	if got := series[key]; got != builds {
+		t.Errorf("%s = %v, want %d", key, got, builds)
+	}
+	if _, err := os.Stat(config.MetricsTextfile + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock file was not removed: %v", err)
+	}
+}
+
+func TestWriteMetricsTextfileLocked(t *testing.T) {
+	config := &Config{MetricsTextfile: filepath.Join(t.TempDir(), "packer.prom")}
+	if err := os.WriteFile(config.MetricsTextfile+".lock", nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*metricsLockInterval)
+	defer cancel()
+	err := writeMetricsTextfile(ctx, &multistep.BasicStateBag{}, config)
+	if err == nil || !strings.Contains(err.Error(), "is locked by") {
+		t.Fatalf("error = %v, want the metrics file to be locked", err)
+	}
+	if _, err := os.Stat(config.MetricsTextfile); !os.IsNotExist(err) {
+		t.Errorf("metrics file was written while locked: %v", err)
+	}
+}
+
+func TestPushMetrics(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	wantPath := "/metrics/job@base64/" + encode("packer_orka") + "/build_id@base64/" + encode("build-a") + "/template@base64/" + encode("sonoma")
+
+	var requests []string
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+
+	config := &Config{
+		OrkaVMBuilderBuildID:  "build-a",
+		MetricsPushgatewayURL: server.URL + "/",
+		MetricsJob:            DefaultMetricsJob,
+		MetricsLabels:         map[string]string{"template": "sonoma"},
+		ImageSaveMode:         ImageSaveModeNFS,
+	}
+	if err := pushMetrics(context.Background(), &multistep.BasicStateBag{}, config); err != nil {
+		t.Fatal(err)
+	}
+
+	// The metrics of the build replace only its own group, without reading the others.
+	if want := []string{"PUT " + wantPath}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+	if want := `packer_orka_builds_total{error_class="none",outcome="succeeded"} 1`; !strings.Contains(body, want) {
+		t.Errorf("pushed metrics %q do not contain %q", body, want)
+	}
+}
+
+func TestMetricSetMerge(t *testing.T) {
+	m := newMetricSet(nil)
+	m.add("packer_orka_builds_total", "Builds.", map[string]string{"outcome": "succeeded"}, 1)
+	m.set("packer_orka_last_build_timestamp_seconds", "Last build.", map[string]string{"outcome": "succeeded"}, 200)
+	m.observe("packer_orka_build_duration_seconds", "Durations.", nil, 10)
+
+	m.merge(map[string]float64{
+		`packer_orka_builds_total{outcome="succeeded"}`:                 2,
+		`packer_orka_builds_total{outcome="failed"}`:                    1,
+		`packer_orka_last_build_timestamp_seconds{outcome="succeeded"}`: 100,
+		`packer_orka_last_build_timestamp_seconds{outcome="failed"}`:    50,
+		`packer_orka_build_duration_seconds_bucket{le="15"}`:            1,
+		`packer_orka_build_duration_seconds_sum`:                        5,
+		`packer_orka_build_duration_seconds_count`:                      1,
+		`packer_orka_unknown_total`:                                     4,
+	})
+
+	tests := []struct {
+		family string
+		series string
+		want   float64
+	}{
+		// Counters and histograms add the earlier builds.
+		{"packer_orka_builds_total", `packer_orka_builds_total{outcome="succeeded"}`, 3},
+		{"packer_orka_builds_total", `packer_orka_builds_total{outcome="failed"}`, 1},
+		{"packer_orka_build_duration_seconds", `packer_orka_build_duration_seconds_bucket{le="15"}`, 2},
+		{"packer_orka_build_duration_seconds", `packer_orka_build_duration_seconds_bucket{le="5"}`, 0},
+		{"packer_orka_build_duration_seconds", `packer_orka_build_duration_seconds_sum`, 15},
+		{"packer_orka_build_duration_seconds", `packer_orka_build_duration_seconds_count`, 2},
+		// Gauges keep the value of this build.
+		{"packer_orka_last_build_timestamp_seconds", `packer_orka_last_build_timestamp_seconds{outcome="succeeded"}`, 200},
+		{"packer_orka_last_build_timestamp_seconds", `packer_orka_last_build_timestamp_seconds{outcome="failed"}`, 50},
+	}
+	for _, tt := range tests {
+		if got := m.byName[tt.family].series[tt.series]; got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.series, got, tt.want)
+		}
+	}
+	if _, ok := m.byName["packer_orka_unknown_total"]; ok {
+		t.Errorf("series of unknown metrics are merged")
+	}
+}
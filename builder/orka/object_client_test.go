@@ -0,0 +1,56 @@
+package orka
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/macstadium/packer-plugin-macstadium-orka/mocks"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// objectClient is the mock Orka client that also stores the objects it is given, so the ConfigMaps
+// of the build slots and the Leases of the image locks can be read back. Other calls go to the mock.
+type objectClient struct {
+	mocks.OrkaClient
+
+	objects map[string]client.Object
+}
+
+func newObjectClient() *objectClient {
+	return &objectClient{objects: map[string]client.Object{}}
+}
+
+func objectKey(obj client.Object, key client.ObjectKey) string {
+	return fmt.Sprintf("%T/%s", obj, key)
+}
+
+func (c *objectClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	stored, ok := c.objects[objectKey(obj, key)]
+	if !ok {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: fmt.Sprintf("%T", obj)}, key.Name)
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(stored.DeepCopyObject()).Elem())
+	return nil
+}
+
+func (c *objectClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	key := objectKey(obj, client.ObjectKeyFromObject(obj))
+	if _, ok := c.objects[key]; ok {
+		return apierrors.NewAlreadyExists(schema.GroupResource{Resource: fmt.Sprintf("%T", obj)}, obj.GetName())
+	}
+	c.objects[key] = obj.DeepCopyObject().(client.Object)
+	return nil
+}
+
+func (c *objectClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.objects[objectKey(obj, client.ObjectKeyFromObject(obj))] = obj.DeepCopyObject().(client.Object)
+	return nil
+}
+
+func (c *objectClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	delete(c.objects, objectKey(obj, client.ObjectKeyFromObject(obj)))
+	return nil
+}
@@ -0,0 +1,101 @@
+package orka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrUnsupportedOrkaAPI is returned for requests to endpoints the Orka API of the cluster does not
+// provide. Image caching on nodes, and image file downloads and uploads, use endpoints that older Orka
+// versions do not have.
+var ErrUnsupportedOrkaAPI = errors.New("the Orka API of the cluster does not provide this endpoint")
+
+// UnsupportedOrkaAPIError returns an ErrUnsupportedOrkaAPI error if the failed response means the Orka
+// API has no such endpoint, or nil. Unknown endpoints are rejected with a status code but without the
+// Kubernetes status the Orka API describes its errors with, such as a missing object, in the body.
+func UnsupportedOrkaAPIError(method, path string, statusCode int, body []byte) error {
+	switch statusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+	default:
+		return nil
+	}
+	var status metav1.Status
+	if err := json.Unmarshal(body, &status); err == nil && status.Message != "" {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s failed with status code %d", ErrUnsupportedOrkaAPI, method, path, statusCode)
+}
+
+// doOrkaAPIRequest sends a request to the Orka API, with in marshaled as its JSON body if not nil,
+// and unmarshals the JSON response into out if not nil. The request is recorded as a child span of
+// the span in ctx.
+func doOrkaAPIRequest(ctx context.Context, config *Config, method, path string, in, out interface{}) (err error) {
+	ctx, sp := startSpan(ctx, "orka.API "+method, trace.SpanKindClient,
+		attribute.String("http.method", method),
+		attribute.String("orka.api_path", path),
+	)
+	defer func() {
+		endSpan(sp, err)
+	}()
+
+	endpoint, err := url.JoinPath(config.OrkaEndpoint, path)
+	if err != nil {
+		return fmt.Errorf("failed to generate Orka API endpoint: %w", err)
+	}
+
+	var body io.Reader
+	if in != nil {
+		reqJSON, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		body = bytes.NewBuffer(reqJSON)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.OrkaAuthToken))
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer response.Body.Close()
+	sp.SetAttributes(attribute.Int("http.status_code", response.StatusCode))
+
+	respBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		if err := UnsupportedOrkaAPIError(method, path, response.StatusCode, respBody); err != nil {
+			return err
+		}
+		var status metav1.Status
+		if err := json.Unmarshal(respBody, &status); err == nil && status.Message != "" {
+			return fmt.Errorf("request failed with status code %d: %s", response.StatusCode, status.Message)
+		}
+		return fmt.Errorf("request failed with status code %d: %s", response.StatusCode, respBody)
+	}
+
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+	}
+	return nil
+}
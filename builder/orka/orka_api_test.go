@@ -0,0 +1,56 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDoOrkaAPIRequest(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		wantErr         string
+		wantUnsupported bool
+	}{
+		{name: "success", status: http.StatusOK, body: `{"name":"sonoma"}`},
+		{name: "unknown endpoint", status: http.StatusNotFound, body: "404 page not found", wantErr: "does not provide this endpoint", wantUnsupported: true},
+		{name: "unknown method", status: http.StatusMethodNotAllowed, wantErr: "does not provide this endpoint", wantUnsupported: true},
+		{name: "missing object", status: http.StatusNotFound, body: `{"kind":"Status","message":"nodes \"mini-9\" not found","code":404}`, wantErr: `nodes "mini-9" not found`},
+		{name: "server error", status: http.StatusInternalServerError, body: "internal error", wantErr: "status code 500: internal error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAuth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAuth = r.Header.Get("Authorization")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			config := &Config{OrkaEndpoint: server.URL, OrkaAuthToken: "token"}
+			var out struct {
+				Name string `json:"name"`
+			}
+			err := doOrkaAPIRequest(context.Background(), config, http.MethodPost, "/api/v1/namespaces/orka-default/nodes/mini-1/images", struct{}{}, &out)
+			if tt.wantErr == "" {
+				if err != nil || out.Name != "sonoma" {
+					t.Fatalf("doOrkaAPIRequest() = %v, out %+v", err, out)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if got := errors.Is(err, ErrUnsupportedOrkaAPI); got != tt.wantUnsupported {
+				t.Errorf("unsupported = %v, want %v", got, tt.wantUnsupported)
+			}
+			if gotAuth != "Bearer token" {
+				t.Errorf("Authorization = %q, want the token", gotAuth)
+			}
+		})
+	}
+}
@@ -13,8 +13,10 @@ import (
 	"time"
 
 	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	"github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/models"
 
 	batchv1 "k8s.io/api/batch/v1"
+	coordinationv1 "k8s.io/api/coordination/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/watch"
@@ -32,15 +34,19 @@ const (
 
 type OrkaClient interface {
 	Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error
+	List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error
 	Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error
 	Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error
-	WaitForVm(ctx context.Context, namespace, name string, timeout int) (string, int, error)
-	WaitForImage(ctx context.Context, name string) error
+	Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error
+	WaitForVm(ctx context.Context, namespace, name string, timeout int) (models.OrkaVMInfoModel, error)
+	WaitForImage(ctx context.Context, name string, timeout int) error
 	WaitForPush(ctx context.Context, namespace, name string, timeout int) error
 }
 
 type RealOrkaClient struct {
 	client.WithWatch
+
+	waitStrategy WaitStrategy
 }
 
 // GetOrkaClient returns a runtime client with the on-disk discovery cache enabled
@@ -52,6 +58,9 @@ func GetOrkaClient(orkaEndpoint, authToken string, config *Config) (*RealOrkaCli
 	if err := corev1.AddToScheme(sch); err != nil {
 		log.Fatal("failed to add corev1 to scheme")
 	}
+	if err := coordinationv1.AddToScheme(sch); err != nil {
+		log.Fatal("failed to add coordinationv1 to scheme")
+	}
 
 	endpoint, err := url.JoinPath(orkaEndpoint, "api", "v1", "cluster-info")
 	if err != nil {
@@ -99,7 +108,14 @@ func GetOrkaClient(orkaEndpoint, authToken string, config *Config) (*RealOrkaCli
 		return nil, err
 	}
 
-	return &RealOrkaClient{c}, nil
+	return &RealOrkaClient{
+		WithWatch: c,
+		waitStrategy: WaitStrategy{
+			Mode:             config.OrkaWaitStrategy,
+			PollInterval:     time.Duration(config.OrkaWaitPollInterval) * time.Second,
+			MaxWatchFailures: config.OrkaWaitWatchFailures,
+		},
+	}, nil
 }
 
 func lookupIP(orkaEndpoint string) net.IP {
@@ -114,130 +130,181 @@ func lookupIP(orkaEndpoint string) net.IP {
 	return ips[0]
 }
 
-func (c *RealOrkaClient) WaitForVm(ctx context.Context, namespace, name string, timeout int) (string, int, error) {
-	var host string
-	var port int
-	err := RetryOnWatcherErrorWithTimeout(ctx, time.Duration(timeout)*time.Minute, func(contextWithTimeout context.Context) error {
+func (c *RealOrkaClient) WaitForVm(ctx context.Context, namespace, name string, timeout int) (models.OrkaVMInfoModel, error) {
+	var info models.OrkaVMInfoModel
+	cursor := &watchCursor{}
+	err := c.wait(ctx, time.Duration(timeout)*time.Minute, func(contextWithTimeout context.Context) error {
 		var err error
-		host, port, err = c.waitForVm(contextWithTimeout, namespace, name, timeout)
+		info, err = c.waitForVm(contextWithTimeout, cursor, namespace, name)
 		return err
-	}, 1*time.Second)
-	return host, port, err
+	}, func(contextWithTimeout context.Context) error {
+		var err error
+		info, err = c.pollForVm(contextWithTimeout, namespace, name)
+		return err
+	})
+	return info, err
 }
 
-func (c *RealOrkaClient) waitForVm(ctx context.Context, namespace, name string, timeout int) (string, int, error) {
-	vmiList := &orkav1.VirtualMachineInstanceList{}
-	watcher, err := c.Watch(ctx, vmiList, client.InNamespace(namespace), client.MatchingFields{"metadata.name": name})
-	if err != nil {
-		return "", 0, err
-	}
-
-	defer watcher.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return "", 0, ctx.Err()
-
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				return "", 0, WatcherError{Err: errors.New(WatcherClosedError)}
-			}
-			vmi := event.Object.(*orkav1.VirtualMachineInstance)
-
-			if vmi.Status.Phase == orkav1.VMRunning {
-				ip := vmi.Status.IP
-				if ip == "" {
-					ip = vmi.Status.HostIP
-				}
-				return ip, *vmi.Status.SSHPort, nil
-			}
+func (c *RealOrkaClient) waitForVm(ctx context.Context, cursor *watchCursor, namespace, name string) (models.OrkaVMInfoModel, error) {
+	var info models.OrkaVMInfoModel
+	err := c.watchUntil(ctx, cursor, &orkav1.VirtualMachineInstanceList{}, func(event watch.Event) (bool, error) {
+		var done bool
+		var err error
+		info, done, err = c.checkVm(ctx, event.Object.(*orkav1.VirtualMachineInstance))
+		return done, err
+	}, client.InNamespace(namespace), client.MatchingFields{"metadata.name": name})
+	return info, err
+}
 
-			if vmi.Status.Phase == orkav1.VMFailed {
-				err := c.Delete(ctx, vmi)
-				return "", 0, errors.Join(fmt.Errorf("%s", vmi.Status.ErrorMessage), err)
-			}
+func (c *RealOrkaClient) pollForVm(ctx context.Context, namespace, name string) (models.OrkaVMInfoModel, error) {
+	var info models.OrkaVMInfoModel
+	err := pollUntil(ctx, c.waitStrategy.PollInterval, func(ctx context.Context) (bool, error) {
+		vmi := &orkav1.VirtualMachineInstance{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, vmi); err != nil {
+			return false, pollError(err)
 		}
-	}
+
+		var done bool
+		var err error
+		info, done, err = c.checkVm(ctx, vmi)
+		return done, err
+	})
+	return info, err
 }
 
-func (c *RealOrkaClient) WaitForImage(ctx context.Context, name string) error {
-	return RetryOnWatcherErrorWithTimeout(ctx, 1*time.Hour, func(contextWithTimeout context.Context) error {
-		return c.waitForImage(contextWithTimeout, name)
-	}, 1*time.Second)
+// checkVm reports whether the VM finished deploying, and if so, its connection details.
+// A VM that failed to deploy is deleted.
+func (c *RealOrkaClient) checkVm(ctx context.Context, vmi *orkav1.VirtualMachineInstance) (models.OrkaVMInfoModel, bool, error) {
+	switch vmi.Status.Phase {
+	case orkav1.VMRunning:
+		return vmInfo(vmi), true, nil
+	case orkav1.VMFailed:
+		err := c.Delete(ctx, vmi)
+		return models.OrkaVMInfoModel{}, true, errors.Join(fmt.Errorf("%s", vmi.Status.ErrorMessage), err)
+	}
+	return models.OrkaVMInfoModel{}, false, nil
 }
 
-func (c *RealOrkaClient) waitForImage(ctx context.Context, name string) error {
-	imageList := &orkav1.ImageList{}
-	watcher, err := c.Watch(ctx, imageList, client.InNamespace(DefaultOrkaNamespace), client.MatchingFields{"metadata.name": name})
-	if err != nil {
-		return err
+// vmInfo returns the connection details from the status of a VM.
+func vmInfo(vmi *orkav1.VirtualMachineInstance) models.OrkaVMInfoModel {
+	info := models.OrkaVMInfoModel{
+		IP:           vmi.Status.IP,
+		HostIP:       vmi.Status.HostIP,
+		NodeName:     vmi.Status.NodeName,
+		Memory:       vmi.Status.Memory,
+		PortWarnings: vmi.Status.PortWarnings,
 	}
-	defer watcher.Stop()
+	if info.IP == "" {
+		info.IP = vmi.Status.HostIP
+	}
+	if vmi.Status.SSHPort != nil {
+		info.SSHPort = *vmi.Status.SSHPort
+	}
+	if vmi.Status.VNCPort != nil {
+		info.VNCPort = *vmi.Status.VNCPort
+	}
+	if vmi.Status.ScreenSharePort != nil {
+		info.ScreenSharePort = *vmi.Status.ScreenSharePort
+	}
+	return info
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
+// WaitForImage waits up to timeout minutes for the image to be ready.
+func (c *RealOrkaClient) WaitForImage(ctx context.Context, name string, timeout int) error {
+	cursor := &watchCursor{}
+	return c.wait(ctx, time.Duration(timeout)*time.Minute, func(contextWithTimeout context.Context) error {
+		return c.waitForImage(contextWithTimeout, cursor, name)
+	}, func(contextWithTimeout context.Context) error {
+		return c.pollForImage(contextWithTimeout, name)
+	})
+}
 
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				return WatcherError{Err: errors.New(WatcherClosedError)}
-			}
-			image := event.Object.(*orkav1.Image)
+func (c *RealOrkaClient) waitForImage(ctx context.Context, cursor *watchCursor, name string) error {
+	return c.watchUntil(ctx, cursor, &orkav1.ImageList{}, func(event watch.Event) (bool, error) {
+		return checkImage(event.Object.(*orkav1.Image))
+	}, client.InNamespace(DefaultOrkaNamespace), client.MatchingFields{"metadata.name": name})
+}
 
-			switch image.Status.State {
-			case orkav1.Ready:
-				return nil
-			case orkav1.Failed:
-				return errors.New(image.Status.ErrorMessage)
-			}
+func (c *RealOrkaClient) pollForImage(ctx context.Context, name string) error {
+	return pollUntil(ctx, c.waitStrategy.PollInterval, func(ctx context.Context) (bool, error) {
+		image := &orkav1.Image{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: DefaultOrkaNamespace, Name: name}, image); err != nil {
+			return false, pollError(err)
 		}
+		return checkImage(image)
+	})
+}
+
+// checkImage reports whether the image operation finished.
+func checkImage(image *orkav1.Image) (bool, error) {
+	switch image.Status.State {
+	case orkav1.Ready:
+		return true, nil
+	case orkav1.Failed:
+		return true, errors.New(image.Status.ErrorMessage)
 	}
+	return false, nil
 }
 
 func (c *RealOrkaClient) WaitForPush(ctx context.Context, namespace, name string, timeout int) error {
-	return RetryOnWatcherErrorWithTimeout(ctx, time.Duration(timeout)*time.Minute, func(contextWithTimeout context.Context) error {
-		return c.waitForPush(contextWithTimeout, namespace, name)
-	}, 1*time.Second)
+	cursor := &watchCursor{}
+	return c.wait(ctx, time.Duration(timeout)*time.Minute, func(contextWithTimeout context.Context) error {
+		return c.waitForPush(contextWithTimeout, cursor, namespace, name)
+	}, func(contextWithTimeout context.Context) error {
+		return c.pollForPush(contextWithTimeout, namespace, name)
+	})
 }
 
-func (c *RealOrkaClient) waitForPush(ctx context.Context, namespace, name string) error {
-	matchLabels := client.MatchingLabels{OrkaJobTypeLabel: OrkaJobTypeRegistryPushValue}
-	if len(name) > 0 {
-		matchLabels[batchv1.JobNameLabel] = name
-	}
-
-	pods := &corev1.PodList{}
-	watcher, err := c.Watch(ctx, pods, client.InNamespace(namespace), matchLabels)
-	if err != nil {
-		return fmt.Errorf("watcher failed to initilize: %s", err)
-	}
-
-	defer watcher.Stop()
+func (c *RealOrkaClient) waitForPush(ctx context.Context, cursor *watchCursor, namespace, name string) error {
+	return c.watchUntil(ctx, cursor, &corev1.PodList{}, func(event watch.Event) (bool, error) {
+		if event.Type == watch.Deleted {
+			return true, errors.New("vm push pod has been deleted")
+		}
+		return checkPushPod(event.Object.(*corev1.Pod))
+	}, client.InNamespace(namespace), pushPodLabels(name))
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
+func (c *RealOrkaClient) pollForPush(ctx context.Context, namespace, name string) error {
+	var seen bool
+	return pollUntil(ctx, c.waitStrategy.PollInterval, func(ctx context.Context) (bool, error) {
+		pods := &corev1.PodList{}
+		if err := c.List(ctx, pods, client.InNamespace(namespace), pushPodLabels(name)); err != nil {
+			return false, pollError(err)
+		}
 
-		case event, ok := <-watcher.ResultChan():
-			if !ok {
-				return WatcherError{Err: errors.New(WatcherClosedError)}
+		if len(pods.Items) == 0 {
+			if seen {
+				return true, errors.New("vm push pod has been deleted")
 			}
+			return false, nil
+		}
+		seen = true
 
-			if event.Type == watch.Deleted {
-				return errors.New("vm push pod has been deleted")
+		for i := range pods.Items {
+			if done, err := checkPushPod(&pods.Items[i]); done {
+				return true, err
 			}
+		}
+		return false, nil
+	})
+}
 
-			p := event.Object.(*corev1.Pod)
+// pushPodLabels selects the pods of the given registry push job, or of all push jobs if name is empty.
+func pushPodLabels(name string) client.MatchingLabels {
+	matchLabels := client.MatchingLabels{OrkaJobTypeLabel: OrkaJobTypeRegistryPushValue}
+	if len(name) > 0 {
+		matchLabels[batchv1.JobNameLabel] = name
+	}
+	return matchLabels
+}
 
-			switch p.Status.Phase {
-			case corev1.PodSucceeded:
-				return nil
-			case corev1.PodFailed:
-				return fmt.Errorf("failed to save image: %s", p.Status.Message)
-			}
-		}
+// checkPushPod reports whether the registry push pod finished.
+func checkPushPod(p *corev1.Pod) (bool, error) {
+	switch p.Status.Phase {
+	case corev1.PodSucceeded:
+		return true, nil
+	case corev1.PodFailed:
+		return true, fmt.Errorf("failed to save image: %s", p.Status.Message)
 	}
+	return false, nil
 }
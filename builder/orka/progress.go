@@ -0,0 +1,38 @@
+package orka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// startElapsedReporter says the message along with the elapsed time every interval until the returned
+// function is called, so long-running operations without progress information do not look stuck.
+func startElapsedReporter(ctx context.Context, ui packer.Ui, interval time.Duration, message string) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	start := time.Now()
+
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				ui.Say(fmt.Sprintf("%s (%s elapsed)", message, time.Since(start).Round(time.Second)))
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
@@ -0,0 +1,294 @@
+package orka
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+)
+
+// manifestMediaTypes are the manifest types accepted when resolving an image reference.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+var errRegistryNotFound = errors.New("not found")
+
+// registryClient is a minimal client for the OCI distribution API of a single repository.
+type registryClient struct {
+	domain     string
+	repository string
+	creds      *RegistryCredentials
+	token      string
+
+	// basicAuth is set for registries authenticating every request with the username and password.
+	basicAuth bool
+}
+
+func newRegistryClient(named reference.Named, creds *RegistryCredentials) *registryClient {
+	return &registryClient{
+		domain:     reference.Domain(named),
+		repository: reference.Path(named),
+		creds:      creds,
+	}
+}
+
+// resolveDigest returns the digest of the manifest the given tag or digest points to.
+func (r *registryClient) resolveDigest(ctx context.Context, tagOrDigest string) (string, error) {
+	header := http.Header{"Accept": {strings.Join(manifestMediaTypes, ", ")}}
+	response, err := r.do(ctx, http.MethodHead, "manifests/"+tagOrDigest, header, nil)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	digest := response.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry [%s] did not return the digest of [%s:%s]", r.domain, r.repository, tagOrDigest)
+	}
+	return digest, nil
+}
+
+// getManifest returns the manifest the given tag or digest points to.
+func (r *registryClient) getManifest(ctx context.Context, tagOrDigest string, mediaType string) ([]byte, error) {
+	response, err := r.do(ctx, http.MethodGet, "manifests/"+tagOrDigest, http.Header{"Accept": {mediaType}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return io.ReadAll(response.Body)
+}
+
+// putManifest uploads a manifest and tags it.
+func (r *registryClient) putManifest(ctx context.Context, tag, mediaType string, manifest []byte) error {
+	header := http.Header{"Content-Type": {mediaType}}
+	response, err := r.do(ctx, http.MethodPut, "manifests/"+tag, header, func() io.Reader { return bytes.NewReader(manifest) })
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+// putBlob uploads a blob in a single request unless the registry already has it, and returns its digest.
+func (r *registryClient) putBlob(ctx context.Context, blob []byte) (string, error) {
+	digest := fmt.Sprintf("sha256:%x", sha256.Sum256(blob))
+
+	if response, err := r.do(ctx, http.MethodHead, "blobs/"+digest, nil, nil); err == nil {
+		response.Body.Close()
+		return digest, nil
+	} else if !errors.Is(err, errRegistryNotFound) {
+		return "", err
+	}
+
+	response, err := r.do(ctx, http.MethodPost, "blobs/uploads/", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	response.Body.Close()
+
+	location := response.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("registry [%s] did not return a blob upload location", r.domain)
+	}
+	upload, err := url.Parse(r.endpoint(location))
+	if err != nil {
+		return "", fmt.Errorf("registry [%s] returned an invalid blob upload location: %w", r.domain, err)
+	}
+	query := upload.Query()
+	query.Set("digest", digest)
+	upload.RawQuery = query.Encode()
+
+	header := http.Header{"Content-Type": {"application/octet-stream"}}
+	response, err = r.do(ctx, http.MethodPut, upload.String(), header, func() io.Reader { return bytes.NewReader(blob) })
+	if err != nil {
+		return "", err
+	}
+	return digest, response.Body.Close()
+}
+
+// do sends a request to the repository, authenticating with the registry when challenged.
+// Non-2xx responses are returned as errors.
+func (r *registryClient) do(ctx context.Context, method, path string, header http.Header, body func() io.Reader) (*http.Response, error) {
+	endpoint := r.endpoint(path)
+
+	send := func() (*http.Response, error) {
+		var reader io.Reader
+		if body != nil {
+			reader = body()
+		}
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create registry request: %w", err)
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		switch {
+		case r.basicAuth:
+			username, password, _ := r.creds.registryAuth(r.domain)
+			req.SetBasicAuth(username, password)
+		case r.token != "":
+			req.Header.Set("Authorization", "Bearer "+r.token)
+		}
+		return http.DefaultClient.Do(req)
+	}
+
+	response, err := send()
+	if err != nil {
+		return nil, fmt.Errorf("failed to send registry request: %w", err)
+	}
+
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		response.Body.Close()
+		if err := r.authenticate(ctx, challenge); err != nil {
+			return nil, err
+		}
+		if response, err = send(); err != nil {
+			return nil, fmt.Errorf("failed to send registry request: %w", err)
+		}
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer response.Body.Close()
+		respBody, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		err := fmt.Errorf("registry request %s %s failed with status code %d: %s", method, endpoint, response.StatusCode, strings.TrimSpace(string(respBody)))
+		if response.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", errRegistryNotFound, err)
+		}
+		return nil, err
+	}
+	return response, nil
+}
+
+// endpoint returns the URL of a path relative to the repository, or of an absolute path or URL as
+// returned in the Location header of upload responses.
+func (r *registryClient) endpoint(path string) string {
+	switch {
+	case strings.HasPrefix(path, "https://"), strings.HasPrefix(path, "http://"):
+		return path
+	case strings.HasPrefix(path, "/"):
+		return fmt.Sprintf("%s://%s%s", r.scheme(), r.registryHost(), path)
+	}
+	return fmt.Sprintf("%s://%s/v2/%s/%s", r.scheme(), r.registryHost(), r.repository, path)
+}
+
+// scheme returns the scheme of the registry API. Like Docker, local registries are accessed over plain HTTP.
+func (r *registryClient) scheme() string {
+	host, _, _ := strings.Cut(r.domain, ":")
+	if host == "localhost" || host == "127.0.0.1" {
+		return "http"
+	}
+	return "https"
+}
+
+// registryHost returns the host serving the registry API, which differs from the image domain for Docker Hub.
+func (r *registryClient) registryHost() string {
+	if r.domain == "docker.io" {
+		return "registry-1.docker.io"
+	}
+	return r.domain
+}
+
+// authenticate gets a bearer token for the repository from the token service named in the challenge.
+func (r *registryClient) authenticate(ctx context.Context, challenge string) error {
+	username, password, token := r.creds.registryAuth(r.domain)
+
+	scheme, params := parseAuthChallenge(challenge)
+	if strings.EqualFold(scheme, "basic") && username != "" && !r.basicAuth {
+		r.basicAuth = true
+		return nil
+	}
+	if !strings.EqualFold(scheme, "bearer") || params["realm"] == "" {
+		// Registries without a token service take a registry token as is.
+		if token == "" {
+			return fmt.Errorf("registry [%s] requires authentication", r.domain)
+		}
+		r.token = token
+		return nil
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil {
+		return fmt.Errorf("registry [%s] returned an invalid token realm: %w", r.domain, err)
+	}
+	query := realm.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull,push", r.repository)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create registry token request: %w", err)
+	}
+	switch {
+	case username != "":
+		req.SetBasicAuth(username, password)
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send registry token request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry [%s] token request failed with status code %d", r.domain, response.StatusCode)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		return fmt.Errorf("failed to unmarshal registry token response: %w", err)
+	}
+
+	r.token = tokenResponse.Token
+	if r.token == "" {
+		r.token = tokenResponse.AccessToken
+	}
+	if r.token == "" {
+		return errors.New("registry token response did not contain a token")
+	}
+	return nil
+}
+
+// parseAuthChallenge parses a WWW-Authenticate header such as
+// `Bearer realm="https://ghcr.io/token",service="ghcr.io",scope="repository:org/img:pull"`.
+func parseAuthChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return scheme, params
+}
@@ -0,0 +1,95 @@
+package orka
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RegistryCredentials are the credentials used to access an OCI registry.
+type RegistryCredentials struct {
+	// The username to authenticate with. Required with `password`.
+	Username string `mapstructure:"username"`
+	// The password to authenticate with.
+	Password string `mapstructure:"password"`
+	// A registry token to authenticate with, instead of a username and password.
+	Token string `mapstructure:"token"`
+	// A complete Docker config JSON, as found in `~/.docker/config.json`, instead of any other credentials.
+	DockerConfigJSON string `mapstructure:"docker_config_json"`
+}
+
+// Validate returns the problems with the credentials. The name is used to refer to them in errors.
+func (r *RegistryCredentials) Validate(name string) []error {
+	var errs []error
+
+	var kinds int
+	if r.Password != "" {
+		kinds++
+	}
+	if r.Token != "" {
+		kinds++
+	}
+	if r.DockerConfigJSON != "" {
+		kinds++
+		if !json.Valid([]byte(r.DockerConfigJSON)) {
+			errs = append(errs, fmt.Errorf("%s: docker_config_json is not valid JSON", name))
+		}
+	}
+
+	if kinds > 1 {
+		errs = append(errs, fmt.Errorf("%s: only one of password, token or docker_config_json can be set", name))
+	}
+	if (r.Username == "") != (r.Password == "") {
+		errs = append(errs, fmt.Errorf("%s: username and password must be set together", name))
+	}
+
+	return errs
+}
+
+// registryAuth returns the username and password, or the token, to authenticate with the given registry domain.
+func (r *RegistryCredentials) registryAuth(domain string) (username, password, token string) {
+	if r == nil {
+		return "", "", ""
+	}
+	if r.DockerConfigJSON == "" {
+		return r.Username, r.Password, r.Token
+	}
+
+	var dockerConfig struct {
+		Auths map[string]struct {
+			Auth          string `json:"auth"`
+			Username      string `json:"username"`
+			Password      string `json:"password"`
+			IdentityToken string `json:"identitytoken"`
+			RegistryToken string `json:"registrytoken"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal([]byte(r.DockerConfigJSON), &dockerConfig); err != nil {
+		return "", "", ""
+	}
+
+	for key, auth := range dockerConfig.Auths {
+		// Keys may be a bare domain or a URL, such as https://index.docker.io/v1/ for Docker Hub.
+		host := strings.TrimPrefix(strings.TrimPrefix(key, "https://"), "http://")
+		host, _, _ = strings.Cut(host, "/")
+		if host != domain && !(domain == "docker.io" && host == "index.docker.io") {
+			continue
+		}
+
+		if auth.Auth != "" {
+			if decoded, err := base64.StdEncoding.DecodeString(auth.Auth); err == nil {
+				username, password, _ = strings.Cut(string(decoded), ":")
+				return username, password, ""
+			}
+		}
+		if auth.Username != "" {
+			return auth.Username, auth.Password, ""
+		}
+		if auth.RegistryToken != "" {
+			return "", "", auth.RegistryToken
+		}
+		return "", "", auth.IdentityToken
+	}
+	return "", "", ""
+}
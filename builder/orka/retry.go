@@ -21,6 +21,20 @@ func (e WatcherError) Unwrap() error {
 	return e.Err
 }
 
+// WatchStartError wraps an error that prevented a watch from being established. Unlike WatcherError
+// it does not trigger a retry in RetryOnWatcherErrorWithTimeout, since it is usually not transient.
+type WatchStartError struct {
+	Err error
+}
+
+func (e WatchStartError) Error() string {
+	return e.Err.Error()
+}
+
+func (e WatchStartError) Unwrap() error {
+	return e.Err
+}
+
 // RetryOnWatcherErrorWithTimeout executes the given function repeatedly until it succeeds or encounters a non-WatcherError,
 // with an overall timeout. It will retry only on WatcherError types, returning immediately for other errors.
 //
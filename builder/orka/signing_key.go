@@ -0,0 +1,107 @@
+package orka
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedSigningKey is the body of an encrypted cosign private key, as generated by `cosign generate-key-pair`.
+type encryptedSigningKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// loadSigningKey reads an ECDSA private key from a PEM file. Encrypted cosign keys are decrypted with
+// the password, unencrypted PKCS #8 and EC private keys are read as is.
+func loadSigningKey(path, password string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing key [%s] is not a PEM file", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "ENCRYPTED SIGSTORE PRIVATE KEY", "ENCRYPTED COSIGN PRIVATE KEY":
+		der, err := decryptSigningKey(block.Bytes, password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt signing key [%s]: %w", path, err)
+		}
+		key, err = x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key [%s]: %w", path, err)
+		}
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key [%s]: %w", path, err)
+		}
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse signing key [%s]: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("signing key [%s] has unsupported PEM type %q", path, block.Type)
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key [%s] is not an ECDSA key", path)
+	}
+	return ecdsaKey, nil
+}
+
+func decryptSigningKey(body []byte, password string) ([]byte, error) {
+	var encrypted encryptedSigningKey
+	if err := json.Unmarshal(body, &encrypted); err != nil {
+		return nil, err
+	}
+	if encrypted.KDF.Name != "scrypt" || encrypted.Cipher.Name != "nacl/secretbox" {
+		return nil, fmt.Errorf("unsupported key encryption %s with %s", encrypted.KDF.Name, encrypted.Cipher.Name)
+	}
+	if len(encrypted.Cipher.Nonce) != 24 {
+		return nil, errors.New("invalid nonce")
+	}
+
+	params := encrypted.KDF.Params
+	derived, err := scrypt.Key([]byte(password), encrypted.KDF.Salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	var secretKey [32]byte
+	copy(nonce[:], encrypted.Cipher.Nonce)
+	copy(secretKey[:], derived)
+
+	der, ok := secretbox.Open(nil, encrypted.Ciphertext, &nonce, &secretKey)
+	if !ok {
+		return nil, errors.New("wrong password")
+	}
+	return der, nil
+}
@@ -0,0 +1,127 @@
+package orka
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// Interval to check for a free build slot at while queued.
+const buildSlotPollInterval = 10 * time.Second
+
+// stepAcquireBuildSlot waits for one of the `orka_build_concurrency_limit` build slots shared by the
+// builds with the same `orka_build_concurrency_key` before the builder VM is deployed, and holds it
+// until the build ends.
+type stepAcquireBuildSlot struct {
+	slots  *buildSlots
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (s *stepAcquireBuildSlot) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get(StateConfig).(*Config)
+	ui := state.Get(StateUi).(packer.Ui)
+	orkaClient := state.Get(StateOrkaClient).(OrkaClient)
+
+	s.slots = &buildSlots{
+		orkaClient: orkaClient,
+		namespace:  config.OrkaVMBuilderNamespace,
+		name:       buildSlotsName(config.OrkaBuildConcurrencyKey),
+		key:        config.OrkaBuildConcurrencyKey,
+		id:         config.OrkaVMBuilderBuildID,
+		limit:      config.OrkaBuildConcurrencyLimit,
+	}
+
+	ui.Say(fmt.Sprintf("Acquiring a build slot [%s] (%d builds at a time)", config.OrkaBuildConcurrencyKey, config.OrkaBuildConcurrencyLimit))
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(config.OrkaBuildConcurrencyTimeout)*time.Minute)
+	defer cancel()
+
+	start := time.Now()
+	lastPosition := -1
+	err := pollUntil(waitCtx, buildSlotPollInterval, func(ctx context.Context) (bool, error) {
+		acquired, position, inUse, err := s.slots.tryAcquire(ctx)
+		if err != nil || acquired {
+			return true, err
+		}
+		if position != lastPosition {
+			ui.Say(fmt.Sprintf("Waiting for a build slot, position %d in queue (%d of %d slots in use)", position+1, inUse, config.OrkaBuildConcurrencyLimit))
+			lastPosition = position
+		}
+		return false, nil
+	})
+	if err != nil {
+		err := fmt.Errorf("failed to acquire a build slot: %w", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("Build slot acquired after %s", time.Since(start).Round(time.Second)))
+
+	s.startRenewal(ctx, state)
+
+	return multistep.ActionContinue
+}
+
+// startRenewal renews the slot until Cleanup, so other builds do not consider it abandoned. The build
+// fails if the slot expired and was taken by another build.
+func (s *stepAcquireBuildSlot) startRenewal(ctx context.Context, state multistep.StateBag) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(buildSlotRenewInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := s.slots.renew(ctx)
+				var lost *buildSlotLostError
+				if errors.As(err, &lost) {
+					failBuild(state, lost)
+					return
+				}
+				if err != nil && ctx.Err() == nil {
+					log.Printf("failed to renew build slot: %s", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *stepAcquireBuildSlot) Cleanup(state multistep.StateBag) {
+	if s.slots == nil {
+		return
+	}
+
+	ui := state.Get(StateUi).(packer.Ui)
+
+	if s.cancel != nil {
+		s.cancel()
+		<-s.done
+	}
+
+	if err := s.slots.release(context.Background()); err != nil {
+		ui.Error(fmt.Sprintf("failed to release build slot, it expires in %s: %s", buildSlotTTL, err))
+	}
+}
+
+// buildSlotsName returns the name of the ConfigMap holding the build slots for the given key. The key
+// is hashed since it may be any string, such as a VM tag that is not a valid object name.
+func buildSlotsName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("packer-build-slots-%s", hex.EncodeToString(sum[:8]))
+}
@@ -0,0 +1,140 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// imageCacheAPIPath caches an image on a node. Orka versions without it are detected by the request
+// failing with ErrUnsupportedOrkaAPI, and the image is not cached.
+const imageCacheAPIPath = "/api/v1/namespaces/%s/nodes/%s/images"
+
+// stepCacheImage caches the source image on the nodes the builder VM may be deployed on, so the
+// deployment does not have to wait for it. Caching is best effort, the build continues if it fails.
+type stepCacheImage struct{}
+
+func (s *stepCacheImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get(StateConfig).(*Config)
+	ui := state.Get(StateUi).(packer.Ui)
+	orkaClient := state.Get(StateOrkaClient).(OrkaClient)
+	image := sourceImage(state)
+
+	nodes := &orkav1.OrkaNodeList{}
+	if err := orkaClient.List(ctx, nodes, client.InNamespace(DefaultOrkaNamespace)); err != nil {
+		ui.Error(fmt.Sprintf("failed to list nodes, deploying without caching image [%s]: %s", image, err))
+		return multistep.ActionContinue
+	}
+
+	candidates := cacheCandidates(config, nodes.Items)
+	if len(candidates) == 0 {
+		ui.Say(fmt.Sprintf("No nodes to cache image [%s] on, deploying without caching", image))
+		return multistep.ActionContinue
+	}
+
+	var pending []string
+	for _, node := range candidates {
+		if cached := findCachedImage(&node, image); cached != nil && cached.OrkaImageState == orkav1.OrkaImageStateReady {
+			ui.Say(fmt.Sprintf("Image [%s] is already cached on node [%s] (%s)", image, node.Name, formatBytes(cached.SizeBytes)))
+			continue
+		}
+
+		ui.Say(fmt.Sprintf("Caching image [%s] on node [%s]", image, node.Name))
+		path := fmt.Sprintf(imageCacheAPIPath, config.OrkaVMBuilderNamespace, node.Name)
+		if err := doOrkaAPIRequest(ctx, config, http.MethodPost, path, orkav1.OrkaImage{Name: image}, nil); errors.Is(err, ErrUnsupportedOrkaAPI) {
+			ui.Error(fmt.Sprintf("The Orka API of the cluster cannot cache images on nodes, deploying without caching image [%s]: %s", image, err))
+			return multistep.ActionContinue
+		} else if err != nil {
+			ui.Error(fmt.Sprintf("failed to cache image [%s] on node [%s]: %s", image, node.Name, err))
+			continue
+		}
+		pending = append(pending, node.Name)
+	}
+
+	if len(pending) == 0 {
+		return multistep.ActionContinue
+	}
+
+	ui.Say(fmt.Sprintf("Waiting for image [%s] to be cached on nodes [%s]", image, strings.Join(pending, ", ")))
+
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(config.OrkaPrecacheTimeout)*time.Minute)
+	defer cancel()
+
+	err := pollUntil(waitCtx, time.Duration(config.OrkaWaitPollInterval)*time.Second, func(ctx context.Context) (bool, error) {
+		nodes := &orkav1.OrkaNodeList{}
+		if err := orkaClient.List(ctx, nodes, client.InNamespace(DefaultOrkaNamespace)); err != nil {
+			return false, pollError(err)
+		}
+
+		var waiting []string
+		for _, node := range nodes.Items {
+			if !contains(pending, node.Name) {
+				continue
+			}
+
+			cached := findCachedImage(&node, image)
+			switch {
+			case cached == nil || cached.OrkaImageState == orkav1.OrkaImageStateCaching:
+				waiting = append(waiting, node.Name)
+			case cached.OrkaImageState == orkav1.OrkaImageStateReady:
+				ui.Say(fmt.Sprintf("Image [%s] is cached on node [%s] (%s)", image, node.Name, formatBytes(cached.SizeBytes)))
+			case cached.OrkaImageState == orkav1.OrkaImageStateFailed:
+				ui.Error(fmt.Sprintf("failed to cache image [%s] on node [%s]: %s", image, node.Name, cached.ErrorMessage))
+			}
+		}
+		pending = waiting
+		return len(pending) == 0, nil
+	})
+	if err != nil {
+		ui.Error(fmt.Sprintf("image [%s] is not cached on nodes [%s], deploying anyway: %s", image, strings.Join(pending, ", "), err))
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepCacheImage) Cleanup(multistep.StateBag) {
+}
+
+// cacheCandidates returns the ready nodes of the builder namespace the builder VM may be deployed on.
+// These are the nodes listed in orka_precache_nodes, or the nodes with orka_vm_tag if no nodes are listed.
+func cacheCandidates(config *Config, nodes []orkav1.OrkaNode) []orkav1.OrkaNode {
+	var candidates []orkav1.OrkaNode
+	for _, node := range nodes {
+		if node.Status.Phase != orkav1.NodeReady {
+			continue
+		}
+		if node.Spec.Namespace != "" && node.Spec.Namespace != config.OrkaVMBuilderNamespace {
+			continue
+		}
+
+		switch {
+		case len(config.OrkaPrecacheNodes) > 0:
+			if !contains(config.OrkaPrecacheNodes, node.Name) {
+				continue
+			}
+		case config.OrkaVMTag != "":
+			if !contains(node.Spec.Tags, config.OrkaVMTag) {
+				continue
+			}
+		}
+		candidates = append(candidates, node)
+	}
+	return candidates
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package orka
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestCacheCandidates(t *testing.T) {
+	node := func(name string, phase orkav1.NodePhase, namespace string, tags ...string) orkav1.OrkaNode {
+		return orkav1.OrkaNode{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       orkav1.OrkaNodeSpec{Namespace: namespace, Tags: tags},
+			Status:     orkav1.OrkaNodeStatus{Phase: phase},
+		}
+	}
+	nodes := []orkav1.OrkaNode{
+		node("mini-1", orkav1.NodeReady, ""),
+		node("mini-2", orkav1.NodeReady, DefaultOrkaNamespace, "m2"),
+		node("mini-3", orkav1.NodeNotReady, "", "m2"),
+		node("mini-4", orkav1.NodeReady, "orka-team", "m2"),
+		node("mini-5", orkav1.NodeReady, "", "m2", "gpu"),
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		tag       string
+		nodes     []string
+		want      []string
+	}{
+		{name: "all ready nodes of the namespace", namespace: DefaultOrkaNamespace, want: []string{"mini-1", "mini-2", "mini-5"}},
+		{name: "nodes assigned to another namespace", namespace: "orka-team", want: []string{"mini-1", "mini-4", "mini-5"}},
+		{name: "tagged nodes", namespace: DefaultOrkaNamespace, tag: "m2", want: []string{"mini-2", "mini-5"}},
+		{name: "unknown tag", namespace: DefaultOrkaNamespace, tag: "m4", want: nil},
+		{name: "listed nodes win over the tag", namespace: DefaultOrkaNamespace, tag: "gpu", nodes: []string{"mini-1", "mini-2"}, want: []string{"mini-1", "mini-2"}},
+		{name: "listed nodes that are not ready or in another namespace", namespace: DefaultOrkaNamespace, nodes: []string{"mini-3", "mini-4", "mini-6"}, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{OrkaVMBuilderNamespace: tt.namespace, OrkaVMTag: tt.tag, OrkaPrecacheNodes: tt.nodes}
+			var got []string
+			for _, n := range cacheCandidates(config, nodes) {
+				got = append(got, n.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cacheCandidates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// nodeListClient stores objects like objectClient and lists the given nodes.
+type nodeListClient struct {
+	*objectClient
+
+	nodes []orkav1.OrkaNode
+}
+
+func (c *nodeListClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	if nodes, ok := list.(*orkav1.OrkaNodeList); ok {
+		nodes.Items = c.nodes
+	}
+	return nil
+}
+
+func TestStepCacheImageUnsupported(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	ready := func(name string) orkav1.OrkaNode {
+		return orkav1.OrkaNode{ObjectMeta: metav1.ObjectMeta{Name: name}, Status: orkav1.OrkaNodeStatus{Phase: orkav1.NodeReady}}
+	}
+	ui := &packer.MockUi{}
+	state := &multistep.BasicStateBag{}
+	state.Put(StateConfig, &Config{
+		OrkaEndpoint:           server.URL,
+		OrkaVMBuilderNamespace: DefaultOrkaNamespace,
+		SourceImage:            "sonoma",
+		OrkaPrecacheTimeout:    1,
+		OrkaWaitPollInterval:   1,
+	})
+	state.Put(StateUi, ui)
+	state.Put(StateOrkaClient, &nodeListClient{objectClient: newObjectClient(), nodes: []orkav1.OrkaNode{ready("mini-1"), ready("mini-2")}})
+
+	if action := (&stepCacheImage{}).Run(context.Background(), state); action != multistep.ActionContinue {
+		t.Fatalf("Run() = %v, want %v", action, multistep.ActionContinue)
+	}
+
+	// The other nodes are not tried once the Orka API turns out to have no cache endpoint.
+	if want := []string{"POST /api/v1/namespaces/orka-default/nodes/mini-1/images"}; !reflect.DeepEqual(requests, want) {
+		t.Errorf("requests = %q, want %q", requests, want)
+	}
+	if !ui.ErrorCalled || !strings.Contains(ui.ErrorMessage, "cannot cache images on nodes") {
+		t.Errorf("error = %q, want the missing cache endpoint to be reported", ui.ErrorMessage)
+	}
+}
@@ -0,0 +1,200 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/docker/distribution/reference"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Number of suffixed names tried before giving up on finding a free image name.
+const imageNameSuffixAttempts = 100
+
+// stepCheckImageName fails the build before the builder VM is deployed if the image name is taken,
+// or switches to a free suffixed name with `image_name_conflict = "suffix"`. With `image_lock`, it
+// locks the image name first and holds the lock until the build ends.
+type stepCheckImageName struct {
+	lock *imageLock
+}
+
+func (s *stepCheckImageName) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get(StateConfig).(*Config)
+	ui := state.Get(StateUi).(packer.Ui)
+	orkaClient := state.Get(StateOrkaClient).(OrkaClient)
+
+	if config.NoCreateImage {
+		return multistep.ActionContinue
+	}
+
+	// Another build may write the image once the lock is lost, so the build fails before saving it.
+	onLost := func(err error) {
+		failBuild(state, err)
+	}
+
+	if config.ImageLock != ImageLockOff {
+		ui.Say(fmt.Sprintf("Locking image [%s]", config.ImageName))
+
+		s.lock = newImageLock(orkaClient, config.ImageLockNamespace, config.ImageName, config.OrkaVMBuilderBuildID, onLost)
+		err := s.lock.lock(ctx, config.ImageLock == ImageLockWait, config.ImageLockTimeout, func(holder string) {
+			ui.Say(fmt.Sprintf("Waiting for build [%s] to finish writing image [%s]", holder, config.ImageName))
+		})
+		if err != nil {
+			err := fmt.Errorf("failed to lock image [%s]: %w", config.ImageName, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	if config.ImageForceOverwrite || config.ImageSaveMode == ImageSaveModeCommit {
+		return multistep.ActionContinue
+	}
+
+	exists := func(name string) (bool, error) {
+		return nfsImageExists(ctx, orkaClient, name)
+	}
+	suffixed := func(i int) (string, error) {
+		name := fmt.Sprintf("%s-%d", config.ImageName, i)
+		return name, validateNFSImageName(name)
+	}
+
+	if config.ImageSaveMode == ImageSaveModeOCI {
+		named, err := reference.ParseNamed(config.ImageName)
+		if err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		tagged, ok := named.(reference.Tagged)
+		if _, digested := named.(reference.Digested); digested || !ok {
+			// Pushing by digest cannot overwrite another image.
+			return multistep.ActionContinue
+		}
+
+		registry := newRegistryClient(named, &config.ImageRegistryCredentials)
+		exists = func(name string) (bool, error) {
+			named, err := reference.ParseNamed(name)
+			if err != nil {
+				return false, err
+			}
+			return ociImageExists(ctx, registry, named.(reference.Tagged).Tag())
+		}
+		suffixed = func(i int) (string, error) {
+			name := fmt.Sprintf("%s:%s-%d", named.Name(), tagged.Tag(), i)
+			return name, validateOCIImageName(name)
+		}
+	}
+
+	taken, err := exists(config.ImageName)
+	if err != nil {
+		// The save reports the conflict later if there is one.
+		log.Printf("failed to check whether image [%s] exists: %s", config.ImageName, err)
+		return multistep.ActionContinue
+	}
+	if !taken {
+		return multistep.ActionContinue
+	}
+
+	if config.ImageNameConflict != ImageNameConflictSuffix {
+		err := fmt.Errorf("image [%s] already exists, set image_force_overwrite to replace it or image_name_conflict to %q to use a free name", config.ImageName, ImageNameConflictSuffix)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	for i := 2; i < imageNameSuffixAttempts+2; i++ {
+		name, err := suffixed(i)
+		if err != nil {
+			err := fmt.Errorf("failed to find a free name for image [%s]: %w", config.ImageName, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+
+		// Names locked by other builds are taken.
+		var lock *imageLock
+		if s.lock != nil {
+			lock = newImageLock(orkaClient, config.ImageLockNamespace, name, config.OrkaVMBuilderBuildID, onLost)
+			err := lock.lock(ctx, false, config.ImageLockTimeout, nil)
+			var locked *imageLockedError
+			if errors.As(err, &locked) {
+				continue
+			}
+			if err != nil {
+				err := fmt.Errorf("failed to lock image [%s]: %w", name, err)
+				state.Put("error", err)
+				ui.Error(err.Error())
+				return multistep.ActionHalt
+			}
+		}
+
+		taken, err = exists(name)
+		if err != nil || taken {
+			s.unlock(ui, lock)
+		}
+		if err != nil {
+			err := fmt.Errorf("failed to find a free name for image [%s]: %w", config.ImageName, err)
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+		if !taken {
+			ui.Say(fmt.Sprintf("image [%s] already exists, saving the image as [%s]", config.ImageName, name))
+			if lock != nil {
+				s.unlock(ui, s.lock)
+				s.lock = lock
+			}
+			config.ImageName = name
+			return multistep.ActionContinue
+		}
+	}
+
+	err = fmt.Errorf("failed to find a free name for image [%s] after %d attempts", config.ImageName, imageNameSuffixAttempts)
+	state.Put("error", err)
+	ui.Error(err.Error())
+	return multistep.ActionHalt
+}
+
+func (s *stepCheckImageName) Cleanup(state multistep.StateBag) {
+	ui := state.Get(StateUi).(packer.Ui)
+
+	s.unlock(ui, s.lock)
+	s.lock = nil
+}
+
+func (s *stepCheckImageName) unlock(ui packer.Ui, lock *imageLock) {
+	if lock == nil {
+		return
+	}
+	if err := lock.unlock(context.Background()); err != nil {
+		ui.Error(fmt.Sprintf("failed to unlock image [%s], the lock expires in %s: %s", lock.image, imageLockDuration, err))
+	}
+}
+
+// nfsImageExists reports whether an Orka image with the given name exists.
+func nfsImageExists(ctx context.Context, orkaClient OrkaClient, name string) (bool, error) {
+	image := &orkav1.Image{}
+	err := orkaClient.Get(ctx, client.ObjectKey{Namespace: DefaultOrkaNamespace, Name: name}, image)
+	if err == nil {
+		return true, nil
+	}
+	return false, client.IgnoreNotFound(err)
+}
+
+// ociImageExists reports whether the repository of the registry client has the given tag.
+func ociImageExists(ctx context.Context, registry *registryClient, tag string) (bool, error) {
+	_, err := registry.resolveDigest(ctx, tag)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, errRegistryNotFound) {
+		return false, nil
+	}
+	return false, err
+}
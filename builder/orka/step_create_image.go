@@ -15,15 +15,24 @@ import (
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
 	"github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-type stepCreateImage struct{}
+type stepCreateImage struct {
+	// temporaryImage is the image saved with image_safe_overwrite, deleted once it replaced the existing image.
+	temporaryImage string
+}
 
 const (
-	imageSaveTimeout   time.Duration = 5 * time.Hour
-	waitForSaveMessage string        = "Please wait as this can take a little while..."
+	imageSaveTimeout             time.Duration = 5 * time.Hour
+	imageCommitStartPollInterval time.Duration = 5 * time.Second
+	waitForSaveMessage           string        = "Please wait as this can take a little while..."
+
+	// Minutes to wait for a saved or committed image to be ready.
+	imageWaitTimeout int = 60
 )
 
 func (s *stepCreateImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
@@ -35,15 +44,13 @@ func (s *stepCreateImage) Run(ctx context.Context, state multistep.StateBag) mul
 		return multistep.ActionContinue
 	}
 
-	var oci bool
-	if _, err := reference.ParseNamed(config.ImageName); err == nil {
-		oci = true
-	}
-
-	if oci {
+	switch config.ImageSaveMode {
+	case ImageSaveModeOCI:
 		return imageSaveOCI(ctx, state, config)
-	} else {
-		return imageSaveNFS(ctx, state, config)
+	case ImageSaveModeCommit:
+		return imageCommit(ctx, state, config)
+	default:
+		return s.imageSaveNFS(ctx, state, config)
 	}
 }
 
@@ -52,6 +59,20 @@ func (s *stepCreateImage) Cleanup(state multistep.StateBag) {
 	config := state.Get(StateConfig).(*Config)
 	orkaClient := state.Get(StateOrkaClient).(OrkaClient)
 
+	if s.temporaryImage != "" {
+		ui.Say(fmt.Sprintf("Cleaning up image [%s]", s.temporaryImage))
+		if err := deleteImage(context.Background(), orkaClient, s.temporaryImage); err != nil {
+			ui.Error(fmt.Sprintf("failed to delete image [%s]: %s", s.temporaryImage, err))
+		} else {
+			emitEvent(state, EventCleanup, "", map[string]interface{}{"kind": "image", "name": s.temporaryImage})
+		}
+	}
+
+	// A failed commit leaves the source image as it was, it must not be deleted.
+	if config.ImageSaveMode == ImageSaveModeCommit {
+		return
+	}
+
 	image := &orkav1.Image{}
 
 	err := orkaClient.Get(context.Background(), client.ObjectKey{Namespace: DefaultOrkaNamespace, Name: config.ImageName}, image)
@@ -59,11 +80,13 @@ func (s *stepCreateImage) Cleanup(state multistep.StateBag) {
 		ui.Say(fmt.Sprintf("Cleaning up image [%s]", config.ImageName))
 		if err := orkaClient.Delete(context.Background(), image); err != nil {
 			ui.Error(fmt.Sprintf("failed to delete image [%s]: %s", config.ImageName, err.Error()))
+		} else {
+			emitEvent(state, EventCleanup, "", map[string]interface{}{"kind": "image", "name": config.ImageName})
 		}
 	}
 }
 
-func imageSaveNFS(ctx context.Context, state multistep.StateBag, config *Config) multistep.StepAction {
+func (s *stepCreateImage) imageSaveNFS(ctx context.Context, state multistep.StateBag, config *Config) multistep.StepAction {
 	ui := state.Get(StateUi).(packer.Ui)
 	orkaClient := state.Get(StateOrkaClient).(OrkaClient)
 
@@ -73,14 +96,40 @@ func imageSaveNFS(ctx context.Context, state multistep.StateBag, config *Config)
 	ctx, cancel := context.WithTimeout(ctx, imageSaveTimeout)
 	defer cancel()
 
+	// With image_safe_overwrite, an existing image is kept until the new one is saved under a temporary name.
+	name := config.ImageName
+	if config.ImageForceOverwrite && config.ImageSafeOverwrite {
+		exists, err := imageExists(ctx, orkaClient, config.ImageName)
+		if err == nil && exists {
+			name, err = temporaryImageName(config.ImageName)
+		}
+		if err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
 	ui.Say(fmt.Sprintf("Image creation is using VM [%s] in namespace [%s]", vmName, vmNamespace))
-	ui.Say(fmt.Sprintf("Saving new image [%s]", config.ImageName))
+	if name != config.ImageName {
+		s.temporaryImage = name
+		ui.Say(fmt.Sprintf("Saving new image [%s] as [%s] until it replaces the existing image", config.ImageName, name))
+	} else {
+		ui.Say(fmt.Sprintf("Saving new image [%s]", config.ImageName))
+	}
 	ui.Say(waitForSaveMessage)
+	emitEvent(state, EventSaveStart, "", map[string]interface{}{
+		"mode":         ImageSaveModeNFS,
+		"image":        config.ImageName,
+		"saved_as":     name,
+		"vm_name":      vmName,
+		"vm_namespace": vmNamespace,
+	})
 
 	image := &orkav1.Image{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: DefaultOrkaNamespace,
-			Name:      config.ImageName,
+			Name:      name,
 			Annotations: map[string]string{
 				DescriptionAnnotationKey: config.ImageDescription,
 			},
@@ -89,11 +138,11 @@ func imageSaveNFS(ctx context.Context, state multistep.StateBag, config *Config)
 			Source:          vmName,
 			SourceNamespace: vmNamespace,
 			SourceType:      orkav1.Vm,
-			Destination:     config.ImageName,
+			Destination:     name,
 		},
 	}
 
-	if config.ImageForceOverwrite {
+	if config.ImageForceOverwrite && name == config.ImageName {
 		if err := client.IgnoreNotFound(orkaClient.Delete(ctx, image)); err != nil {
 			err := fmt.Errorf("failed to delete existing VM image: %w", err)
 			state.Put("error", err)
@@ -109,14 +158,92 @@ func imageSaveNFS(ctx context.Context, state multistep.StateBag, config *Config)
 		return multistep.ActionHalt
 	}
 
-	if err := orkaClient.WaitForImage(ctx, config.ImageName); err != nil {
+	if err := orkaClient.WaitForImage(ctx, name, imageWaitTimeout); err != nil {
 		err := fmt.Errorf("failed to save the image: %w", err)
 		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
 
+	if name != config.ImageName {
+		ui.Say(fmt.Sprintf("Replacing image [%s] with [%s]", config.ImageName, name))
+		if err := replaceImage(ctx, orkaClient, name, config.ImageName, config.ImageDescription, imageWaitTimeout); err != nil {
+			// The saved image is the only copy of the new image now, it must not be cleaned up.
+			s.temporaryImage = ""
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
 	ui.Say(fmt.Sprintf("image [%s] saved successfully", config.ImageName))
+	emitEvent(state, EventImageReady, EventSaveStart, map[string]interface{}{"image": config.ImageName})
+
+	return multistep.ActionContinue
+}
+
+// imageCommit commits the changes of the builder VM back into its source image.
+func imageCommit(ctx context.Context, state multistep.StateBag, config *Config) multistep.StepAction {
+	ui := state.Get(StateUi).(packer.Ui)
+	orkaClient := state.Get(StateOrkaClient).(OrkaClient)
+
+	vmNamespace := config.OrkaVMBuilderNamespace
+	vmName := config.OrkaVMBuilderName
+
+	ctx, cancel := context.WithTimeout(ctx, imageSaveTimeout)
+	defer cancel()
+
+	ui.Say(fmt.Sprintf("Image creation is using VM [%s] in namespace [%s]", vmName, vmNamespace))
+	ui.Say(fmt.Sprintf("Committing changes to image [%s]", config.ImageName))
+	ui.Say(waitForSaveMessage)
+	emitEvent(state, EventSaveStart, "", map[string]interface{}{
+		"mode":         ImageSaveModeCommit,
+		"image":        config.ImageName,
+		"vm_name":      vmName,
+		"vm_namespace": vmNamespace,
+	})
+
+	image := &orkav1.Image{}
+	if err := orkaClient.Get(ctx, client.ObjectKey{Namespace: DefaultOrkaNamespace, Name: config.ImageName}, image); err != nil {
+		err := fmt.Errorf("failed to get image [%s]: %w", config.ImageName, err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	lastUpdated := image.Status.LastUpdatedTimestamp
+
+	// Commits are requested on the existing image, with no destination.
+	patch := client.MergeFrom(image.DeepCopy())
+	image.Spec.Source = vmName
+	image.Spec.SourceNamespace = vmNamespace
+	image.Spec.SourceType = orkav1.Vm
+	image.Spec.Destination = ""
+	if err := orkaClient.Patch(ctx, image, patch); err != nil {
+		err := fmt.Errorf("failed to create a VM commit request: %w", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	// The image is Ready until the commit starts, wait for it to start so its end is not missed.
+	err := pollUntil(ctx, imageCommitStartPollInterval, func(ctx context.Context) (bool, error) {
+		if err := orkaClient.Get(ctx, client.ObjectKeyFromObject(image), image); err != nil {
+			return false, pollError(err)
+		}
+		return image.Status.State != orkav1.Ready || image.Status.LastUpdatedTimestamp != lastUpdated, nil
+	})
+	if err == nil {
+		err = orkaClient.WaitForImage(ctx, config.ImageName, imageWaitTimeout)
+	}
+	if err != nil {
+		err := fmt.Errorf("failed to commit the image: %w", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("image [%s] committed successfully", config.ImageName))
+	emitEvent(state, EventImageReady, EventSaveStart, map[string]interface{}{"image": config.ImageName})
 
 	return multistep.ActionContinue
 }
@@ -160,18 +287,35 @@ func imageSaveOCI(ctx context.Context, state multistep.StateBag, config *Config)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", config.OrkaAuthToken))
 
+	_, sp := startSpan(ctx, "orka.API "+http.MethodPost, trace.SpanKindClient,
+		attribute.String("http.method", http.MethodPost),
+		attribute.String("orka.api_path", vmPushAPIPath),
+	)
 	cl := &http.Client{}
 	response, err := cl.Do(req)
 	if err != nil {
+		endSpan(sp, err)
 		err := fmt.Errorf("failed to send VM push request: %w", err)
 		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
 	defer response.Body.Close()
+	sp.SetAttributes(attribute.Int("http.status_code", response.StatusCode))
+	var spanErr error
+	if response.StatusCode != http.StatusOK {
+		spanErr = fmt.Errorf("VM push failed with status code %d", response.StatusCode)
+	}
+	endSpan(sp, spanErr)
 
 	ui.Say(fmt.Sprintf("Image push is using VM [%s] in namespace [%s]", vmName, vmNamespace))
 	ui.Say(fmt.Sprintf("Pushing new image to registry [%s]", config.ImageName))
+	emitEvent(state, EventSaveStart, "", map[string]interface{}{
+		"mode":         ImageSaveModeOCI,
+		"image":        config.ImageName,
+		"vm_name":      vmName,
+		"vm_namespace": vmNamespace,
+	})
 
 	body, err := io.ReadAll(response.Body)
 	if err != nil {
@@ -204,6 +348,7 @@ func imageSaveOCI(ctx context.Context, state multistep.StateBag, config *Config)
 	}
 
 	ui.Say(fmt.Sprintf("image [%s] push began successfully.", config.ImageName))
+	emitEvent(state, EventPushJobStarted, EventSaveStart, map[string]interface{}{"image": config.ImageName, "job_name": r.JobName})
 	ui.Say(waitForSaveMessage)
 
 	err = orkaClient.WaitForPush(ctx, config.OrkaVMBuilderNamespace, r.JobName, config.PackerPushTimeout)
@@ -215,5 +360,35 @@ func imageSaveOCI(ctx context.Context, state multistep.StateBag, config *Config)
 
 	ui.Say(fmt.Sprintf("image [%s] push finshed successfully.", config.ImageName))
 
+	digest, err := pushedImageDigest(ctx, config)
+	if err != nil {
+		ui.Error(fmt.Sprintf("failed to get the digest of image [%s], the artifact will refer to it by tag: %s", config.ImageName, err))
+	} else {
+		ui.Say(fmt.Sprintf("image [%s] digest is [%s]", config.ImageName, digest))
+		state.Put(StateImageDigest, digest)
+	}
+
+	readyFields := map[string]interface{}{"image": config.ImageName}
+	if digest, ok := state.GetOk(StateImageDigest); ok {
+		readyFields["digest"] = digest
+	}
+	emitEvent(state, EventImageReady, EventSaveStart, readyFields)
+
 	return multistep.ActionContinue
 }
+
+// pushedImageDigest returns the manifest digest of the pushed image by resolving its tag against the registry.
+func pushedImageDigest(ctx context.Context, config *Config) (string, error) {
+	named, err := reference.ParseNamed(config.ImageName)
+	if err != nil {
+		return "", err
+	}
+	if digested, ok := named.(reference.Digested); ok {
+		return digested.Digest().String(), nil
+	}
+	tagged, ok := named.(reference.Tagged)
+	if !ok {
+		return "", fmt.Errorf("image [%s] has no tag to resolve", config.ImageName)
+	}
+	return newRegistryClient(named, &config.ImageRegistryCredentials).resolveDigest(ctx, tagged.Tag())
+}
@@ -0,0 +1,67 @@
+package orka
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStepCreateImageSafeOverwrite(t *testing.T) {
+	isTemporary := func(name string) bool { return strings.HasPrefix(name, "latest-tmp-") }
+	isLatest := func(name string) bool { return name == "latest" }
+
+	tests := []struct {
+		name          string
+		safeOverwrite bool
+		existing      bool
+		fail          func(name string) bool
+		wantAction    multistep.StepAction
+		// wantImages maps the images left after the cleanup to the image or VM each was saved from.
+		wantImages map[string]string
+	}{
+		{name: "new image", safeOverwrite: true, wantAction: multistep.ActionContinue, wantImages: map[string]string{"latest": "builder-vm"}},
+		{name: "overwrite", existing: true, wantAction: multistep.ActionContinue, wantImages: map[string]string{"latest": "builder-vm"}},
+		{name: "safe overwrite", safeOverwrite: true, existing: true, wantAction: multistep.ActionContinue, wantImages: map[string]string{"latest": "tmp"}},
+		{name: "failed save keeps the existing image", safeOverwrite: true, existing: true, fail: isTemporary, wantAction: multistep.ActionHalt, wantImages: map[string]string{"latest": "old"}},
+		{name: "failed replacement keeps the saved image", safeOverwrite: true, existing: true, fail: isLatest, wantAction: multistep.ActionHalt, wantImages: map[string]string{"latest": "tmp", "tmp": "builder-vm"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &imageCopyClient{objectClient: newObjectClient(), fail: tt.fail}
+			if tt.existing {
+				c.Create(context.Background(), &orkav1.Image{
+					ObjectMeta: metav1.ObjectMeta{Namespace: DefaultOrkaNamespace, Name: "latest"},
+					Spec:       orkav1.ImageSpec{Source: "old"},
+				})
+			}
+
+			state := &multistep.BasicStateBag{}
+			state.Put(StateConfig, &Config{
+				OrkaVMBuilderName:      "builder-vm",
+				OrkaVMBuilderNamespace: DefaultOrkaNamespace,
+				ImageName:              "latest",
+				ImageSaveMode:          ImageSaveModeNFS,
+				ImageForceOverwrite:    true,
+				ImageSafeOverwrite:     tt.safeOverwrite,
+			})
+			state.Put(StateUi, &packer.MockUi{})
+			state.Put(StateOrkaClient, c)
+
+			step := &stepCreateImage{}
+			if action := step.Run(context.Background(), state); action != tt.wantAction {
+				t.Errorf("Run() = %v, want %v", action, tt.wantAction)
+			}
+			step.Cleanup(state)
+
+			if images := c.images(); !reflect.DeepEqual(images, tt.wantImages) {
+				t.Errorf("images = %v, want %v", images, tt.wantImages)
+			}
+		})
+	}
+}
@@ -3,23 +3,30 @@ package orka
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/packer-plugin-sdk/multistep"
 	"github.com/hashicorp/packer-plugin-sdk/packer"
 	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	"github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/models"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 )
 
 type stepCreateVm struct {
-	createVMFailed bool
+	// vmCreated is set once this build created the builder VM. Cleanup never touches a VM it did not create.
+	vmCreated bool
+	heartbeat *vmHeartbeat
 }
 
 func (s *stepCreateVm) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
 	config := state.Get(StateConfig).(*Config)
 	ui := state.Get(StateUi).(packer.Ui)
 	client := state.Get(StateOrkaClient).(OrkaClient)
+	image := sourceImage(state)
 
-	ui.Say(fmt.Sprintf("Builder VM configuration will use base image [%s]", config.SourceImage))
+	ui.Say(fmt.Sprintf("Builder VM configuration will use base image [%s]", image))
 
 	// #######################################
 	// # CREATE THE BUILDER VM CONFIGURATION #
@@ -29,9 +36,14 @@ func (s *stepCreateVm) Run(ctx context.Context, state multistep.StateBag) multis
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: config.OrkaVMBuilderNamespace,
 			Name:      config.OrkaVMBuilderName,
+			Labels: map[string]string{
+				PackerBuilderLabelKey: "true",
+				PackerBuildIDLabelKey: config.OrkaVMBuilderBuildID,
+			},
+			Annotations: builderVmAnnotations(config, time.Now()),
 		},
 		Spec: orkav1.VirtualMachineInstanceSpec{
-			Image:       config.SourceImage,
+			Image:       image,
 			CPU:         config.OrkaVMCPUCore,
 			Tag:         &config.OrkaVMTag,
 			TagRequired: &config.OrkaVMTagRequired,
@@ -41,14 +53,31 @@ func (s *stepCreateVm) Run(ctx context.Context, state multistep.StateBag) multis
 	}
 
 	ui.Say(fmt.Sprintf("Deploying a VM [%s] in namespace [%s]", config.OrkaVMBuilderName, config.OrkaVMBuilderNamespace))
+	emitEvent(state, EventVmCreate, "", map[string]interface{}{
+		"vm_name":      config.OrkaVMBuilderName,
+		"vm_namespace": config.OrkaVMBuilderNamespace,
+		"source_image": image,
+		"cpu":          config.OrkaVMCPUCore,
+		"tag":          config.OrkaVMTag,
+	})
 	if err := client.Create(ctx, &vmi); err != nil {
 		err := fmt.Errorf("failed to deploy a VM: %w", err)
 		state.Put("error", err)
 		ui.Error(err.Error())
 		return multistep.ActionHalt
 	}
+	s.vmCreated = true
 
-	sshHost, sshPort, err := client.WaitForVm(ctx, config.OrkaVMBuilderNamespace, config.OrkaVMBuilderName, config.PackerVMWaitTimeout)
+	// Other builds reap the VM once its heartbeat expires, so the build fails before that.
+	onLost := func(err error) {
+		failBuild(state, err)
+	}
+	s.heartbeat = startVmHeartbeat(ctx, client, ui, config.OrkaVMBuilderNamespace, config.OrkaVMBuilderName,
+		time.Duration(config.OrkaVMHeartbeatInterval)*time.Minute, time.Duration(config.OrkaVMHeartbeatTimeout)*time.Minute, onLost)
+
+	stopProgress := startVmProgress(ctx, ui, events(state), client, config, image)
+	info, err := client.WaitForVm(ctx, config.OrkaVMBuilderNamespace, config.OrkaVMBuilderName, config.PackerVMWaitTimeout)
+	stopProgress()
 	if err != nil {
 		err := fmt.Errorf("failed to wait for the VM: %w", err)
 		state.Put("error", err)
@@ -63,9 +92,23 @@ func (s *stepCreateVm) Run(ctx context.Context, state multistep.StateBag) multis
 	// Write the VM ID to our state databag for cleanup later.
 
 	ui.Say(fmt.Sprintf("Created VM [%s] in namespace [%s]", config.OrkaVMBuilderName, config.OrkaVMBuilderNamespace))
+	ui.Say(fmt.Sprintf("VM is running on node [%s] with [%s] of memory", info.NodeName, info.Memory))
+	emitEvent(state, EventVmRunning, EventVmCreate, map[string]interface{}{
+		"vm_name":  config.OrkaVMBuilderName,
+		"node":     info.NodeName,
+		"ip":       info.IP,
+		"ssh_port": info.SSHPort,
+		"memory":   info.Memory,
+	})
+	if info.PortWarnings != "" {
+		ui.Say(fmt.Sprintf("VM port warnings: %s", info.PortWarnings))
+	}
 
+	state.Put(StateVmInfo, info)
+
+	sshHost := info.IP
 	if config.EnableOrkaNodeIPMapping {
-		if newSshHost, ok := config.OrkaNodeIPMap[sshHost]; !ok {
+		if newSshHost, ok := mapNodeIP(config, sshHost); !ok {
 			err := fmt.Errorf("VM IP [%s] is not tracked in the provided node IP map. Please provide a mapping for this VM", sshHost)
 			state.Put("error", err)
 			ui.Error(err.Error())
@@ -76,11 +119,12 @@ func (s *stepCreateVm) Run(ctx context.Context, state multistep.StateBag) multis
 		}
 	}
 
-	ui.Say(fmt.Sprintf("SSH server will be available at [%s:%d]", sshHost, sshPort))
+	ui.Say(fmt.Sprintf("SSH server will be available at [%s:%d]", sshHost, info.SSHPort))
+	sayGUIPorts(ui, config, info)
 
 	// Write to our state databag for pick-up by the ssh communicator.
 	state.Put(StateSshHost, sshHost)
-	state.Put(StateSshPort, sshPort)
+	state.Put(StateSshPort, info.SSHPort)
 
 	// Continue processing
 	return multistep.ActionContinue
@@ -91,13 +135,24 @@ func (s *stepCreateVm) Cleanup(state multistep.StateBag) {
 	ui := state.Get(StateUi).(packer.Ui)
 	client := state.Get(StateOrkaClient).(OrkaClient)
 
+	s.heartbeat.Stop()
+
+	if !s.vmCreated {
+		ui.Say("Nothing to cleanup because the builder VM was not created.")
+		return
+	}
+
 	if config.NoDeleteVM {
 		ui.Say("We are skipping the deletion of the builder VM and its configuration because of do_not_delete being set")
+		// The VM was marked as kept when it was created, so the reaper leaves it alone once the heartbeat is gone.
+		if err := patchVmAnnotations(context.Background(), client, config.OrkaVMBuilderNamespace, config.OrkaVMBuilderName, map[string]*string{PackerHeartbeatAnnotationKey: nil}); err != nil {
+			ui.Error(fmt.Sprintf("failed to remove heartbeat from builder VM: %s", err))
+		}
 		return
 	}
 
-	if s.createVMFailed {
-		ui.Say("Nothing to cleanup because the builder VM creation, deployment and/or provisioning failed.")
+	if config.KeepVMOnFailure && buildFailed(state) {
+		s.keepVm(state)
 		return
 	}
 
@@ -112,5 +167,92 @@ func (s *stepCreateVm) Cleanup(state multistep.StateBag) {
 	if err := client.Delete(context.Background(), vmi); err != nil {
 		state.Put("error", err)
 		ui.Error(fmt.Errorf("failed to delete builder VM: %w", err).Error())
+		return
+	}
+	emitEvent(state, EventCleanup, "", map[string]interface{}{
+		"kind":      "vm",
+		"name":      config.OrkaVMBuilderName,
+		"namespace": config.OrkaVMBuilderNamespace,
+	})
+}
+
+// keepVm keeps the builder VM of a failed build around for debugging until it expires
+// and prints how to connect to it.
+func (s *stepCreateVm) keepVm(state multistep.StateBag) {
+	config := state.Get(StateConfig).(*Config)
+	ui := state.Get(StateUi).(packer.Ui)
+	client := state.Get(StateOrkaClient).(OrkaClient)
+	ctx := context.Background()
+
+	expiry := time.Now().UTC().Add(time.Duration(config.KeepVMOnFailureTTL) * time.Minute).Format(time.RFC3339)
+	annotations := map[string]*string{
+		PackerExpiresAtAnnotationKey: &expiry,
+		PackerHeartbeatAnnotationKey: nil,
+	}
+	if err := patchVmAnnotations(ctx, client, config.OrkaVMBuilderNamespace, config.OrkaVMBuilderName, annotations); apierrors.IsNotFound(err) {
+		ui.Say(fmt.Sprintf("Builder VM [%s] no longer exists, there is nothing to keep", config.OrkaVMBuilderName))
+		return
+	} else if err != nil {
+		ui.Error(fmt.Sprintf("failed to set the expiry of builder VM [%s]: %s", config.OrkaVMBuilderName, err))
+		return
+	}
+
+	ui.Say(fmt.Sprintf("Keeping builder VM [%s] in namespace [%s] because of keep_vm_on_failure being set. It expires at %s", config.OrkaVMBuilderName, config.OrkaVMBuilderNamespace, expiry))
+
+	vmi := &orkav1.VirtualMachineInstance{}
+	key := types.NamespacedName{Namespace: config.OrkaVMBuilderNamespace, Name: config.OrkaVMBuilderName}
+	if err := client.Get(ctx, key, vmi); err != nil {
+		ui.Error(fmt.Sprintf("failed to get connection details of builder VM [%s]: %s", config.OrkaVMBuilderName, err))
+		return
 	}
+
+	info := vmInfo(vmi)
+	sshHost, _ := mapNodeIP(config, info.IP)
+	if info.SSHPort != 0 {
+		ui.Say(fmt.Sprintf("SSH: ssh -p %d %s@%s", info.SSHPort, config.CommConfig.SSHUsername, sshHost))
+	}
+	sayGUIPorts(ui, config, info)
+}
+
+// sayGUIPorts prints where the VNC console and Screen Sharing of the VM can be reached, if enabled.
+func sayGUIPorts(ui packer.Ui, config *Config, info models.OrkaVMInfoModel) {
+	nodeHost, _ := mapNodeIP(config, info.HostIP)
+	if info.VNCPort != 0 {
+		ui.Say(fmt.Sprintf("VNC console will be available at [vnc://%s:%d]", nodeHost, info.VNCPort))
+	}
+	if info.ScreenSharePort != 0 {
+		ui.Say(fmt.Sprintf("Screen Sharing will be available at [vnc://%s:%d]", nodeHost, info.ScreenSharePort))
+	}
+}
+
+// mapNodeIP translates an internal node IP using orka_node_ip_map when node IP mapping is enabled.
+// It returns the IP unchanged and false when the IP is not mapped.
+func mapNodeIP(config *Config, ip string) (string, bool) {
+	if !config.EnableOrkaNodeIPMapping {
+		return ip, false
+	}
+
+	if mapped, ok := config.OrkaNodeIPMap[ip]; ok {
+		return mapped, true
+	}
+	return ip, false
+}
+
+// builderVmAnnotations returns the annotations the reaper uses to tell whether the builder VM was abandoned.
+// The heartbeat timeout is recorded so builds with other settings judge the heartbeat by the owner's timeout.
+func builderVmAnnotations(config *Config, now time.Time) map[string]string {
+	annotations := map[string]string{
+		PackerExpiresAtAnnotationKey:        builderVmExpiry(config).Format(time.RFC3339),
+		PackerHeartbeatAnnotationKey:        now.UTC().Format(time.RFC3339),
+		PackerHeartbeatTimeoutAnnotationKey: (time.Duration(config.OrkaVMHeartbeatTimeout) * time.Minute).String(),
+	}
+	if config.NoDeleteVM {
+		annotations[PackerKeepAnnotationKey] = "true"
+	}
+	return annotations
+}
+
+// builderVmExpiry returns the time after which the builder VM may be reaped if it was abandoned.
+func builderVmExpiry(config *Config) time.Time {
+	return time.Now().UTC().Add(time.Duration(config.OrkaVMBuilderTTL) * time.Minute)
 }
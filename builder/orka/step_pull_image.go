@@ -0,0 +1,131 @@
+package orka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// stepPullImage pulls the source image from an OCI registry into an Orka image the builder VM is deployed from.
+type stepPullImage struct {
+	temporaryImage string
+}
+
+func (s *stepPullImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get(StateConfig).(*Config)
+	ui := state.Get(StateUi).(packer.Ui)
+	orkaClient := state.Get(StateOrkaClient).(OrkaClient)
+
+	name := config.SourceImagePullName
+	if name == "" {
+		name = fmt.Sprintf("%s-source", config.OrkaVMBuilderName)
+	}
+
+	ui.Say(fmt.Sprintf("Pulling image [%s] from registry [%s]", name, config.SourceImage))
+
+	image := &orkav1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: DefaultOrkaNamespace,
+			Name:      name,
+			Labels: map[string]string{
+				PackerBuildIDLabelKey: config.OrkaVMBuilderBuildID,
+			},
+			Annotations: map[string]string{
+				DescriptionAnnotationKey: fmt.Sprintf("Pulled from %s", config.SourceImage),
+			},
+		},
+		Spec: orkav1.ImageSpec{
+			Source:     config.SourceImage,
+			SourceType: orkav1.Remote,
+		},
+	}
+
+	if config.SourceImagePullName != "" {
+		if err := replaceExistingImage(ctx, orkaClient, name, config.SourceImagePullForce); err != nil {
+			state.Put("error", err)
+			ui.Error(err.Error())
+			return multistep.ActionHalt
+		}
+	}
+
+	if err := orkaClient.Create(ctx, image); err != nil {
+		err := fmt.Errorf("failed to create an image pull request: %w", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+	if config.SourceImagePullName == "" {
+		s.temporaryImage = name
+	}
+
+	ui.Say(waitForSaveMessage)
+
+	start := time.Now()
+	stopReporter := startElapsedReporter(ctx, ui, time.Minute, fmt.Sprintf("Still pulling image [%s]", name))
+	err := orkaClient.WaitForImage(ctx, name, config.SourceImagePullTimeout)
+	stopReporter()
+	if err != nil {
+		err := fmt.Errorf("failed to pull the image: %w", err)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	ui.Say(fmt.Sprintf("image [%s] pulled successfully in %s", name, time.Since(start).Round(time.Second)))
+
+	state.Put(StateSourceImage, name)
+
+	return multistep.ActionContinue
+}
+
+func (s *stepPullImage) Cleanup(state multistep.StateBag) {
+	ui := state.Get(StateUi).(packer.Ui)
+	orkaClient := state.Get(StateOrkaClient).(OrkaClient)
+
+	if s.temporaryImage != "" {
+		ui.Say(fmt.Sprintf("Cleaning up pulled image [%s]", s.temporaryImage))
+		image := &orkav1.Image{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: DefaultOrkaNamespace,
+				Name:      s.temporaryImage,
+			},
+		}
+		if err := client.IgnoreNotFound(orkaClient.Delete(context.Background(), image)); err != nil {
+			ui.Error(fmt.Sprintf("failed to delete image [%s]: %s", s.temporaryImage, err))
+		}
+	}
+}
+
+// replaceExistingImage deletes an existing image with the given name if force is set, and fails otherwise.
+func replaceExistingImage(ctx context.Context, orkaClient OrkaClient, name string, force bool) error {
+	image := &orkav1.Image{}
+	err := orkaClient.Get(ctx, client.ObjectKey{Namespace: DefaultOrkaNamespace, Name: name}, image)
+	switch {
+	case apierrors.IsNotFound(err):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed to get image [%s]: %w", name, err)
+	case !force:
+		return fmt.Errorf("image [%s] already exists, set source_image_pull_force to replace it", name)
+	}
+
+	if err := client.IgnoreNotFound(orkaClient.Delete(ctx, image)); err != nil {
+		return fmt.Errorf("failed to delete existing image [%s]: %w", name, err)
+	}
+	return nil
+}
+
+// sourceImage returns the name of the image the builder VM is deployed from.
+func sourceImage(state multistep.StateBag) string {
+	if name, ok := state.GetOk(StateSourceImage); ok {
+		return name.(string)
+	}
+	return state.Get(StateConfig).(*Config).SourceImage
+}
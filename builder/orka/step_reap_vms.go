@@ -0,0 +1,98 @@
+package orka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// stepReapVms deletes builder VMs that were left behind by builds which never got to run their cleanup.
+// Only VMs labeled as Packer builder VMs whose heartbeat went stale or whose expiry passed are considered.
+type stepReapVms struct {
+	failOnError bool
+}
+
+func (s *stepReapVms) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get(StateConfig).(*Config)
+	ui := state.Get(StateUi).(packer.Ui)
+	orkaClient := state.Get(StateOrkaClient).(OrkaClient)
+
+	ui.Say(fmt.Sprintf("Looking for abandoned builder VMs in namespace [%s]", config.OrkaVMBuilderNamespace))
+
+	vmis := &orkav1.VirtualMachineInstanceList{}
+	err := orkaClient.List(ctx, vmis, client.InNamespace(config.OrkaVMBuilderNamespace), client.MatchingLabels{PackerBuilderLabelKey: "true"})
+	if err != nil {
+		return s.fail(state, ui, fmt.Errorf("failed to list builder VMs: %w", err))
+	}
+
+	now := time.Now()
+	var failed int
+	for i := range vmis.Items {
+		vmi := &vmis.Items[i]
+
+		reason, ok := builderVmAbandoned(vmi, now)
+		if !ok || vmi.Labels[PackerBuildIDLabelKey] == config.OrkaVMBuilderBuildID {
+			continue
+		}
+
+		ui.Say(fmt.Sprintf("Deleting abandoned builder VM [%s] of build [%s], %s", vmi.Name, vmi.Labels[PackerBuildIDLabelKey], reason))
+		if err := client.IgnoreNotFound(orkaClient.Delete(ctx, vmi)); err != nil {
+			ui.Error(fmt.Sprintf("failed to delete builder VM [%s]: %s", vmi.Name, err))
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return s.fail(state, ui, fmt.Errorf("failed to delete %d abandoned builder VM(s)", failed))
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepReapVms) Cleanup(multistep.StateBag) {
+}
+
+// fail halts the build when reaping was explicitly requested. Otherwise reaping is best effort
+// and should never prevent a build from running.
+func (s *stepReapVms) fail(state multistep.StateBag, ui packer.Ui, err error) multistep.StepAction {
+	ui.Error(err.Error())
+	if !s.failOnError {
+		return multistep.ActionContinue
+	}
+
+	state.Put("error", err)
+	return multistep.ActionHalt
+}
+
+// builderVmAbandoned reports whether the VM was created by this plugin and the build owning it is gone,
+// along with the reason. A VM with a heartbeat is abandoned once the heartbeat is older than the heartbeat timeout
+// of its build, a VM without one once its expiry has passed. VMs kept by no_delete_vm and VMs without valid
+// annotations are never considered abandoned.
+func builderVmAbandoned(vmi *orkav1.VirtualMachineInstance, now time.Time) (string, bool) {
+	if vmi.Labels[PackerBuilderLabelKey] != "true" || vmi.Annotations[PackerKeepAnnotationKey] == "true" {
+		return "", false
+	}
+
+	if value, ok := vmi.Annotations[PackerHeartbeatAnnotationKey]; ok {
+		heartbeat, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return "", false
+		}
+		// VMs of builds that did not record their heartbeat timeout are judged by their expiry.
+		if timeout, err := time.ParseDuration(vmi.Annotations[PackerHeartbeatTimeoutAnnotationKey]); err == nil && timeout > 0 {
+			return fmt.Sprintf("no heartbeat since %s", heartbeat.Format(time.RFC3339)), now.Sub(heartbeat) > timeout
+		}
+	}
+
+	expiry, err := time.Parse(time.RFC3339, vmi.Annotations[PackerExpiresAtAnnotationKey])
+	if err != nil {
+		return "", false
+	}
+
+	return fmt.Sprintf("expired at %s", expiry.Format(time.RFC3339)), now.After(expiry)
+}
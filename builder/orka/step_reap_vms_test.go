@@ -0,0 +1,111 @@
+package orka
+
+import (
+	"testing"
+	"time"
+
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBuilderVmAbandoned(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) string { return now.Add(d).Format(time.RFC3339) }
+
+	tests := []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		want        bool
+	}{
+		{
+			name:        "not a builder VM",
+			labels:      map[string]string{},
+			annotations: map[string]string{PackerExpiresAtAnnotationKey: at(-time.Hour)},
+		},
+		{
+			name:        "fresh heartbeat",
+			annotations: map[string]string{PackerHeartbeatAnnotationKey: at(-time.Minute), PackerHeartbeatTimeoutAnnotationKey: "10m0s", PackerExpiresAtAnnotationKey: at(-time.Hour)},
+		},
+		{
+			name:        "stale heartbeat",
+			annotations: map[string]string{PackerHeartbeatAnnotationKey: at(-11 * time.Minute), PackerHeartbeatTimeoutAnnotationKey: "10m0s", PackerExpiresAtAnnotationKey: at(time.Hour)},
+			want:        true,
+		},
+		{
+			name:        "heartbeat within the timeout of the owner",
+			annotations: map[string]string{PackerHeartbeatAnnotationKey: at(-20 * time.Minute), PackerHeartbeatTimeoutAnnotationKey: "30m0s", PackerExpiresAtAnnotationKey: at(time.Hour)},
+		},
+		{
+			name:        "heartbeat without timeout before expiry",
+			annotations: map[string]string{PackerHeartbeatAnnotationKey: at(-time.Hour), PackerExpiresAtAnnotationKey: at(time.Hour)},
+		},
+		{
+			name:        "heartbeat without timeout after expiry",
+			annotations: map[string]string{PackerHeartbeatAnnotationKey: at(-time.Hour), PackerExpiresAtAnnotationKey: at(-time.Minute)},
+			want:        true,
+		},
+		{
+			name:        "expired without heartbeat",
+			annotations: map[string]string{PackerExpiresAtAnnotationKey: at(-time.Minute)},
+			want:        true,
+		},
+		{
+			name:        "not expired without heartbeat",
+			annotations: map[string]string{PackerExpiresAtAnnotationKey: at(time.Minute)},
+		},
+		{
+			name:        "kept by no_delete_vm",
+			annotations: map[string]string{PackerKeepAnnotationKey: "true", PackerExpiresAtAnnotationKey: at(-time.Hour)},
+		},
+		{
+			name:        "invalid heartbeat",
+			annotations: map[string]string{PackerHeartbeatAnnotationKey: "yesterday", PackerHeartbeatTimeoutAnnotationKey: "10m0s", PackerExpiresAtAnnotationKey: at(-time.Hour)},
+		},
+		{
+			name: "no annotations",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels := tt.labels
+			if labels == nil {
+				labels = map[string]string{PackerBuilderLabelKey: "true"}
+			}
+			vmi := &orkav1.VirtualMachineInstance{
+				ObjectMeta: metav1.ObjectMeta{Name: "packer-1", Labels: labels, Annotations: tt.annotations},
+			}
+			if reason, got := builderVmAbandoned(vmi, now); got != tt.want {
+				t.Errorf("builderVmAbandoned() = %v (%s), want %v", got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuilderVmAnnotations(t *testing.T) {
+	now := time.Now()
+
+	config := &Config{OrkaVMBuilderTTL: 60, OrkaVMHeartbeatTimeout: 15}
+	annotations := builderVmAnnotations(config, now)
+	if got := annotations[PackerHeartbeatTimeoutAnnotationKey]; got != "15m0s" {
+		t.Errorf("heartbeat timeout annotation = %q, want %q", got, "15m0s")
+	}
+	if _, ok := annotations[PackerKeepAnnotationKey]; ok {
+		t.Errorf("VM is marked as kept without no_delete_vm")
+	}
+	vmi := &orkav1.VirtualMachineInstance{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{PackerBuilderLabelKey: "true"}, Annotations: annotations},
+	}
+	if _, abandoned := builderVmAbandoned(vmi, now.Add(10*time.Minute)); abandoned {
+		t.Errorf("VM is abandoned within the heartbeat timeout")
+	}
+	if _, abandoned := builderVmAbandoned(vmi, now.Add(16*time.Minute)); !abandoned {
+		t.Errorf("VM is not abandoned after the heartbeat timeout")
+	}
+
+	config.NoDeleteVM = true
+	vmi.Annotations = builderVmAnnotations(config, now)
+	if _, abandoned := builderVmAbandoned(vmi, now.Add(48*time.Hour)); abandoned {
+		t.Errorf("VM kept by no_delete_vm is abandoned")
+	}
+}
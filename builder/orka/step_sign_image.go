@@ -0,0 +1,194 @@
+package orka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/models"
+	builderVersion "github.com/macstadium/packer-plugin-macstadium-orka/version"
+)
+
+const (
+	provenanceBuilderID = "https://github.com/macstadium/packer-plugin-macstadium-orka"
+	provenanceBuildType = "https://github.com/macstadium/packer-plugin-macstadium-orka/build@v1"
+)
+
+// stepSignImage signs the pushed image with a cosign key and attaches a SLSA provenance attestation to it.
+// Signatures and attestations are stored in the image repository the way cosign stores them, so they can be
+// verified with `cosign verify` and `cosign verify-attestation`. Nothing is uploaded to the Rekor transparency
+// log, so verification needs `--insecure-ignore-tlog`.
+type stepSignImage struct{}
+
+func (s *stepSignImage) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	config := state.Get(StateConfig).(*Config)
+	ui := state.Get(StateUi).(packer.Ui)
+
+	if config.NoCreateImage {
+		return multistep.ActionContinue
+	}
+
+	digest, ok := state.GetOk(StateImageDigest)
+	if !ok {
+		err := fmt.Errorf("cannot sign image [%s] without the digest of the pushed image", config.ImageName)
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	if err := signImage(ctx, state, config, digest.(string)); err != nil {
+		state.Put("error", err)
+		ui.Error(err.Error())
+		return multistep.ActionHalt
+	}
+
+	return multistep.ActionContinue
+}
+
+func (s *stepSignImage) Cleanup(multistep.StateBag) {
+}
+
+func signImage(ctx context.Context, state multistep.StateBag, config *Config, digest string) error {
+	ui := state.Get(StateUi).(packer.Ui)
+
+	key, err := loadSigningKey(config.ImageSigningKey, config.ImageSigningKeyPassword)
+	if err != nil {
+		return err
+	}
+
+	named, err := reference.ParseNamed(config.ImageName)
+	if err != nil {
+		return err
+	}
+	repository := reference.TrimNamed(named).String()
+	registry := newRegistryClient(named, &config.ImageRegistryCredentials)
+
+	ui.Say(fmt.Sprintf("Signing image [%s@%s]", repository, digest))
+
+	payload, err := cosignSignaturePayload(repository, digest)
+	if err != nil {
+		return err
+	}
+	signature, err := signPayload(key, payload)
+	if err != nil {
+		return err
+	}
+	annotations := map[string]string{cosignSignatureAnnotationKey: signature}
+	if err := attachCosignLayer(ctx, registry, digest, cosignSignatureTagExt, cosignSignatureMediaType, payload, annotations); err != nil {
+		return fmt.Errorf("failed to sign image [%s]: %w", config.ImageName, err)
+	}
+
+	ui.Say(fmt.Sprintf("image [%s] signed successfully", config.ImageName))
+
+	if !config.ImageProvenance {
+		return nil
+	}
+
+	ui.Say(fmt.Sprintf("Attaching provenance attestation to image [%s@%s]", repository, digest))
+
+	statement, err := json.Marshal(provenanceStatement(ctx, state, config, repository, digest))
+	if err != nil {
+		return err
+	}
+	envelope, err := dsseEnvelope(key, statement)
+	if err != nil {
+		return err
+	}
+	// The signature of an attestation is in its envelope, but cosign expects the annotation on every layer.
+	annotations = map[string]string{
+		cosignSignatureAnnotationKey: "",
+		predicateTypeKey:             slsaProvenanceV02Type,
+	}
+	if err := attachCosignLayer(ctx, registry, digest, cosignAttestationTagExt, dsseMediaType, envelope, annotations); err != nil {
+		return fmt.Errorf("failed to attach provenance attestation to image [%s]: %w", config.ImageName, err)
+	}
+
+	ui.Say(fmt.Sprintf("provenance attestation attached to image [%s] successfully", config.ImageName))
+	return nil
+}
+
+// provenanceStatement returns an in-toto statement with a SLSA v0.2 provenance predicate describing
+// the Packer build, the source image and the builder VM of the image.
+func provenanceStatement(ctx context.Context, state multistep.StateBag, config *Config, repository, digest string) map[string]interface{} {
+	variables := map[string]string{}
+	for name, value := range config.PackerUserVars {
+		if !contains(config.PackerSensitiveVars, name) {
+			variables[name] = value
+		}
+	}
+
+	environment := map[string]interface{}{
+		"orka_endpoint":             config.OrkaEndpoint,
+		"orka_vm_builder_name":      config.OrkaVMBuilderName,
+		"orka_vm_builder_namespace": config.OrkaVMBuilderNamespace,
+	}
+	if info, ok := state.GetOk(StateVmInfo); ok {
+		environment["vm_node_name"] = info.(models.OrkaVMInfoModel).NodeName
+	}
+
+	return map[string]interface{}{
+		"_type":         inTotoStatementType,
+		"predicateType": slsaProvenanceV02Type,
+		"subject": []map[string]interface{}{
+			{"name": repository, "digest": map[string]string{"sha256": strings.TrimPrefix(digest, "sha256:")}},
+		},
+		"predicate": map[string]interface{}{
+			"builder":   map[string]string{"id": fmt.Sprintf("%s@%s", provenanceBuilderID, builderVersion.PluginVersion.String())},
+			"buildType": provenanceBuildType,
+			"invocation": map[string]interface{}{
+				"parameters": map[string]interface{}{
+					"packer_build_name":   config.PackerBuildName,
+					"packer_builder_type": config.PackerBuilderType,
+					"packer_core_version": config.PackerCoreVersion,
+					"variables":           variables,
+					"source_image":        config.SourceImage,
+					"image_name":          config.ImageName,
+				},
+				"environment": environment,
+			},
+			"metadata": map[string]interface{}{
+				"buildInvocationId": config.OrkaVMBuilderBuildID,
+				"buildFinishedOn":   time.Now().UTC().Format(time.RFC3339),
+				"completeness": map[string]bool{
+					"parameters":  false,
+					"environment": false,
+					"materials":   false,
+				},
+				"reproducible": false,
+			},
+			"materials": []map[string]interface{}{sourceImageMaterial(ctx, config)},
+		},
+	}
+}
+
+// sourceImageMaterial describes the source image. Pulled OCI images include their digest if it can be resolved.
+func sourceImageMaterial(ctx context.Context, config *Config) map[string]interface{} {
+	material := map[string]interface{}{"uri": config.SourceImage}
+	if !config.SourceImagePull {
+		return material
+	}
+
+	named, err := reference.ParseNormalizedNamed(config.SourceImage)
+	if err != nil {
+		return material
+	}
+	named = reference.TagNameOnly(named)
+	material["uri"] = named.String()
+
+	var tagOrDigest string
+	switch r := named.(type) {
+	case reference.Digested:
+		tagOrDigest = r.Digest().String()
+	case reference.Tagged:
+		tagOrDigest = r.Tag()
+	}
+	if digest, err := newRegistryClient(named, &RegistryCredentials{}).resolveDigest(ctx, tagOrDigest); err == nil {
+		material["digest"] = map[string]string{"sha256": strings.TrimPrefix(digest, "sha256:")}
+	}
+	return material
+}
@@ -23,6 +23,7 @@ func (s *stepSyncDisk) Run(ctx context.Context, state multistep.StateBag) multis
 	var stderr bytes.Buffer
 
 	ui.Say("Syncing disk changes...")
+	emitEvent(state, EventSyncStart, "", nil)
 
 	// Start the command
 	cmd := packer.RemoteCmd{Command: "sync", Stderr: &stderr}
@@ -43,6 +44,8 @@ func (s *stepSyncDisk) Run(ctx context.Context, state multistep.StateBag) multis
 		return multistep.ActionHalt
 	}
 
+	emitEvent(state, EventSyncDone, EventSyncStart, nil)
+
 	// Continue processing
 	return multistep.ActionContinue
 }
@@ -0,0 +1,211 @@
+package orka
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+
+	"github.com/hashicorp/packer-plugin-sdk/multistep"
+	"github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/models"
+	builderVersion "github.com/macstadium/packer-plugin-macstadium-orka/version"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StateTracer holds the tracer of the build, if tracing is enabled.
+const StateTracer = "tracer"
+
+const (
+	tracingServiceName = "packer-plugin-macstadium-orka"
+	tracingScopeName   = "github.com/macstadium/packer-plugin-macstadium-orka/builder/orka"
+	otlpTracesPath     = "/v1/traces"
+)
+
+// tracer records the spans of a build with OpenTelemetry and exports them to the OTLP/HTTP endpoint
+// and the file, whichever are set. A nil tracer records nothing.
+type tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	root     trace.Span
+	file     *os.File
+
+	mu sync.Mutex
+	// cleanup is the span of the step being cleaned up. Cleanups get no context, so their calls are
+	// recorded as its children.
+	cleanup trace.Span
+}
+
+// newTracer sets up the exporters of the build and starts its root span.
+func newTracer(ctx context.Context, config *Config, name string, attributes ...attribute.KeyValue) (*tracer, error) {
+	t := &tracer{}
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", tracingServiceName),
+			attribute.String("service.version", builderVersion.PluginVersion.FormattedVersion()),
+		)),
+	}
+
+	if config.TracingEndpoint != "" {
+		endpoint, err := url.Parse(config.TracingEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tracing endpoint: %w", err)
+		}
+		if endpoint.Path == "" || endpoint.Path == "/" {
+			endpoint.Path = otlpTracesPath
+		}
+		exporterOptions := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(endpoint.Host),
+			otlptracehttp.WithURLPath(endpoint.Path),
+			otlptracehttp.WithHeaders(config.TracingHeaders),
+		}
+		if endpoint.Scheme == "http" {
+			exporterOptions = append(exporterOptions, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, exporterOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+
+	if config.TracingFile != "" {
+		f, err := os.OpenFile(config.TracingFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create trace file exporter: %w", err)
+		}
+		t.file = f
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+
+	t.provider = sdktrace.NewTracerProvider(options...)
+	t.tracer = t.provider.Tracer(tracingScopeName)
+	_, t.root = t.tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+	return t, nil
+}
+
+// start starts a span that is a child of the span in ctx, or of the root span, and returns a
+// context holding the new span.
+func (t *tracer) start(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if t == nil {
+		// A context without a span holds a span that records nothing.
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		t.mu.Lock()
+		parent := t.root
+		if t.cleanup != nil {
+			parent = t.cleanup
+		}
+		t.mu.Unlock()
+		ctx = trace.ContextWithSpan(ctx, parent)
+	}
+	return t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
+
+func (t *tracer) setCleanup(s trace.Span) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cleanup = s
+}
+
+// shutdown exports the spans not exported yet and closes the trace file. Spans still running are
+// not exported.
+func (t *tracer) shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	err := t.provider.Shutdown(ctx)
+	if t.file != nil {
+		if closeErr := t.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// endSpan ends the span, which failed if err is not nil.
+func endSpan(s trace.Span, err error) {
+	if err != nil {
+		s.RecordError(err)
+		s.SetStatus(codes.Error, err.Error())
+	} else {
+		s.SetStatus(codes.Ok, "")
+	}
+	s.End()
+}
+
+// startSpan starts a child span of the span in ctx. It records nothing if ctx holds no span, such as
+// when tracing is disabled.
+func startSpan(ctx context.Context, name string, kind trace.SpanKind, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(tracingScopeName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+}
+
+// tracedStep runs a step in a span named after it.
+type tracedStep struct {
+	name string
+	step multistep.Step
+}
+
+func (s *tracedStep) Run(ctx context.Context, state multistep.StateBag) multistep.StepAction {
+	t := stateTracer(state)
+	config := state.Get(StateConfig).(*Config)
+
+	ctx, sp := t.start(ctx, s.name, trace.SpanKindInternal,
+		attribute.String("packer.step", s.name),
+		attribute.String("vm.name", config.OrkaVMBuilderName),
+		attribute.String("vm.namespace", config.OrkaVMBuilderNamespace),
+		attribute.String("image.name", config.ImageName),
+	)
+
+	action := s.step.Run(ctx, state)
+
+	if info, ok := state.GetOk(StateVmInfo); ok {
+		sp.SetAttributes(attribute.String("vm.node", info.(models.OrkaVMInfoModel).NodeName))
+	}
+	var err error
+	if action == multistep.ActionHalt {
+		if rawErr, ok := state.GetOk("error"); ok {
+			err = rawErr.(error)
+		} else {
+			err = fmt.Errorf("step %s halted", s.name)
+		}
+	}
+	endSpan(sp, err)
+
+	return action
+}
+
+func (s *tracedStep) Cleanup(state multistep.StateBag) {
+	t := stateTracer(state)
+	_, sp := t.start(context.Background(), s.name+" cleanup", trace.SpanKindInternal)
+	t.setCleanup(sp)
+	s.step.Cleanup(state)
+	t.setCleanup(nil)
+	endSpan(sp, nil)
+}
+
+// stateTracer returns the tracer of the build, or nil if tracing is disabled.
+func stateTracer(state multistep.StateBag) *tracer {
+	if t, ok := state.GetOk(StateTracer); ok {
+		return t.(*tracer)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package orka
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/models"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// tracingOrkaClient records a span for every call of the wrapped client, as a child of the span of
+// the calling step.
+type tracingOrkaClient struct {
+	OrkaClient
+
+	tracer *tracer
+}
+
+func (c *tracingOrkaClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	ctx, sp := c.tracer.start(ctx, "orka.Get", trace.SpanKindClient, objectAttributes(obj, key.Namespace, key.Name)...)
+	err := c.OrkaClient.Get(ctx, key, obj, opts...)
+	if apierrors.IsNotFound(err) {
+		// Checking whether an object exists is not a failure.
+		sp.SetAttributes(attribute.Bool("orka.not_found", true))
+		endSpan(sp, nil)
+		return err
+	}
+	endSpan(sp, err)
+	return err
+}
+
+func (c *tracingOrkaClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	ctx, sp := c.tracer.start(ctx, "orka.List", trace.SpanKindClient,
+		attribute.String("orka.kind", fmt.Sprintf("%T", list)),
+		attribute.String("orka.namespace", listOpts.Namespace),
+	)
+	err := c.OrkaClient.List(ctx, list, opts...)
+	endSpan(sp, err)
+	return err
+}
+
+func (c *tracingOrkaClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	ctx, sp := c.tracer.start(ctx, "orka.Create", trace.SpanKindClient, objectAttributes(obj, obj.GetNamespace(), obj.GetName())...)
+	err := c.OrkaClient.Create(ctx, obj, opts...)
+	if err == nil && obj.GetName() != "" {
+		// Generated names are only known once the object is created.
+		sp.SetAttributes(attribute.String("orka.name", obj.GetName()))
+	}
+	endSpan(sp, err)
+	return err
+}
+
+func (c *tracingOrkaClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	ctx, sp := c.tracer.start(ctx, "orka.Delete", trace.SpanKindClient, objectAttributes(obj, obj.GetNamespace(), obj.GetName())...)
+	err := c.OrkaClient.Delete(ctx, obj, opts...)
+	endSpan(sp, err)
+	return err
+}
+
+func (c *tracingOrkaClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	ctx, sp := c.tracer.start(ctx, "orka.Patch", trace.SpanKindClient, objectAttributes(obj, obj.GetNamespace(), obj.GetName())...)
+	err := c.OrkaClient.Patch(ctx, obj, patch, opts...)
+	endSpan(sp, err)
+	return err
+}
+
+func (c *tracingOrkaClient) WaitForVm(ctx context.Context, namespace, name string, timeout int) (models.OrkaVMInfoModel, error) {
+	ctx, sp := c.tracer.start(ctx, "orka.WaitForVm", trace.SpanKindClient,
+		attribute.String("vm.name", name),
+		attribute.String("vm.namespace", namespace),
+	)
+	info, err := c.OrkaClient.WaitForVm(ctx, namespace, name, timeout)
+	if err == nil {
+		sp.SetAttributes(
+			attribute.String("vm.node", info.NodeName),
+			attribute.String("vm.phase", "Running"),
+		)
+	}
+	endSpan(sp, err)
+	return info, err
+}
+
+func (c *tracingOrkaClient) WaitForImage(ctx context.Context, name string, timeout int) error {
+	ctx, sp := c.tracer.start(ctx, "orka.WaitForImage", trace.SpanKindClient,
+		attribute.String("image.name", name),
+	)
+	err := c.OrkaClient.WaitForImage(ctx, name, timeout)
+	if err == nil {
+		sp.SetAttributes(attribute.String("image.state", "Ready"))
+	}
+	endSpan(sp, err)
+	return err
+}
+
+func (c *tracingOrkaClient) WaitForPush(ctx context.Context, namespace, name string, timeout int) error {
+	ctx, sp := c.tracer.start(ctx, "orka.WaitForPush", trace.SpanKindClient,
+		attribute.String("push.name", name),
+		attribute.String("push.namespace", namespace),
+	)
+	err := c.OrkaClient.WaitForPush(ctx, namespace, name, timeout)
+	endSpan(sp, err)
+	return err
+}
+
+// objectAttributes returns the span attributes of a call on an Orka object.
+func objectAttributes(obj client.Object, namespace, name string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("orka.kind", fmt.Sprintf("%T", obj)),
+		attribute.String("orka.namespace", namespace),
+		attribute.String("orka.name", name),
+	}
+}
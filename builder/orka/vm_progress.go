@@ -0,0 +1,192 @@
+package orka
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// vmProgress reports what happens to the builder VM while it is being deployed: its phase, the node it was
+// scheduled on, the Kubernetes events of the VM and its pod, and whether the source image is cached on the node.
+type vmProgress struct {
+	ui          packer.Ui
+	buildEvents *eventLog
+	orkaClient  OrkaClient
+	namespace   string
+	name        string
+	image       string
+
+	phase       orkav1.VMPhase
+	nodeName    string
+	pods        []string
+	imageState  orkav1.OrkaImageState
+	imageMissed bool
+	events      map[types.UID]string
+}
+
+// startVmProgress reports the progress of the VM deployment every interval until the returned function is called.
+func startVmProgress(ctx context.Context, ui packer.Ui, buildEvents *eventLog, orkaClient OrkaClient, config *Config, image string) func() {
+	p := &vmProgress{
+		ui:          ui,
+		buildEvents: buildEvents,
+		orkaClient:  orkaClient,
+		namespace:   config.OrkaVMBuilderNamespace,
+		name:        config.OrkaVMBuilderName,
+		image:       image,
+		events:      map[types.UID]string{},
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(time.Duration(config.OrkaWaitPollInterval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			if err := p.report(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("failed to report the progress of VM [%s]: %s", p.name, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func (p *vmProgress) report(ctx context.Context) error {
+	vmi := &orkav1.VirtualMachineInstance{}
+	if err := p.orkaClient.Get(ctx, client.ObjectKey{Namespace: p.namespace, Name: p.name}, vmi); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if vmi.Status.Phase != "" && vmi.Status.Phase != p.phase {
+		p.phase = vmi.Status.Phase
+		p.ui.Say(fmt.Sprintf("VM [%s] is %s", p.name, p.phase))
+		p.buildEvents.emit(EventVmPhase, EventVmCreate, map[string]interface{}{"vm_name": p.name, "phase": p.phase})
+	}
+
+	if vmi.Status.NodeName != "" && vmi.Status.NodeName != p.nodeName {
+		p.nodeName = vmi.Status.NodeName
+		p.ui.Say(fmt.Sprintf("VM [%s] was scheduled on node [%s]", p.name, p.nodeName))
+		p.buildEvents.emit(EventVmScheduled, EventVmCreate, map[string]interface{}{"vm_name": p.name, "node": p.nodeName})
+	}
+
+	if err := p.reportEvents(ctx, vmi); err != nil {
+		return err
+	}
+
+	if p.nodeName != "" {
+		return p.reportImageCache(ctx)
+	}
+	return nil
+}
+
+// reportEvents prints the events of the VM and of the pods it owns that were not printed yet.
+func (p *vmProgress) reportEvents(ctx context.Context, vmi *orkav1.VirtualMachineInstance) error {
+	if len(p.pods) == 0 {
+		pods := &corev1.PodList{}
+		if err := p.orkaClient.List(ctx, pods, client.InNamespace(p.namespace)); err != nil {
+			return err
+		}
+		for _, pod := range pods.Items {
+			for _, owner := range pod.OwnerReferences {
+				if owner.UID == vmi.UID && pod.Name != vmi.Name {
+					p.pods = append(p.pods, pod.Name)
+				}
+			}
+		}
+	}
+
+	names := append([]string{vmi.Name}, p.pods...)
+	var events []corev1.Event
+	for _, name := range names {
+		list := &corev1.EventList{}
+		if err := p.orkaClient.List(ctx, list, client.InNamespace(p.namespace), client.MatchingFields{"involvedObject.name": name}); err != nil {
+			return err
+		}
+
+		for _, event := range list.Items {
+			if p.events[event.UID] == event.Message {
+				continue
+			}
+			p.events[event.UID] = event.Message
+			events = append(events, event)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+	for _, event := range events {
+		p.ui.Say(fmt.Sprintf("%s [%s/%s] %s: %s", event.Type, event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Reason, event.Message))
+	}
+
+	return nil
+}
+
+// reportImageCache prints the cache state of the source image on the node the VM was scheduled on.
+func (p *vmProgress) reportImageCache(ctx context.Context) error {
+	node := &orkav1.OrkaNode{}
+	if err := p.orkaClient.Get(ctx, client.ObjectKey{Namespace: DefaultOrkaNamespace, Name: p.nodeName}, node); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	image := findCachedImage(node, p.image)
+	if image == nil {
+		if !p.imageMissed {
+			p.imageMissed = true
+			p.ui.Say(fmt.Sprintf("Image [%s] is not cached on node [%s] yet", p.image, p.nodeName))
+		}
+		return nil
+	}
+
+	if image.OrkaImageState == p.imageState {
+		return nil
+	}
+	p.imageState = image.OrkaImageState
+
+	switch image.OrkaImageState {
+	case orkav1.OrkaImageStateCaching:
+		p.ui.Say(fmt.Sprintf("Image [%s] is being cached on node [%s]", p.image, p.nodeName))
+	case orkav1.OrkaImageStateReady:
+		p.ui.Say(fmt.Sprintf("Image [%s] is cached on node [%s] (%s)", p.image, p.nodeName, formatBytes(image.SizeBytes)))
+	case orkav1.OrkaImageStateFailed:
+		p.ui.Say(fmt.Sprintf("Caching image [%s] on node [%s] failed: %s", p.image, p.nodeName, image.ErrorMessage))
+	}
+	return nil
+}
+
+// findCachedImage returns the cache status of the image on the node, or nil if the node does not know the image.
+func findCachedImage(node *orkav1.OrkaNode, name string) *orkav1.OrkaImageStatus {
+	for i := range node.Status.Images {
+		for _, n := range node.Status.Images[i].Names {
+			if n == name {
+				return &node.Status.Images[i]
+			}
+		}
+	}
+	return nil
+}
+
+func formatBytes(size int64) string {
+	return resource.NewQuantity(size, resource.BinarySI).String()
+}
@@ -0,0 +1,208 @@
+package orka
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// progressClient stores objects like objectClient and lists the given pods and events.
+type progressClient struct {
+	*objectClient
+
+	pods   []corev1.Pod
+	events []corev1.Event
+}
+
+func (c *progressClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	switch list := list.(type) {
+	case *corev1.PodList:
+		list.Items = c.pods
+	case *corev1.EventList:
+		var name string
+		for _, opt := range opts {
+			if fields, ok := opt.(client.MatchingFields); ok {
+				name = fields["involvedObject.name"]
+			}
+		}
+		list.Items = nil
+		for _, event := range c.events {
+			if event.InvolvedObject.Name == name {
+				list.Items = append(list.Items, event)
+			}
+		}
+	}
+	return nil
+}
+
+func TestVmProgressReport(t *testing.T) {
+	const vmUID = types.UID("vm-uid")
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	vmEvent := func(uid types.UID, object, reason, message string, d time.Duration) corev1.Event {
+		return corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{UID: uid},
+			InvolvedObject: corev1.ObjectReference{Kind: "Pod", Name: object},
+			Type:           corev1.EventTypeNormal,
+			Reason:         reason,
+			Message:        message,
+			LastTimestamp:  metav1.NewTime(at.Add(d)),
+		}
+	}
+	cachedImage := func(state orkav1.OrkaImageState) []orkav1.OrkaImageStatus {
+		return []orkav1.OrkaImageStatus{{Names: []string{"other"}}, {Names: []string{"sonoma", "sonoma:latest"}, OrkaImageState: state, SizeBytes: 1 << 30}}
+	}
+
+	steps := []struct {
+		name       string
+		phase      orkav1.VMPhase
+		node       string
+		events     []corev1.Event
+		images     []orkav1.OrkaImageStatus
+		wantSaid   []string
+		wantEvents []string
+	}{
+		{
+			name:       "pending",
+			phase:      orkav1.VMPending,
+			wantSaid:   []string{"VM [vm] is Pending"},
+			wantEvents: []string{EventVmPhase},
+		},
+		{
+			name:  "unchanged",
+			phase: orkav1.VMPending,
+		},
+		{
+			name:       "scheduled",
+			phase:      orkav1.VMPending,
+			node:       "mini-1",
+			wantSaid:   []string{"VM [vm] was scheduled on node [mini-1]", "Image [sonoma] is not cached on node [mini-1] yet"},
+			wantEvents: []string{EventVmScheduled},
+		},
+		{
+			name:  "pod events in order",
+			phase: orkav1.VMPending,
+			node:  "mini-1",
+			events: []corev1.Event{
+				vmEvent("e2", "vm-pod", "Pulling", "Pulling image", 2*time.Second),
+				vmEvent("e1", "vm", "Scheduled", "Assigned to mini-1", time.Second),
+				vmEvent("e3", "unrelated", "Started", "Started", 3*time.Second),
+			},
+			images: cachedImage(orkav1.OrkaImageStateCaching),
+			wantSaid: []string{
+				"Normal [Pod/vm] Scheduled: Assigned to mini-1",
+				"Normal [Pod/vm-pod] Pulling: Pulling image",
+				"Image [sonoma] is being cached on node [mini-1]",
+			},
+		},
+		{
+			name:  "updated event",
+			phase: orkav1.VMPending,
+			node:  "mini-1",
+			events: []corev1.Event{
+				vmEvent("e2", "vm-pod", "Pulling", "Pulling image again", 4*time.Second),
+				vmEvent("e1", "vm", "Scheduled", "Assigned to mini-1", time.Second),
+			},
+			images:   cachedImage(orkav1.OrkaImageStateReady),
+			wantSaid: []string{"Normal [Pod/vm-pod] Pulling: Pulling image again", "Image [sonoma] is cached on node [mini-1] (1Gi)"},
+		},
+		{
+			name:       "running",
+			phase:      orkav1.VMRunning,
+			node:       "mini-1",
+			images:     cachedImage(orkav1.OrkaImageStateReady),
+			wantSaid:   []string{"VM [vm] is Running"},
+			wantEvents: []string{EventVmPhase},
+		},
+	}
+
+	orkaClient := &progressClient{
+		objectClient: newObjectClient(),
+		pods: []corev1.Pod{
+			{ObjectMeta: metav1.ObjectMeta{Name: "vm-pod", OwnerReferences: []metav1.OwnerReference{{UID: vmUID}}}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "other-pod", OwnerReferences: []metav1.OwnerReference{{UID: "other"}}}},
+		},
+	}
+	ui := &packer.MockUi{}
+	buildEvents := newEventLog("build-a")
+	p := &vmProgress{
+		ui:          ui,
+		buildEvents: buildEvents,
+		orkaClient:  orkaClient,
+		namespace:   DefaultOrkaNamespace,
+		name:        "vm",
+		image:       "sonoma",
+		events:      map[types.UID]string{},
+	}
+
+	for _, step := range steps {
+		orkaClient.objects = map[string]client.Object{}
+		orkaClient.Create(context.Background(), &orkav1.VirtualMachineInstance{
+			ObjectMeta: metav1.ObjectMeta{Namespace: DefaultOrkaNamespace, Name: "vm", UID: vmUID},
+			Status:     orkav1.VirtualMachineInstanceStatus{Phase: step.phase, NodeName: step.node},
+		})
+		orkaClient.Create(context.Background(), &orkav1.OrkaNode{
+			ObjectMeta: metav1.ObjectMeta{Namespace: DefaultOrkaNamespace, Name: "mini-1"},
+			Status:     orkav1.OrkaNodeStatus{Images: step.images},
+		})
+		orkaClient.events = step.events
+
+		said := len(ui.SayMessages)
+		// Only the events of this step are recorded.
+		buildEvents.seen = map[string]time.Time{}
+
+		if err := p.report(context.Background()); err != nil {
+			t.Fatalf("%s: report() error = %v", step.name, err)
+		}
+
+		var got []string
+		for _, m := range ui.SayMessages[said:] {
+			got = append(got, m.Message)
+		}
+		if !reflect.DeepEqual(got, step.wantSaid) {
+			t.Errorf("%s: said %q, want %q", step.name, got, step.wantSaid)
+		}
+		for _, event := range []string{EventVmPhase, EventVmScheduled} {
+			if got, want := buildEvents.happened(event), contains(step.wantEvents, event); got != want {
+				t.Errorf("%s: event %s emitted = %v, want %v", step.name, event, got, want)
+			}
+		}
+	}
+}
+
+func TestFindCachedImage(t *testing.T) {
+	node := &orkav1.OrkaNode{Status: orkav1.OrkaNodeStatus{Images: []orkav1.OrkaImageStatus{
+		{Names: []string{"sonoma"}, OrkaImageState: orkav1.OrkaImageStateReady},
+		{Names: []string{"ventura", "ghcr.io/org/ventura:latest"}, OrkaImageState: orkav1.OrkaImageStateCaching},
+	}}}
+
+	tests := []struct {
+		name      string
+		image     string
+		wantState orkav1.OrkaImageState
+		wantFound bool
+	}{
+		{"first name", "sonoma", orkav1.OrkaImageStateReady, true},
+		{"other name", "ghcr.io/org/ventura:latest", orkav1.OrkaImageStateCaching, true},
+		{"not cached", "sequoia", "", false},
+		{"name prefix", "sono", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findCachedImage(node, tt.image)
+			if (got != nil) != tt.wantFound {
+				t.Fatalf("findCachedImage() = %v, want found %v", got, tt.wantFound)
+			}
+			if got != nil && got.OrkaImageState != tt.wantState {
+				t.Errorf("findCachedImage() state = %s, want %s", got.OrkaImageState, tt.wantState)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	WaitStrategyWatch = "watch"
+	WaitStrategyPoll  = "poll"
+	WaitStrategyAuto  = "auto"
+)
+
+// WaitStrategy describes how RealOrkaClient waits for Orka resources to reach a state.
+type WaitStrategy struct {
+	// One of WaitStrategyWatch, WaitStrategyPoll or WaitStrategyAuto
+	Mode string
+	// Time between two Get requests when polling
+	PollInterval time.Duration
+	// Number of watcher failures after which WaitStrategyAuto falls back to polling
+	MaxWatchFailures int
+}
+
+var errFallbackToPolling = errors.New("too many watcher failures")
+
+// wait runs watchFn or pollFn, depending on the wait strategy, until one of them finishes or the timeout is reached.
+// With WaitStrategyAuto it watches and switches to polling once the watcher failed MaxWatchFailures times,
+// either because the watch could not be established or because it was closed unexpectedly.
+func (c *RealOrkaClient) wait(ctx context.Context, timeout time.Duration, watchFn, pollFn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	switch c.waitStrategy.Mode {
+	case WaitStrategyPoll:
+		return pollFn(ctx)
+	case WaitStrategyAuto:
+		var failures int
+		err := RetryOnWatcherErrorWithTimeout(ctx, timeout, func(ctx context.Context) error {
+			err := watchFn(ctx)
+
+			var watcherErr WatcherError
+			var startErr WatchStartError
+			if !errors.As(err, &watcherErr) && !errors.As(err, &startErr) {
+				return err
+			}
+
+			failures++
+			log.Printf("watcher failed (%d/%d): %s", failures, c.waitStrategy.MaxWatchFailures, err)
+			if failures >= c.waitStrategy.MaxWatchFailures {
+				return errFallbackToPolling
+			}
+			return WatcherError{Err: err}
+		}, 1*time.Second)
+
+		if errors.Is(err, errFallbackToPolling) {
+			log.Printf("falling back to polling every %s", c.waitStrategy.PollInterval)
+			return pollFn(ctx)
+		}
+		return err
+	default:
+		return RetryOnWatcherErrorWithTimeout(ctx, timeout, watchFn, 1*time.Second)
+	}
+}
+
+// watchCursor remembers the resourceVersion last seen by a watch, so a watch that closed
+// unexpectedly can be resumed without losing or replaying events.
+type watchCursor struct {
+	resourceVersion string
+}
+
+// watchUntil watches the objects of the given list type matching opts until check reports that it is done.
+// The watch resumes from the resourceVersion of the cursor. Without one it starts with the current state of
+// the matching objects. A watch that closes unexpectedly returns a WatcherError so it can be retried, and an
+// expired resourceVersion (410 Gone) resets the cursor so the retry starts from the current state again.
+func (c *RealOrkaClient) watchUntil(ctx context.Context, cursor *watchCursor, list client.ObjectList, check func(event watch.Event) (bool, error), opts ...client.ListOption) error {
+	opts = append(opts, &client.ListOptions{Raw: &metav1.ListOptions{
+		ResourceVersion:     cursor.resourceVersion,
+		AllowWatchBookmarks: true,
+	}})
+
+	watcher, err := c.Watch(ctx, list, opts...)
+	if isGone(err) {
+		cursor.resourceVersion = ""
+		return WatcherError{Err: err}
+	} else if err != nil {
+		return WatchStartError{Err: err}
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return WatcherError{Err: errors.New(WatcherClosedError)}
+			}
+
+			if event.Type == watch.Error {
+				err := apierrors.FromObject(event.Object)
+				if isGone(err) {
+					cursor.resourceVersion = ""
+				}
+				return WatcherError{Err: err}
+			}
+
+			if obj, ok := event.Object.(client.Object); ok {
+				cursor.resourceVersion = obj.GetResourceVersion()
+			}
+
+			if event.Type == watch.Bookmark {
+				continue
+			}
+
+			if done, err := check(event); done {
+				return err
+			}
+		}
+	}
+}
+
+func isGone(err error) bool {
+	return apierrors.IsGone(err) || apierrors.IsResourceExpired(err)
+}
+
+// pollUntil calls fn every interval until it reports that it is done or returns an error.
+func pollUntil(ctx context.Context, interval time.Duration, fn func(ctx context.Context) (bool, error)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if done, err := fn(ctx); done || err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollError decides whether an error returned by a Get or List request while polling ends the wait.
+// Missing resources end it, any other error is logged and the next poll is tried.
+func pollError(err error) error {
+	if err == nil || apierrors.IsNotFound(err) {
+		return err
+	}
+
+	log.Printf("poll failed, retrying: %s", err)
+	return nil
+}
@@ -0,0 +1,242 @@
+package orka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// watchClient is a client whose watches replay the given events, or fail with watchErr.
+type watchClient struct {
+	client.WithWatch
+
+	events   []watch.Event
+	watchErr error
+
+	// resourceVersion is the resourceVersion the last watch started from.
+	resourceVersion string
+}
+
+func (c *watchClient) Watch(ctx context.Context, list client.ObjectList, opts ...client.ListOption) (watch.Interface, error) {
+	for _, opt := range opts {
+		if o, ok := opt.(*client.ListOptions); ok && o.Raw != nil {
+			c.resourceVersion = o.Raw.ResourceVersion
+		}
+	}
+	if c.watchErr != nil {
+		return nil, c.watchErr
+	}
+
+	watcher := watch.NewFakeWithChanSize(len(c.events), false)
+	for _, event := range c.events {
+		watcher.Action(event.Type, event.Object)
+	}
+	watcher.Stop()
+	return watcher, nil
+}
+
+func vmWithResourceVersion(resourceVersion string) *orkav1.VirtualMachineInstance {
+	return &orkav1.VirtualMachineInstance{ObjectMeta: metav1.ObjectMeta{Name: "vm", ResourceVersion: resourceVersion}}
+}
+
+func TestWatchUntil(t *testing.T) {
+	gone := apierrors.NewResourceExpired("too old resource version")
+	goneStatus := gone.Status()
+
+	tests := []struct {
+		name                string
+		events              []watch.Event
+		watchErr            error
+		wantErr             func(err error) bool
+		wantChecks          int
+		wantResourceVersion string
+	}{
+		{
+			name: "done",
+			events: []watch.Event{
+				{Type: watch.Added, Object: vmWithResourceVersion("4")},
+				{Type: watch.Modified, Object: vmWithResourceVersion("5")},
+			},
+			wantErr:             func(err error) bool { return err == nil },
+			wantChecks:          2,
+			wantResourceVersion: "5",
+		},
+		{
+			name: "bookmarks are not checked",
+			events: []watch.Event{
+				{Type: watch.Bookmark, Object: vmWithResourceVersion("4")},
+				{Type: watch.Modified, Object: vmWithResourceVersion("5")},
+			},
+			wantErr:             func(err error) bool { return err == nil },
+			wantChecks:          1,
+			wantResourceVersion: "5",
+		},
+		{
+			name: "closed after a bookmark",
+			events: []watch.Event{
+				{Type: watch.Bookmark, Object: vmWithResourceVersion("4")},
+			},
+			wantErr:             func(err error) bool { var e WatcherError; return errors.As(err, &e) },
+			wantResourceVersion: "4",
+		},
+		{
+			name: "expired resource version",
+			events: []watch.Event{
+				{Type: watch.Error, Object: &goneStatus},
+			},
+			wantErr: func(err error) bool { var e WatcherError; return errors.As(err, &e) && isGone(err) },
+		},
+		{
+			name:     "expired resource version when starting",
+			watchErr: gone,
+			wantErr:  func(err error) bool { var e WatcherError; return errors.As(err, &e) && isGone(err) },
+		},
+		{
+			name:                "watch not started",
+			watchErr:            apierrors.NewForbidden(schema.GroupResource{Resource: "virtualmachineinstances"}, "", errors.New("denied")),
+			wantErr:             func(err error) bool { var e WatchStartError; return errors.As(err, &e) },
+			wantResourceVersion: "3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			watcher := &watchClient{events: tt.events, watchErr: tt.watchErr}
+			c := &RealOrkaClient{WithWatch: watcher}
+			cursor := &watchCursor{resourceVersion: "3"}
+
+			checks := 0
+			err := c.watchUntil(context.Background(), cursor, &orkav1.VirtualMachineInstanceList{}, func(event watch.Event) (bool, error) {
+				checks++
+				return event.Object.(client.Object).GetResourceVersion() == "5", nil
+			})
+
+			if !tt.wantErr(err) {
+				t.Errorf("watchUntil() error = %v", err)
+			}
+			if watcher.resourceVersion != "3" {
+				t.Errorf("watch started from resourceVersion %q, want the cursor's", watcher.resourceVersion)
+			}
+			if checks != tt.wantChecks {
+				t.Errorf("checked %d events, want %d", checks, tt.wantChecks)
+			}
+			if cursor.resourceVersion != tt.wantResourceVersion {
+				t.Errorf("cursor resourceVersion = %q, want %q", cursor.resourceVersion, tt.wantResourceVersion)
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	watcherErr := WatcherError{Err: errors.New(WatcherClosedError)}
+	startErr := WatchStartError{Err: errors.New("forbidden")}
+	otherErr := errors.New("VM failed")
+
+	tests := []struct {
+		name        string
+		mode        string
+		maxFailures int
+		watchErrs   []error
+		wantErr     error
+		wantWatches int
+		wantPolled  bool
+	}{
+		{name: "watch", mode: WaitStrategyWatch, watchErrs: []error{nil}, wantWatches: 1},
+		{name: "watch retried", mode: WaitStrategyWatch, watchErrs: []error{watcherErr, nil}, wantWatches: 2},
+		{name: "watch not started", mode: WaitStrategyWatch, watchErrs: []error{startErr}, wantErr: startErr, wantWatches: 1},
+		{name: "poll", mode: WaitStrategyPoll, wantPolled: true},
+		{name: "auto watch", mode: WaitStrategyAuto, maxFailures: 2, watchErrs: []error{nil}, wantWatches: 1},
+		{name: "auto watch retried", mode: WaitStrategyAuto, maxFailures: 2, watchErrs: []error{watcherErr, nil}, wantWatches: 2},
+		{name: "auto falls back to polling", mode: WaitStrategyAuto, maxFailures: 2, watchErrs: []error{watcherErr, startErr}, wantWatches: 2, wantPolled: true},
+		{name: "auto falls back when the watch cannot start", mode: WaitStrategyAuto, maxFailures: 1, watchErrs: []error{startErr}, wantWatches: 1, wantPolled: true},
+		{name: "auto returns other errors", mode: WaitStrategyAuto, maxFailures: 1, watchErrs: []error{otherErr}, wantErr: otherErr, wantWatches: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &RealOrkaClient{waitStrategy: WaitStrategy{Mode: tt.mode, PollInterval: time.Millisecond, MaxWatchFailures: tt.maxFailures}}
+
+			watches := 0
+			polled := false
+			err := c.wait(context.Background(), time.Minute, func(ctx context.Context) error {
+				err := tt.watchErrs[watches]
+				watches++
+				return err
+			}, func(ctx context.Context) error {
+				polled = true
+				return nil
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("wait() error = %v, want %v", err, tt.wantErr)
+			}
+			if watches != tt.wantWatches {
+				t.Errorf("watched %d times, want %d", watches, tt.wantWatches)
+			}
+			if polled != tt.wantPolled {
+				t.Errorf("polled = %v, want %v", polled, tt.wantPolled)
+			}
+		})
+	}
+}
+
+func TestWaitTimeout(t *testing.T) {
+	c := &RealOrkaClient{waitStrategy: WaitStrategy{Mode: WaitStrategyPoll, PollInterval: time.Millisecond}}
+	err := c.wait(context.Background(), 10*time.Millisecond, nil, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestPollUntil(t *testing.T) {
+	failed := errors.New("image failed")
+
+	tests := []struct {
+		name      string
+		doneAfter int
+		err       error
+		wantErr   error
+		wantPolls int
+	}{
+		{name: "done at once", doneAfter: 1, wantPolls: 1},
+		{name: "done later", doneAfter: 3, wantPolls: 3},
+		{name: "failed", doneAfter: 2, err: failed, wantErr: failed, wantPolls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			polls := 0
+			err := pollUntil(context.Background(), time.Millisecond, func(ctx context.Context) (bool, error) {
+				polls++
+				return polls >= tt.doneAfter, tt.err
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("pollUntil() error = %v, want %v", err, tt.wantErr)
+			}
+			if polls != tt.wantPolls {
+				t.Errorf("polled %d times, want %d", polls, tt.wantPolls)
+			}
+		})
+	}
+}
+
+func TestPollUntilCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := pollUntil(ctx, time.Millisecond, func(ctx context.Context) (bool, error) {
+		return false, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("pollUntil() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,208 @@
+// Package orkaimage transfers image files to and from the Orka API. The download and upload endpoints
+// are not provided by older Orka versions, which reject them as unknown. Requests to them then fail
+// with orka.ErrUnsupportedOrkaAPI.
+package orkaimage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/macstadium/packer-plugin-macstadium-orka/builder/orka"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	downloadAPIPath = "/api/v1/namespaces/%s/images/%s/download"
+	uploadAPIPath   = "/api/v1/namespaces/%s/images/%s/upload"
+
+	// uploadOffsetHeader holds the number of bytes of an upload the Orka API has received.
+	uploadOffsetHeader = "Upload-Offset"
+
+	// Number of attempts to upload a chunk before giving up.
+	uploadChunkAttempts = 3
+)
+
+// API sends image file requests to an Orka API endpoint.
+type API struct {
+	Endpoint  string
+	AuthToken string
+}
+
+// Download starts the download of an image file and returns its body and size, -1 if unknown.
+func (a API) Download(ctx context.Context, namespace, name string) (io.ReadCloser, int64, error) {
+	path := fmt.Sprintf(downloadAPIPath, namespace, name)
+	req, err := a.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to send image download request: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		if err := orka.UnsupportedOrkaAPIError(http.MethodGet, path, response.StatusCode, body); err != nil {
+			return nil, 0, fmt.Errorf("image download is not available: %w", err)
+		}
+		return nil, 0, fmt.Errorf("image download failed with status code %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return response.Body, response.ContentLength, nil
+}
+
+// UploadOffset returns the number of bytes of an image file upload the Orka API has received.
+func (a API) UploadOffset(ctx context.Context, namespace, name string) (int64, error) {
+	path := fmt.Sprintf(uploadAPIPath, namespace, name)
+	req, err := a.newRequest(ctx, http.MethodHead, path, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send upload progress request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		if err := orka.UnsupportedOrkaAPIError(http.MethodHead, path, response.StatusCode, nil); err != nil {
+			return 0, fmt.Errorf("image upload is not available: %w", err)
+		}
+		return 0, fmt.Errorf("upload progress request failed with status code %d", response.StatusCode)
+	}
+	return strconv.ParseInt(response.Header.Get(uploadOffsetHeader), 10, 64)
+}
+
+// PrepareUpload creates the image to upload a file of the given size to and returns the offset to upload from.
+// An unfinished upload of a file of the same size to the image is resumed. Other existing images are
+// replaced if overwrite is set, or reported as an error.
+func (a API) PrepareUpload(ctx context.Context, orkaClient orka.OrkaClient, namespace, name, description string, size int64, overwrite bool) (int64, error) {
+	image := &orkav1.Image{}
+	err := orkaClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, image)
+	switch {
+	case err == nil:
+		if image.Spec.SourceType == orkav1.UserUpload && image.Status.State == orkav1.Updating && image.Spec.Size.Value() == size {
+			offset, err := a.UploadOffset(ctx, namespace, name)
+			if err == nil {
+				return offset, nil
+			}
+			log.Printf("failed to get the progress of the unfinished upload to image [%s], restarting it: %s", name, err)
+		} else if !overwrite {
+			return 0, fmt.Errorf("image [%s] already exists, set image_force_overwrite to replace it", name)
+		}
+
+		if err := client.IgnoreNotFound(orkaClient.Delete(ctx, image)); err != nil {
+			return 0, fmt.Errorf("failed to delete existing image [%s]: %w", name, err)
+		}
+	case client.IgnoreNotFound(err) == nil:
+		// The image does not exist yet.
+	default:
+		return 0, fmt.Errorf("failed to get image [%s]: %w", name, err)
+	}
+
+	image = &orkav1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Annotations: map[string]string{
+				orka.DescriptionAnnotationKey: description,
+			},
+		},
+		Spec: orkav1.ImageSpec{
+			SourceType: orkav1.UserUpload,
+		},
+	}
+	image.Spec.Size.Set(size)
+
+	if err := orkaClient.Create(ctx, image); err != nil {
+		return 0, fmt.Errorf("failed to create an image upload request: %w", err)
+	}
+	return 0, nil
+}
+
+// Upload sends the image file read from r, which must be positioned at offset, in chunks of chunkSize
+// bytes. Failed chunks are retried from the offset the Orka API reports, unless the Orka API has no
+// upload endpoint.
+func (a API) Upload(ctx context.Context, r io.Reader, namespace, name string, offset, size int64, chunkSize int) error {
+	chunk := make([]byte, chunkSize)
+	for offset < size {
+		n, err := io.ReadFull(r, chunk)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("failed to read image file: %w", err)
+		}
+
+		data := chunk[:n]
+		for attempt := 1; ; attempt++ {
+			err = a.uploadChunk(ctx, namespace, name, data, offset, size)
+			if err == nil {
+				break
+			}
+			if attempt == uploadChunkAttempts || ctx.Err() != nil || errors.Is(err, orka.ErrUnsupportedOrkaAPI) {
+				return err
+			}
+			log.Printf("failed to upload bytes %d-%d (%d/%d): %s", offset, offset+int64(len(data))-1, attempt, uploadChunkAttempts, err)
+
+			// Part of the chunk may have been received before the failure.
+			if received, err := a.UploadOffset(ctx, namespace, name); err == nil && received > offset && received < offset+int64(len(data)) {
+				data = data[received-offset:]
+				offset = received
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
+		offset += int64(len(data))
+	}
+	return nil
+}
+
+func (a API) uploadChunk(ctx context.Context, namespace, name string, data []byte, offset, size int64) error {
+	path := fmt.Sprintf(uploadAPIPath, namespace, name)
+	req, err := a.newRequest(ctx, http.MethodPut, path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(len(data))-1, size))
+
+	response, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send upload request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		if err := orka.UnsupportedOrkaAPIError(http.MethodPut, path, response.StatusCode, body); err != nil {
+			return fmt.Errorf("image upload is not available: %w", err)
+		}
+		return fmt.Errorf("upload failed with status code %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (a API) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	endpoint, err := url.JoinPath(a.Endpoint, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate image API endpoint: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create image request: %w", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.AuthToken))
+	return req, nil
+}
@@ -0,0 +1,315 @@
+package orkaimage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/macstadium/packer-plugin-macstadium-orka/builder/orka"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestDownload(t *testing.T) {
+	const path = "/api/v1/namespaces/orka-default/images/sonoma/download"
+
+	tests := []struct {
+		name            string
+		handler         http.HandlerFunc
+		want            string
+		wantSize        int64
+		wantErr         string
+		wantUnsupported bool
+	}{
+		{
+			name: "image file",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != path || r.Header.Get("Authorization") != "Bearer token" {
+					http.Error(w, `{"message":"unexpected request"}`, http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Length", "10")
+				io.WriteString(w, "image data")
+			},
+			want:     "image data",
+			wantSize: 10,
+		},
+		{
+			name: "unknown size",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.(http.Flusher).Flush()
+				io.WriteString(w, "image data")
+			},
+			want:     "image data",
+			wantSize: -1,
+		},
+		{
+			name:            "unknown endpoint",
+			handler:         http.NotFound,
+			wantErr:         "image download is not available",
+			wantUnsupported: true,
+		},
+		{
+			name: "missing image",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"kind":"Status","message":"images \"sonoma\" not found"}`, http.StatusNotFound)
+			},
+			wantErr: `status code 404: {"kind":"Status","message":"images \"sonoma\" not found"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			api := API{Endpoint: server.URL, AuthToken: "token"}
+			body, size, err := api.Download(context.Background(), orka.DefaultOrkaNamespace, "sonoma")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				if got := errors.Is(err, orka.ErrUnsupportedOrkaAPI); got != tt.wantUnsupported {
+					t.Errorf("unsupported = %v, want %v", got, tt.wantUnsupported)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+
+			got, err := io.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want || size != tt.wantSize {
+				t.Errorf("Download() = %q, %d, want %q, %d", got, size, tt.want, tt.wantSize)
+			}
+		})
+	}
+}
+
+// imageClient stores the images it is given. Other OrkaClient methods are not used by uploads.
+type imageClient struct {
+	orka.OrkaClient
+
+	images  map[string]*orkav1.Image
+	deleted []string
+}
+
+func (c *imageClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	image, ok := c.images[key.Name]
+	if !ok {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: "images"}, key.Name)
+	}
+	image.DeepCopyInto(obj.(*orkav1.Image))
+	return nil
+}
+
+func (c *imageClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if _, ok := c.images[obj.GetName()]; ok {
+		return apierrors.NewAlreadyExists(schema.GroupResource{Resource: "images"}, obj.GetName())
+	}
+	c.images[obj.GetName()] = obj.(*orkav1.Image).DeepCopy()
+	return nil
+}
+
+func (c *imageClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	if _, ok := c.images[obj.GetName()]; !ok {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: "images"}, obj.GetName())
+	}
+	delete(c.images, obj.GetName())
+	c.deleted = append(c.deleted, obj.GetName())
+	return nil
+}
+
+// uploadServer is an Orka API upload endpoint that keeps the bytes it received.
+type uploadServer struct {
+	mu       sync.Mutex
+	received []byte
+	puts     int
+	// failPut returns whether a PUT fails after receiving the given number of its bytes.
+	failPut func(put int) (int, bool)
+	// headStatus is the status code of upload progress requests if set.
+	headStatus int
+}
+
+func (s *uploadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodHead:
+		if s.headStatus != 0 {
+			w.WriteHeader(s.headStatus)
+			return
+		}
+		w.Header().Set(uploadOffsetHeader, strconv.Itoa(len(s.received)))
+	case http.MethodPut:
+		s.puts++
+		var start, end, size int
+		if _, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil || start != len(s.received) {
+			http.Error(w, `{"message":"unexpected range"}`, http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		if len(data) != end-start+1 {
+			http.Error(w, `{"message":"unexpected length"}`, http.StatusBadRequest)
+			return
+		}
+		if s.failPut != nil {
+			if n, fail := s.failPut(s.puts); fail {
+				s.received = append(s.received, data[:n]...)
+				http.Error(w, `{"message":"connection reset"}`, http.StatusBadGateway)
+				return
+			}
+		}
+		s.received = append(s.received, data...)
+	}
+}
+
+func TestPrepareUpload(t *testing.T) {
+	const size = 10
+	upload := func(state orkav1.State, size int64) *orkav1.Image {
+		image := &orkav1.Image{
+			ObjectMeta: metav1.ObjectMeta{Namespace: orka.DefaultOrkaNamespace, Name: "sonoma"},
+			Spec:       orkav1.ImageSpec{SourceType: orkav1.UserUpload},
+			Status:     orkav1.ImageStatus{State: state},
+		}
+		image.Spec.Size.Set(size)
+		return image
+	}
+
+	tests := []struct {
+		name        string
+		existing    *orkav1.Image
+		received    int
+		headStatus  int
+		overwrite   bool
+		want        int64
+		wantErr     string
+		wantDeleted bool
+	}{
+		{name: "new image"},
+		{name: "resume", existing: upload(orkav1.Updating, size), received: 6, want: 6},
+		{name: "resume without progress", existing: upload(orkav1.Updating, size), headStatus: http.StatusInternalServerError, wantDeleted: true},
+		{name: "unfinished upload of another file", existing: upload(orkav1.Updating, 20), wantErr: "already exists"},
+		{name: "existing image", existing: upload(orkav1.Ready, size), wantErr: "already exists"},
+		{name: "overwrite", existing: upload(orkav1.Ready, size), overwrite: true, wantDeleted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(&uploadServer{received: make([]byte, tt.received), headStatus: tt.headStatus})
+			defer server.Close()
+
+			c := &imageClient{images: map[string]*orkav1.Image{}}
+			if tt.existing != nil {
+				c.images["sonoma"] = tt.existing
+			}
+
+			api := API{Endpoint: server.URL, AuthToken: "token"}
+			offset, err := api.PrepareUpload(context.Background(), c, orka.DefaultOrkaNamespace, "sonoma", "Uploaded", size, tt.overwrite)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if offset != tt.want {
+				t.Errorf("offset = %d, want %d", offset, tt.want)
+			}
+			if deleted := len(c.deleted) > 0; deleted != tt.wantDeleted {
+				t.Errorf("deleted = %v, want %v", c.deleted, tt.wantDeleted)
+			}
+
+			image := c.images["sonoma"]
+			if image == nil || image.Spec.SourceType != orkav1.UserUpload || image.Spec.Size.Value() != size {
+				t.Errorf("image = %+v, want an upload of %d bytes", image, size)
+			}
+		})
+	}
+}
+
+func TestUpload(t *testing.T) {
+	data := []byte("0123456789")
+
+	tests := []struct {
+		name     string
+		offset   int
+		failPut  func(put int) (int, bool)
+		wantPuts int
+		wantErr  string
+	}{
+		{name: "chunks", wantPuts: 3},
+		{name: "resume", offset: 6, wantPuts: 1},
+		{
+			name: "retry the rest of a partly received chunk",
+			// The second chunk fails after 2 of its 4 bytes, and only the other 2 are sent again.
+			failPut:  func(put int) (int, bool) { return 2, put == 2 },
+			wantPuts: 4,
+		},
+		{
+			name:     "too many failures",
+			failPut:  func(put int) (int, bool) { return 0, put >= 2 },
+			wantPuts: 1 + uploadChunkAttempts,
+			wantErr:  "status code 502",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &uploadServer{received: append([]byte{}, data[:tt.offset]...), failPut: tt.failPut}
+			server := httptest.NewServer(s)
+			defer server.Close()
+
+			api := API{Endpoint: server.URL, AuthToken: "token"}
+			err := api.Upload(context.Background(), bytes.NewReader(data[tt.offset:]), orka.DefaultOrkaNamespace, "sonoma", int64(tt.offset), int64(len(data)), 4)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else if !bytes.Equal(s.received, data) {
+				t.Errorf("received %q, want %q", s.received, data)
+			}
+			if s.puts != tt.wantPuts {
+				t.Errorf("sent %d chunks, want %d", s.puts, tt.wantPuts)
+			}
+		})
+	}
+}
+
+func TestUploadUnsupported(t *testing.T) {
+	puts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			puts++
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	api := API{Endpoint: server.URL, AuthToken: "token"}
+	err := api.Upload(context.Background(), strings.NewReader("image data"), orka.DefaultOrkaNamespace, "sonoma", 0, 10, 4)
+	if !errors.Is(err, orka.ErrUnsupportedOrkaAPI) {
+		t.Fatalf("error = %v, want %v", err, orka.ErrUnsupportedOrkaAPI)
+	}
+	// A missing endpoint is not retried.
+	if puts != 1 {
+		t.Errorf("sent %d chunks, want 1", puts)
+	}
+}
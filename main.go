@@ -6,12 +6,20 @@ import (
 
 	"github.com/hashicorp/packer-plugin-sdk/plugin"
 	"github.com/macstadium/packer-plugin-macstadium-orka/builder/orka"
+	"github.com/macstadium/packer-plugin-macstadium-orka/post-processor/export"
+	"github.com/macstadium/packer-plugin-macstadium-orka/post-processor/imagecopy"
+	"github.com/macstadium/packer-plugin-macstadium-orka/post-processor/tag"
+	"github.com/macstadium/packer-plugin-macstadium-orka/post-processor/upload"
 	builderVersion "github.com/macstadium/packer-plugin-macstadium-orka/version"
 )
 
 func main() {
 	pps := plugin.NewSet()
 	pps.RegisterBuilder(plugin.DEFAULT_NAME, new(orka.Builder))
+	pps.RegisterPostProcessor("copy", new(imagecopy.PostProcessor))
+	pps.RegisterPostProcessor("export", new(export.PostProcessor))
+	pps.RegisterPostProcessor("tag", new(tag.PostProcessor))
+	pps.RegisterPostProcessor("upload", new(upload.PostProcessor))
 	pps.SetVersion(builderVersion.PluginVersion)
 	err := pps.Run()
 	if err != nil {
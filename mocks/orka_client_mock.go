@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	"github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/models"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -28,6 +31,14 @@ var ErrorTypes = []string{
 }
 
 func (m OrkaClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	// The mock cluster has no images, so image names never conflict.
+	if _, ok := obj.(*orkav1.Image); ok {
+		return apierrors.NewNotFound(orkav1.GroupVersion.WithResource("images").GroupResource(), key.Name)
+	}
+	return nil
+}
+
+func (m OrkaClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
 	return nil
 }
 
@@ -46,15 +57,26 @@ func (m OrkaClient) Delete(ctx context.Context, obj client.Object, opts ...clien
 	return nil
 }
 
-func (m OrkaClient) WaitForVm(ctx context.Context, namespace, name string, timeout int) (string, int, error) {
+func (m OrkaClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return nil
+}
+
+func (m OrkaClient) WaitForVm(ctx context.Context, namespace, name string, timeout int) (models.OrkaVMInfoModel, error) {
 	if m.ErrorType == errorTypeWaitForVm {
-		return "", 0, errors.New(m.ErrorType)
+		return models.OrkaVMInfoModel{}, errors.New(m.ErrorType)
 	}
 
-	return "1.2.3.4", 1234, nil
+	return models.OrkaVMInfoModel{
+		IP:              "1.2.3.4",
+		HostIP:          "1.2.3.4",
+		NodeName:        "mock-node",
+		SSHPort:         1234,
+		VNCPort:         5999,
+		ScreenSharePort: 5900,
+	}, nil
 }
 
-func (m OrkaClient) WaitForImage(ctx context.Context, name string) error {
+func (m OrkaClient) WaitForImage(ctx context.Context, name string, timeout int) error {
 	if m.ErrorType == errorTypeWaitForImage {
 		return errors.New(m.ErrorType)
 	}
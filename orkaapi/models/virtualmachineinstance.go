@@ -9,3 +9,23 @@ type OrkaVMPushRequestModel struct {
 type OrkaVMPushResponseModel struct {
 	JobName string `json:"jobName"`
 }
+
+// OrkaVMInfoModel describes a running virtual machine and the ports it can be reached on.
+type OrkaVMInfoModel struct {
+	// The IP of the virtual machine, or of its node if the virtual machine has no IP of its own
+	IP string `json:"ip"`
+	// The IP of the node on which the virtual machine is running
+	HostIP string `json:"hostIP"`
+	// The name of the node on which the virtual machine is running
+	NodeName string `json:"nodeName"`
+	// The amount of memory allocated to the virtual machine
+	Memory string `json:"memory"`
+	// The SSH port of the virtual machine, 0 if not available
+	SSHPort int `json:"sshPort"`
+	// The VNC port of the virtual machine, 0 if not available
+	VNCPort int `json:"vncPort"`
+	// The Screen Sharing port of the virtual machine, 0 if not available
+	ScreenSharePort int `json:"screenSharePort"`
+	// Any port warnings that have occurred during the deployment
+	PortWarnings string `json:"portWarnings"`
+}
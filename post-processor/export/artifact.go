@@ -0,0 +1,58 @@
+package export
+
+import (
+	"fmt"
+	"os"
+)
+
+// Artifact represents an Orka image exported to a local file or an S3 bucket.
+type Artifact struct {
+	// id is the local path or the s3:// URL of the exported image.
+	id        string
+	imageName string
+	files     []string
+
+	// checksums holds the `md5` and `sha256` checksums of the exported image.
+	checksums map[string]string
+}
+
+// BuilderId returns the post-processor Id.
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+// Destroy deletes the exported image if it is a local file.
+func (a *Artifact) Destroy() error {
+	for _, f := range a.files {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Files returns the local file of the exported image.
+func (a *Artifact) Files() []string {
+	return a.files
+}
+
+// Id returns the local path or the s3:// URL of the exported image.
+func (a *Artifact) Id() string {
+	return a.id
+}
+
+// State returns the `image_name` and the `md5` and `sha256` checksums of the exported image.
+func (a *Artifact) State(name string) interface{} {
+	if name == "image_name" {
+		return a.imageName
+	}
+	if checksum, ok := a.checksums[name]; ok {
+		return checksum
+	}
+	return nil
+}
+
+// String returns the string representation of the artifact.
+func (a *Artifact) String() string {
+	return fmt.Sprintf("Orka image [%s] exported to [%s] (sha256 %s)", a.imageName, a.id, a.checksums["sha256"])
+}
@@ -0,0 +1,91 @@
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+package export
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	OrkaEndpoint  string `mapstructure:"orka_endpoint" required:"true"`
+	OrkaAuthToken string `mapstructure:"orka_auth_token" required:"true"`
+
+	// Name of the image to export. Defaults to the image built by the macstadium-orka builder.
+	ImageName string `mapstructure:"image_name"`
+
+	// Local path the image is written to. A path ending with a slash is a directory the image is written to as `<image_name>.img`.
+	Output string `mapstructure:"output"`
+
+	// S3 bucket the image is uploaded to, instead of a local path.
+	S3Bucket string `mapstructure:"s3_bucket"`
+
+	// Key of the uploaded image in `s3_bucket`. Defaults to `<image_name>.img`.
+	S3Key string `mapstructure:"s3_key"`
+
+	// Region of `s3_bucket`.
+	S3Region string `mapstructure:"s3_region"`
+
+	// Endpoint of an S3-compatible storage, such as MinIO.
+	S3Endpoint string `mapstructure:"s3_endpoint"`
+
+	// Access key and secret key for `s3_bucket`. Default to the AWS credential chain.
+	S3AccessKey string `mapstructure:"s3_access_key"`
+	S3SecretKey string `mapstructure:"s3_secret_key"`
+
+	// Use path-style S3 URLs, as required by most S3-compatible storages.
+	S3ForcePathStyle bool `mapstructure:"s3_force_path_style"`
+
+	// Minutes to wait for the export to finish.
+	ExportTimeout int `mapstructure:"export_timeout"`
+}
+
+func (c *Config) Prepare(raws ...interface{}) error {
+	err := config.Decode(c, &config.DecodeOpts{
+		PluginType:        "macstadium-orka-export",
+		Interpolate:       true,
+		InterpolateFilter: &interpolate.RenderFilter{},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packer.MultiError
+
+	if !strings.HasPrefix(c.OrkaEndpoint, "http://") && !strings.HasPrefix(c.OrkaEndpoint, "https://") {
+		errs = packer.MultiErrorAppend(errs, errors.New("A valid orka_endpoint must be specified"))
+	}
+
+	if c.OrkaAuthToken == "" {
+		errs = packer.MultiErrorAppend(errs, errors.New("A valid authentication token must be specified"))
+	}
+
+	if c.Output != "" && c.S3Bucket != "" {
+		errs = packer.MultiErrorAppend(errs, errors.New("only one of output or s3_bucket can be set"))
+	}
+
+	if c.S3Bucket == "" && (c.S3Key != "" || c.S3Region != "" || c.S3Endpoint != "" || c.S3AccessKey != "") {
+		errs = packer.MultiErrorAppend(errs, errors.New("s3_bucket must be set to use the other s3 options"))
+	}
+
+	if (c.S3AccessKey == "") != (c.S3SecretKey == "") {
+		errs = packer.MultiErrorAppend(errs, errors.New("s3_access_key and s3_secret_key must be set together"))
+	}
+
+	if c.ExportTimeout == 0 {
+		c.ExportTimeout = 120
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
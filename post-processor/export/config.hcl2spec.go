@@ -0,0 +1,69 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package export
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatConfig struct {
+	PackerBuildName     *string           `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType   *string           `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion   *string           `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug         *bool             `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce         *bool             `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError       *string           `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars      map[string]string `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars []string          `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	OrkaEndpoint        *string           `mapstructure:"orka_endpoint" required:"true" cty:"orka_endpoint" hcl:"orka_endpoint"`
+	OrkaAuthToken       *string           `mapstructure:"orka_auth_token" required:"true" cty:"orka_auth_token" hcl:"orka_auth_token"`
+	ImageName           *string           `mapstructure:"image_name" cty:"image_name" hcl:"image_name"`
+	Output              *string           `mapstructure:"output" cty:"output" hcl:"output"`
+	S3Bucket            *string           `mapstructure:"s3_bucket" cty:"s3_bucket" hcl:"s3_bucket"`
+	S3Key               *string           `mapstructure:"s3_key" cty:"s3_key" hcl:"s3_key"`
+	S3Region            *string           `mapstructure:"s3_region" cty:"s3_region" hcl:"s3_region"`
+	S3Endpoint          *string           `mapstructure:"s3_endpoint" cty:"s3_endpoint" hcl:"s3_endpoint"`
+	S3AccessKey         *string           `mapstructure:"s3_access_key" cty:"s3_access_key" hcl:"s3_access_key"`
+	S3SecretKey         *string           `mapstructure:"s3_secret_key" cty:"s3_secret_key" hcl:"s3_secret_key"`
+	S3ForcePathStyle    *bool             `mapstructure:"s3_force_path_style" cty:"s3_force_path_style" hcl:"s3_force_path_style"`
+	ExportTimeout       *int              `mapstructure:"export_timeout" cty:"export_timeout" hcl:"export_timeout"`
+}
+
+// FlatMapstructure returns a new FlatConfig.
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatConfig)
+}
+
+// HCL2Spec returns the hcl spec of a Config.
+// This spec is used by HCL to read the fields of Config.
+// The decoded values from this spec will then be applied to a FlatConfig.
+func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"packer_build_name":          &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":        &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":        &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":               &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":               &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":            &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":      &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables": &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"orka_endpoint":              &hcldec.AttrSpec{Name: "orka_endpoint", Type: cty.String, Required: false},
+		"orka_auth_token":            &hcldec.AttrSpec{Name: "orka_auth_token", Type: cty.String, Required: false},
+		"image_name":                 &hcldec.AttrSpec{Name: "image_name", Type: cty.String, Required: false},
+		"output":                     &hcldec.AttrSpec{Name: "output", Type: cty.String, Required: false},
+		"s3_bucket":                  &hcldec.AttrSpec{Name: "s3_bucket", Type: cty.String, Required: false},
+		"s3_key":                     &hcldec.AttrSpec{Name: "s3_key", Type: cty.String, Required: false},
+		"s3_region":                  &hcldec.AttrSpec{Name: "s3_region", Type: cty.String, Required: false},
+		"s3_endpoint":                &hcldec.AttrSpec{Name: "s3_endpoint", Type: cty.String, Required: false},
+		"s3_access_key":              &hcldec.AttrSpec{Name: "s3_access_key", Type: cty.String, Required: false},
+		"s3_secret_key":              &hcldec.AttrSpec{Name: "s3_secret_key", Type: cty.String, Required: false},
+		"s3_force_path_style":        &hcldec.AttrSpec{Name: "s3_force_path_style", Type: cty.Bool, Required: false},
+		"export_timeout":             &hcldec.AttrSpec{Name: "export_timeout", Type: cty.Number, Required: false},
+	}
+	return s
+}
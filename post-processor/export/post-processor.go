@@ -0,0 +1,219 @@
+package export
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/macstadium/packer-plugin-macstadium-orka/builder/orka"
+	"github.com/macstadium/packer-plugin-macstadium-orka/internal/orkaimage"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const BuilderId = "orka.post-processor.export"
+
+// PostProcessor downloads an Orka image to a local file or an S3-compatible bucket.
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	return p.config.Prepare(raws...)
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, source packer.Artifact) (packer.Artifact, bool, bool, error) {
+	name := p.config.ImageName
+	if name == "" {
+		if source.BuilderId() != orka.BuilderId {
+			return nil, true, false, fmt.Errorf("image_name must be set to export an artifact of builder [%s]", source.BuilderId())
+		}
+		name = source.Id()
+	}
+	if strings.ContainsAny(name, "/:@") {
+		return nil, true, false, fmt.Errorf("image [%s] was pushed to an OCI registry, only images saved to Orka can be exported", name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.config.ExportTimeout)*time.Minute)
+	defer cancel()
+
+	orkaClient, err := orka.GetOrkaClient(p.config.OrkaEndpoint, p.config.OrkaAuthToken, &orka.Config{})
+	if err != nil {
+		return nil, true, false, fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	image := &orkav1.Image{}
+	if err := orkaClient.Get(ctx, client.ObjectKey{Namespace: orka.DefaultOrkaNamespace, Name: name}, image); err != nil {
+		return nil, true, false, fmt.Errorf("failed to get image [%s]: %w", name, err)
+	}
+	if image.Status.State != orkav1.Ready {
+		return nil, true, false, fmt.Errorf("image [%s] is not ready to be exported, its state is [%s]", name, image.Status.State)
+	}
+
+	if image.Spec.Checksum == "" {
+		return nil, true, false, fmt.Errorf("Orka has no checksum for image [%s], so its export cannot be verified", name)
+	}
+
+	api := orkaimage.API{Endpoint: p.config.OrkaEndpoint, AuthToken: p.config.OrkaAuthToken}
+	body, size, err := api.Download(ctx, orka.DefaultOrkaNamespace, name)
+	if err != nil {
+		return nil, true, false, err
+	}
+	defer body.Close()
+	if size <= 0 {
+		size = image.Spec.Size.Value()
+	}
+
+	progress := ui.TrackProgress(name, 0, size, body)
+	defer progress.Close()
+
+	reader := newChecksumReader(progress, image.Spec.Checksum)
+
+	artifact := &Artifact{
+		imageName: name,
+	}
+
+	if p.config.S3Bucket != "" {
+		err = p.exportS3(ctx, ui, name, reader, artifact)
+	} else {
+		err = p.exportFile(ui, name, reader, artifact)
+	}
+	if err != nil {
+		return nil, true, false, err
+	}
+
+	artifact.checksums = reader.checksums()
+	return artifact, true, false, nil
+}
+
+// exportFile writes the image to a temporary file next to the output, which replaces the output once the checksum is verified.
+func (p *PostProcessor) exportFile(ui packer.Ui, name string, reader io.Reader, artifact *Artifact) error {
+	output := p.config.Output
+	switch {
+	case output == "":
+		output = name + ".img"
+	case strings.HasSuffix(output, "/"):
+		output = filepath.Join(output, name+".img")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	ui.Say(fmt.Sprintf("Exporting image [%s] to [%s]", name, output))
+
+	partial := output + ".part"
+	f, err := os.Create(partial)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	_, err = io.Copy(f, reader)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("failed to export image [%s]: %w", name, err)
+	}
+
+	if err := os.Rename(partial, output); err != nil {
+		return fmt.Errorf("failed to rename output file: %w", err)
+	}
+
+	ui.Say(fmt.Sprintf("image [%s] exported successfully to [%s], checksum verified", name, output))
+
+	artifact.id = output
+	artifact.files = []string{output}
+	return nil
+}
+
+// exportS3 uploads the image to the bucket. The reader fails at the end of an image that does not match
+// its checksum, which aborts the upload before the object is created.
+func (p *PostProcessor) exportS3(ctx context.Context, ui packer.Ui, name string, reader io.Reader, artifact *Artifact) error {
+	key := p.config.S3Key
+	if key == "" {
+		key = name + ".img"
+	}
+
+	awsConfig := aws.NewConfig().WithS3ForcePathStyle(p.config.S3ForcePathStyle)
+	if p.config.S3Region != "" {
+		awsConfig = awsConfig.WithRegion(p.config.S3Region)
+	}
+	if p.config.S3Endpoint != "" {
+		awsConfig = awsConfig.WithEndpoint(p.config.S3Endpoint)
+	}
+	if p.config.S3AccessKey != "" {
+		awsConfig = awsConfig.WithCredentials(credentials.NewStaticCredentials(p.config.S3AccessKey, p.config.S3SecretKey, ""))
+	}
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create S3 session: %w", err)
+	}
+
+	location := fmt.Sprintf("s3://%s/%s", p.config.S3Bucket, key)
+	ui.Say(fmt.Sprintf("Exporting image [%s] to [%s]", name, location))
+
+	_, err = s3manager.NewUploader(sess).UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket: aws.String(p.config.S3Bucket),
+		Key:    aws.String(key),
+		Body:   reader,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export image [%s]: %w", name, err)
+	}
+
+	ui.Say(fmt.Sprintf("image [%s] exported successfully to [%s], checksum verified", name, location))
+
+	artifact.id = location
+	return nil
+}
+
+// checksumReader hashes the image while it is read. At the end of the image it returns an error instead
+// of io.EOF if the MD5 does not match the checksum Orka calculated for the image, so the export fails
+// before it is complete.
+type checksumReader struct {
+	r          io.Reader
+	md5Hash    hash.Hash
+	sha256Hash hash.Hash
+	checksum   string
+}
+
+func newChecksumReader(r io.Reader, checksum string) *checksumReader {
+	return &checksumReader{r: r, md5Hash: md5.New(), sha256Hash: sha256.New(), checksum: checksum}
+}
+
+func (c *checksumReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.md5Hash.Write(p[:n])
+	c.sha256Hash.Write(p[:n])
+	if err == io.EOF {
+		if md5Sum := hex.EncodeToString(c.md5Hash.Sum(nil)); !strings.EqualFold(c.checksum, md5Sum) {
+			return n, fmt.Errorf("checksum mismatch, expected MD5 %s but got %s", c.checksum, md5Sum)
+		}
+	}
+	return n, err
+}
+
+// checksums returns the `md5` and `sha256` checksums of the image read so far.
+func (c *checksumReader) checksums() map[string]string {
+	return map[string]string{
+		"md5":    hex.EncodeToString(c.md5Hash.Sum(nil)),
+		"sha256": hex.EncodeToString(c.sha256Hash.Sum(nil)),
+	}
+}
@@ -0,0 +1,200 @@
+package export
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestChecksumReader(t *testing.T) {
+	data := []byte("image data")
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{"match", md5Hex(data), false},
+		{"upper case", strings.ToUpper(md5Hex(data)), false},
+		{"mismatch", md5Hex([]byte("other data")), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newChecksumReader(bytes.NewReader(data), tt.checksum)
+			got, err := io.ReadAll(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadAll() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("read %q, want %q", got, data)
+			}
+			if sum := r.checksums()["md5"]; sum != md5Hex(data) {
+				t.Errorf("md5 = %s, want %s", sum, md5Hex(data))
+			}
+		})
+	}
+}
+
+func TestExportFile(t *testing.T) {
+	data := []byte("image data")
+
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{"match", md5Hex(data), false},
+		{"mismatch", md5Hex([]byte("other data")), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "out") + "/"
+			p := &PostProcessor{config: Config{Output: output}}
+
+			err := p.exportFile(&packer.MockUi{}, "sonoma", newChecksumReader(bytes.NewReader(data), tt.checksum), &Artifact{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("exportFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			files, _ := filepath.Glob(filepath.Join(output, "*"))
+			want := []string{filepath.Join(output, "sonoma.img")}
+			if tt.wantErr {
+				// The partial file is deleted.
+				want = nil
+			}
+			if fmt.Sprint(files) != fmt.Sprint(want) {
+				t.Errorf("files = %v, want %v", files, want)
+			}
+			if !tt.wantErr {
+				if got, _ := os.ReadFile(want[0]); !bytes.Equal(got, data) {
+					t.Errorf("exported %q, want %q", got, data)
+				}
+			}
+		})
+	}
+}
+
+// s3Server is an S3 endpoint that accepts uploads and records the requests it receives.
+type s3Server struct {
+	mu       sync.Mutex
+	requests []string
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	io.Copy(io.Discard, r.Body)
+
+	s.mu.Lock()
+	request := r.Method + " " + r.URL.Path
+	for _, param := range []string{"uploads", "uploadId"} {
+		if _, ok := r.URL.Query()[param]; ok {
+			request += "?" + param
+		}
+	}
+	s.requests = append(s.requests, request)
+	s.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Query().Has("uploads"):
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>images</Bucket><Key>sonoma.img</Key><UploadId>upload</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPost:
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>images</Bucket><Key>sonoma.img</Key></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("ETag", `"etag"`)
+	}
+}
+
+func (s *s3Server) made(request string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.requests {
+		if r == request {
+			return true
+		}
+	}
+	return false
+}
+
+func TestExportS3(t *testing.T) {
+	small := []byte("image data")
+	// Larger than a part, so it is uploaded in parts.
+	large := bytes.Repeat([]byte("image data"), 600*1024)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		checksum string
+		wantErr  bool
+		want     []string
+		wantNot  []string
+	}{
+		{name: "match", data: small, checksum: md5Hex(small), want: []string{"PUT /images/sonoma.img"}},
+		{name: "mismatch", data: small, checksum: md5Hex(large), wantErr: true, wantNot: []string{"PUT /images/sonoma.img"}},
+		{
+			name:     "multipart match",
+			data:     large,
+			checksum: md5Hex(large),
+			want:     []string{"POST /images/sonoma.img?uploads", "POST /images/sonoma.img?uploadId"},
+		},
+		{
+			name:     "multipart mismatch",
+			data:     large,
+			checksum: md5Hex(small),
+			wantErr:  true,
+			want:     []string{"DELETE /images/sonoma.img?uploadId"},
+			wantNot:  []string{"POST /images/sonoma.img?uploadId"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3 := &s3Server{}
+			server := httptest.NewServer(s3)
+			defer server.Close()
+
+			p := &PostProcessor{config: Config{
+				S3Bucket:         "images",
+				S3Region:         "us-east-1",
+				S3Endpoint:       server.URL,
+				S3AccessKey:      "access",
+				S3SecretKey:      "secret",
+				S3ForcePathStyle: true,
+			}}
+			artifact := &Artifact{}
+			err := p.exportS3(context.Background(), &packer.MockUi{}, "sonoma", newChecksumReader(bytes.NewReader(tt.data), tt.checksum), artifact)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("exportS3() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && artifact.id != "s3://images/sonoma.img" {
+				t.Errorf("artifact id = %s, want s3://images/sonoma.img", artifact.id)
+			}
+			for _, request := range tt.want {
+				if !s3.made(request) {
+					t.Errorf("request %s was not made, requests %v", request, s3.requests)
+				}
+			}
+			for _, request := range tt.wantNot {
+				if s3.made(request) {
+					t.Errorf("request %s was made", request)
+				}
+			}
+		})
+	}
+}
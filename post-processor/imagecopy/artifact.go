@@ -0,0 +1,59 @@
+package imagecopy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Artifact represents an image copied to one or more Orka clusters.
+type Artifact struct {
+	// source is the name or OCI reference of the copied image.
+	source string
+
+	// images holds the name of the copied image in each target cluster, keyed by target name.
+	images map[string]string
+}
+
+// BuilderId returns the post-processor Id.
+func (*Artifact) BuilderId() string {
+	return BuilderId
+}
+
+// Destroy destroys the copied images.
+func (a *Artifact) Destroy() error {
+	return errors.New("Destroy not implemented")
+}
+
+// Files returns the files represented by the artifact.
+func (*Artifact) Files() []string {
+	return nil
+}
+
+// Id returns the name or OCI reference of the copied image.
+func (a *Artifact) Id() string {
+	return a.source
+}
+
+// State returns `targets`, the name of the copied image in each target cluster keyed by target name,
+// or the name of the copied image in the target cluster with the given name.
+func (a *Artifact) State(name string) interface{} {
+	if name == "targets" {
+		return a.images
+	}
+	if image, ok := a.images[name]; ok {
+		return image
+	}
+	return nil
+}
+
+// String returns the string representation of the artifact.
+func (a *Artifact) String() string {
+	targets := make([]string, 0, len(a.images))
+	for target, image := range a.images {
+		targets = append(targets, fmt.Sprintf("%s (%s)", target, image))
+	}
+	sort.Strings(targets)
+	return fmt.Sprintf("Orka image [%s] copied to %s", a.source, strings.Join(targets, ", "))
+}
@@ -0,0 +1,117 @@
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config,Target
+
+package imagecopy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	// The cluster the image is copied from. Only needed for images saved to Orka, images pushed to
+	// an OCI registry are pulled from the registry by the target clusters.
+	OrkaEndpoint  string `mapstructure:"orka_endpoint"`
+	OrkaAuthToken string `mapstructure:"orka_auth_token"`
+
+	// Name of the image to copy. Defaults to the image built by the macstadium-orka builder.
+	ImageName string `mapstructure:"image_name"`
+
+	// Clusters the image is copied to.
+	Targets []Target `mapstructure:"target" required:"true"`
+
+	// Size in MiB of the chunks images are uploaded to the target clusters in.
+	UploadChunkSize int `mapstructure:"upload_chunk_size"`
+
+	// Minutes to wait for the image to be copied to each target cluster.
+	CopyTimeout int `mapstructure:"copy_timeout"`
+}
+
+// Target is an Orka cluster an image is copied to.
+type Target struct {
+	// Name of the cluster in reports. Defaults to `orka_endpoint`.
+	Name string `mapstructure:"name"`
+
+	OrkaEndpoint  string `mapstructure:"orka_endpoint" required:"true"`
+	OrkaAuthToken string `mapstructure:"orka_auth_token" required:"true"`
+
+	// Name of the image in the cluster. Defaults to the name of the copied image saved to Orka.
+	ImageName           string `mapstructure:"image_name"`
+	ImageForceOverwrite bool   `mapstructure:"image_force_overwrite"`
+}
+
+func (c *Config) Prepare(raws ...interface{}) error {
+	err := config.Decode(c, &config.DecodeOpts{
+		PluginType:        "macstadium-orka-copy",
+		Interpolate:       true,
+		InterpolateFilter: &interpolate.RenderFilter{},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packer.MultiError
+
+	if c.OrkaEndpoint != "" && !strings.HasPrefix(c.OrkaEndpoint, "http://") && !strings.HasPrefix(c.OrkaEndpoint, "https://") {
+		errs = packer.MultiErrorAppend(errs, errors.New("A valid orka_endpoint must be specified"))
+	}
+
+	if (c.OrkaEndpoint == "") != (c.OrkaAuthToken == "") {
+		errs = packer.MultiErrorAppend(errs, errors.New("orka_endpoint and orka_auth_token must be set together"))
+	}
+
+	if len(c.Targets) == 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("at least one target must be specified"))
+	}
+
+	names := map[string]bool{}
+	for i := range c.Targets {
+		t := &c.Targets[i]
+
+		if !strings.HasPrefix(t.OrkaEndpoint, "http://") && !strings.HasPrefix(t.OrkaEndpoint, "https://") {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("target %d: a valid orka_endpoint must be specified", i))
+		}
+		if t.OrkaAuthToken == "" {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("target %d: a valid authentication token must be specified", i))
+		}
+
+		if t.Name == "" {
+			t.Name = t.OrkaEndpoint
+		}
+		if names[t.Name] {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("target %d: name [%s] is used by another target", i, t.Name))
+		}
+		names[t.Name] = true
+
+		if t.ImageName != "" {
+			if es := validation.IsDNS1123Subdomain(t.ImageName); len(es) > 0 {
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("target %s: image_name is not a valid Orka image name: %s", t.Name, strings.Join(es, "; ")))
+			}
+		}
+	}
+
+	if c.UploadChunkSize == 0 {
+		c.UploadChunkSize = 64
+	}
+	if c.UploadChunkSize < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("upload_chunk_size must be positive"))
+	}
+
+	if c.CopyTimeout == 0 {
+		c.CopyTimeout = 120
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+// Code generated by "packer-sdc mapstructure-to-hcl2"; DO NOT EDIT.
+
+package imagecopy
+
+import (
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatConfig struct {
+	PackerBuildName     *string           `mapstructure:"packer_build_name" cty:"packer_build_name" hcl:"packer_build_name"`
+	PackerBuilderType   *string           `mapstructure:"packer_builder_type" cty:"packer_builder_type" hcl:"packer_builder_type"`
+	PackerCoreVersion   *string           `mapstructure:"packer_core_version" cty:"packer_core_version" hcl:"packer_core_version"`
+	PackerDebug         *bool             `mapstructure:"packer_debug" cty:"packer_debug" hcl:"packer_debug"`
+	PackerForce         *bool             `mapstructure:"packer_force" cty:"packer_force" hcl:"packer_force"`
+	PackerOnError       *string           `mapstructure:"packer_on_error" cty:"packer_on_error" hcl:"packer_on_error"`
+	PackerUserVars      map[string]string `mapstructure:"packer_user_variables" cty:"packer_user_variables" hcl:"packer_user_variables"`
+	PackerSensitiveVars []string          `mapstructure:"packer_sensitive_variables" cty:"packer_sensitive_variables" hcl:"packer_sensitive_variables"`
+	OrkaEndpoint        *string           `mapstructure:"orka_endpoint" cty:"orka_endpoint" hcl:"orka_endpoint"`
+	OrkaAuthToken       *string           `mapstructure:"orka_auth_token" cty:"orka_auth_token" hcl:"orka_auth_token"`
+	ImageName           *string           `mapstructure:"image_name" cty:"image_name" hcl:"image_name"`
+	Targets             []FlatTarget      `mapstructure:"target" required:"true" cty:"target" hcl:"target"`
+	UploadChunkSize     *int              `mapstructure:"upload_chunk_size" cty:"upload_chunk_size" hcl:"upload_chunk_size"`
+	CopyTimeout         *int              `mapstructure:"copy_timeout" cty:"copy_timeout" hcl:"copy_timeout"`
+}
+
+// FlatMapstructure returns a new FlatConfig.
+// FlatConfig is an auto-generated flat version of Config.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Config) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatConfig)
+}
+
+// HCL2Spec returns the hcl spec of a Config.
+// This spec is used by HCL to read the fields of Config.
+// The decoded values from this spec will then be applied to a FlatConfig.
+func (*FlatConfig) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"packer_build_name":          &hcldec.AttrSpec{Name: "packer_build_name", Type: cty.String, Required: false},
+		"packer_builder_type":        &hcldec.AttrSpec{Name: "packer_builder_type", Type: cty.String, Required: false},
+		"packer_core_version":        &hcldec.AttrSpec{Name: "packer_core_version", Type: cty.String, Required: false},
+		"packer_debug":               &hcldec.AttrSpec{Name: "packer_debug", Type: cty.Bool, Required: false},
+		"packer_force":               &hcldec.AttrSpec{Name: "packer_force", Type: cty.Bool, Required: false},
+		"packer_on_error":            &hcldec.AttrSpec{Name: "packer_on_error", Type: cty.String, Required: false},
+		"packer_user_variables":      &hcldec.AttrSpec{Name: "packer_user_variables", Type: cty.Map(cty.String), Required: false},
+		"packer_sensitive_variables": &hcldec.AttrSpec{Name: "packer_sensitive_variables", Type: cty.List(cty.String), Required: false},
+		"orka_endpoint":              &hcldec.AttrSpec{Name: "orka_endpoint", Type: cty.String, Required: false},
+		"orka_auth_token":            &hcldec.AttrSpec{Name: "orka_auth_token", Type: cty.String, Required: false},
+		"image_name":                 &hcldec.AttrSpec{Name: "image_name", Type: cty.String, Required: false},
+		"target":                     &hcldec.BlockListSpec{TypeName: "target", Nested: hcldec.ObjectSpec((*FlatTarget)(nil).HCL2Spec())},
+		"upload_chunk_size":          &hcldec.AttrSpec{Name: "upload_chunk_size", Type: cty.Number, Required: false},
+		"copy_timeout":               &hcldec.AttrSpec{Name: "copy_timeout", Type: cty.Number, Required: false},
+	}
+	return s
+}
+
+// FlatTarget is an auto-generated flat version of Target.
+// Where the contents of a field with a `mapstructure:,squash` tag are bubbled up.
+type FlatTarget struct {
+	Name                *string `mapstructure:"name" cty:"name" hcl:"name"`
+	OrkaEndpoint        *string `mapstructure:"orka_endpoint" required:"true" cty:"orka_endpoint" hcl:"orka_endpoint"`
+	OrkaAuthToken       *string `mapstructure:"orka_auth_token" required:"true" cty:"orka_auth_token" hcl:"orka_auth_token"`
+	ImageName           *string `mapstructure:"image_name" cty:"image_name" hcl:"image_name"`
+	ImageForceOverwrite *bool   `mapstructure:"image_force_overwrite" cty:"image_force_overwrite" hcl:"image_force_overwrite"`
+}
+
+// FlatMapstructure returns a new FlatTarget.
+// FlatTarget is an auto-generated flat version of Target.
+// Where the contents a fields with a `mapstructure:,squash` tag are bubbled up.
+func (*Target) FlatMapstructure() interface{ HCL2Spec() map[string]hcldec.Spec } {
+	return new(FlatTarget)
+}
+
+// HCL2Spec returns the hcl spec of a Target.
+// This spec is used by HCL to read the fields of Target.
+// The decoded values from this spec will then be applied to a FlatTarget.
+func (*FlatTarget) HCL2Spec() map[string]hcldec.Spec {
+	s := map[string]hcldec.Spec{
+		"name":                  &hcldec.AttrSpec{Name: "name", Type: cty.String, Required: false},
+		"orka_endpoint":         &hcldec.AttrSpec{Name: "orka_endpoint", Type: cty.String, Required: false},
+		"orka_auth_token":       &hcldec.AttrSpec{Name: "orka_auth_token", Type: cty.String, Required: false},
+		"image_name":            &hcldec.AttrSpec{Name: "image_name", Type: cty.String, Required: false},
+		"image_force_overwrite": &hcldec.AttrSpec{Name: "image_force_overwrite", Type: cty.Bool, Required: false},
+	}
+	return s
+}
@@ -0,0 +1,202 @@
+package imagecopy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/macstadium/packer-plugin-macstadium-orka/builder/orka"
+	"github.com/macstadium/packer-plugin-macstadium-orka/internal/orkaimage"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const BuilderId = "orka.post-processor.copy"
+
+// PostProcessor copies an Orka image to other Orka clusters.
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	return p.config.Prepare(raws...)
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, source packer.Artifact) (packer.Artifact, bool, bool, error) {
+	name := p.config.ImageName
+	if name == "" {
+		if source.BuilderId() != orka.BuilderId {
+			return nil, true, false, fmt.Errorf("image_name must be set to copy an artifact of builder [%s]", source.BuilderId())
+		}
+		name = source.Id()
+	}
+
+	remote := strings.ContainsAny(name, "/:@")
+	if !remote && p.config.OrkaEndpoint == "" {
+		return nil, true, false, fmt.Errorf("orka_endpoint and orka_auth_token must be set to copy image [%s] saved to Orka", name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.config.CopyTimeout)*time.Minute)
+	defer cancel()
+
+	ui.Say(fmt.Sprintf("Copying image [%s] to %d clusters", name, len(p.config.Targets)))
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errs   *packer.MultiError
+		images = map[string]string{}
+	)
+	for i := range p.config.Targets {
+		target := &p.config.Targets[i]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ui := &targetUi{Ui: ui, prefix: fmt.Sprintf("[%s]", target.Name)}
+
+			image, err := p.copyImage(ctx, ui, target, name, remote)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				ui.Error(fmt.Sprintf("failed to copy image [%s]: %s", name, err))
+				errs = packer.MultiErrorAppend(errs, fmt.Errorf("target %s: %w", target.Name, err))
+				return
+			}
+			ui.Say(fmt.Sprintf("image [%s] copied successfully", image))
+			images[target.Name] = image
+		}()
+	}
+	wg.Wait()
+
+	ui.Say(fmt.Sprintf("image [%s] copied to %d of %d clusters", name, len(images), len(p.config.Targets)))
+
+	artifact := &Artifact{source: name, images: images}
+	if errs != nil && len(errs.Errors) > 0 {
+		return artifact, true, false, errs
+	}
+	return artifact, true, false, nil
+}
+
+// copyImage copies the image to the target cluster and returns its name there.
+func (p *PostProcessor) copyImage(ctx context.Context, ui packer.Ui, target *Target, name string, remote bool) (string, error) {
+	targetName := target.ImageName
+	if targetName == "" {
+		if remote {
+			return "", fmt.Errorf("image_name must be set to copy image [%s] pushed to an OCI registry", name)
+		}
+		targetName = name
+	}
+
+	orkaClient, err := orka.GetOrkaClient(target.OrkaEndpoint, target.OrkaAuthToken, &orka.Config{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	if remote {
+		err = p.pullImage(ctx, ui, orkaClient, target, name, targetName)
+	} else {
+		err = p.transferImage(ctx, ui, orkaClient, target, name, targetName)
+	}
+	if err != nil {
+		return "", err
+	}
+	return targetName, nil
+}
+
+// pullImage makes the target cluster pull the image from its OCI registry and waits for it to be ready.
+func (p *PostProcessor) pullImage(ctx context.Context, ui packer.Ui, orkaClient orka.OrkaClient, target *Target, reference, name string) error {
+	image := &orkav1.Image{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: orka.DefaultOrkaNamespace,
+			Name:      name,
+			Annotations: map[string]string{
+				orka.DescriptionAnnotationKey: fmt.Sprintf("Pulled from %s", reference),
+			},
+		},
+		Spec: orkav1.ImageSpec{
+			Source:     reference,
+			SourceType: orkav1.Remote,
+		},
+	}
+
+	existing := &orkav1.Image{}
+	err := orkaClient.Get(ctx, client.ObjectKeyFromObject(image), existing)
+	switch {
+	case err == nil:
+		if !target.ImageForceOverwrite {
+			return fmt.Errorf("image [%s] already exists, set image_force_overwrite to replace it", name)
+		}
+		if err := client.IgnoreNotFound(orkaClient.Delete(ctx, existing)); err != nil {
+			return fmt.Errorf("failed to delete existing image [%s]: %w", name, err)
+		}
+	case client.IgnoreNotFound(err) != nil:
+		return fmt.Errorf("failed to get image [%s]: %w", name, err)
+	}
+
+	ui.Say(fmt.Sprintf("Pulling image [%s] from registry [%s]", name, reference))
+
+	if err := orkaClient.Create(ctx, image); err != nil {
+		return fmt.Errorf("failed to create an image pull request: %w", err)
+	}
+
+	ui.Say(fmt.Sprintf("Waiting for image [%s] to be ready", name))
+	return orkaClient.WaitForImage(ctx, name, p.config.CopyTimeout)
+}
+
+// transferImage streams the image file from the source cluster to the target cluster and waits for it to be ready.
+// An image created on a target cluster without an upload endpoint is deleted again.
+func (p *PostProcessor) transferImage(ctx context.Context, ui packer.Ui, orkaClient orka.OrkaClient, target *Target, source, name string) error {
+	sourceAPI := orkaimage.API{Endpoint: p.config.OrkaEndpoint, AuthToken: p.config.OrkaAuthToken}
+	targetAPI := orkaimage.API{Endpoint: target.OrkaEndpoint, AuthToken: target.OrkaAuthToken}
+
+	body, size, err := sourceAPI.Download(ctx, orka.DefaultOrkaNamespace, source)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if size <= 0 {
+		return errors.New("the source cluster did not report the size of the image file")
+	}
+
+	offset, err := targetAPI.PrepareUpload(ctx, orkaClient, orka.DefaultOrkaNamespace, name, fmt.Sprintf("Copied from %s", source), size, target.ImageForceOverwrite)
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		ui.Say(fmt.Sprintf("Resuming copy of image [%s] at %d of %d bytes", name, offset, size))
+		if _, err := io.CopyN(io.Discard, body, offset); err != nil {
+			return fmt.Errorf("failed to download image [%s]: %w", source, err)
+		}
+	} else {
+		ui.Say(fmt.Sprintf("Transferring image [%s] to image [%s]", source, name))
+	}
+
+	progress := ui.TrackProgress(name, offset, size, body)
+	defer progress.Close()
+
+	if err := targetAPI.Upload(ctx, progress, orka.DefaultOrkaNamespace, name, offset, size, p.config.UploadChunkSize*1024*1024); err != nil {
+		if errors.Is(err, orka.ErrUnsupportedOrkaAPI) {
+			image := &orkav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: orka.DefaultOrkaNamespace, Name: name}}
+			if deleteErr := client.IgnoreNotFound(orkaClient.Delete(ctx, image)); deleteErr != nil {
+				ui.Error(fmt.Sprintf("failed to delete image [%s]: %s", name, deleteErr))
+			}
+		}
+		return fmt.Errorf("failed to upload image [%s]: %w", name, err)
+	}
+
+	ui.Say(fmt.Sprintf("Transfer finished, waiting for image [%s] to be ready", name))
+	return orkaClient.WaitForImage(ctx, name, p.config.CopyTimeout)
+}
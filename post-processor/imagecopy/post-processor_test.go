@@ -0,0 +1,185 @@
+package imagecopy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/macstadium/packer-plugin-macstadium-orka/builder/orka"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// imageClient stores the images of a target cluster and reports them ready when waited for.
+type imageClient struct {
+	orka.OrkaClient
+
+	images map[string]*orkav1.Image
+	waited []string
+}
+
+func (c *imageClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	image, ok := c.images[key.Name]
+	if !ok {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: "images"}, key.Name)
+	}
+	image.DeepCopyInto(obj.(*orkav1.Image))
+	return nil
+}
+
+func (c *imageClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.images[obj.GetName()] = obj.(*orkav1.Image).DeepCopy()
+	return nil
+}
+
+func (c *imageClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	delete(c.images, obj.GetName())
+	return nil
+}
+
+func (c *imageClient) WaitForImage(ctx context.Context, name string, timeout int) error {
+	c.waited = append(c.waited, name)
+	return nil
+}
+
+func TestTransferImage(t *testing.T) {
+	data := "image data"
+	unfinished := &orkav1.Image{
+		ObjectMeta: metav1.ObjectMeta{Namespace: orka.DefaultOrkaNamespace, Name: "sonoma-copy"},
+		Spec:       orkav1.ImageSpec{SourceType: orkav1.UserUpload},
+		Status:     orkav1.ImageStatus{State: orkav1.Updating},
+	}
+	unfinished.Spec.Size.Set(int64(len(data)))
+
+	tests := []struct {
+		name            string
+		existing        *orkav1.Image
+		received        int
+		noDownload      bool
+		noUpload        bool
+		wantSent        string
+		wantErr         string
+		wantImage       bool
+		wantUnsupported bool
+	}{
+		{name: "new image", wantSent: "image data", wantImage: true},
+		{name: "resume", existing: unfinished, received: 6, wantSent: "data", wantImage: true},
+		{name: "source without download endpoint", noDownload: true, wantErr: "image download is not available", wantUnsupported: true},
+		// The image created on the target for the copy is deleted again.
+		{name: "target without upload endpoint", noUpload: true, wantErr: "image upload is not available", wantUnsupported: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.noDownload || r.URL.Path != "/api/v1/namespaces/orka-default/images/sonoma/download" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+				io.WriteString(w, data)
+			}))
+			defer source.Close()
+
+			var sent []byte
+			target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.noUpload || r.URL.Path != "/api/v1/namespaces/orka-default/images/sonoma-copy/upload" {
+					http.NotFound(w, r)
+					return
+				}
+				switch r.Method {
+				case http.MethodHead:
+					w.Header().Set("Upload-Offset", strconv.Itoa(tt.received))
+				case http.MethodPut:
+					if want := fmt.Sprintf("bytes %d-", tt.received+len(sent)); !strings.HasPrefix(r.Header.Get("Content-Range"), want) {
+						http.Error(w, `{"message":"unexpected range"}`, http.StatusRequestedRangeNotSatisfiable)
+						return
+					}
+					body, _ := io.ReadAll(r.Body)
+					sent = append(sent, body...)
+				}
+			}))
+			defer target.Close()
+
+			c := &imageClient{images: map[string]*orkav1.Image{}}
+			if tt.existing != nil {
+				c.images[tt.existing.Name] = tt.existing.DeepCopy()
+			}
+			p := &PostProcessor{config: Config{OrkaEndpoint: source.URL, OrkaAuthToken: "source", UploadChunkSize: 1, CopyTimeout: 1}}
+
+			err := p.transferImage(context.Background(), &packer.MockUi{}, c, &Target{OrkaEndpoint: target.URL, OrkaAuthToken: "target"}, "sonoma", "sonoma-copy")
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+			if got := errors.Is(err, orka.ErrUnsupportedOrkaAPI); got != tt.wantUnsupported {
+				t.Errorf("unsupported = %v, want %v", got, tt.wantUnsupported)
+			}
+			if string(sent) != tt.wantSent {
+				t.Errorf("sent %q, want %q", sent, tt.wantSent)
+			}
+			if _, ok := c.images["sonoma-copy"]; ok != tt.wantImage {
+				t.Errorf("image exists = %v, want %v", ok, tt.wantImage)
+			}
+			if waited := len(c.waited) > 0; waited != tt.wantImage {
+				t.Errorf("waited for images %v, want waited %v", c.waited, tt.wantImage)
+			}
+		})
+	}
+}
+
+func TestPullImage(t *testing.T) {
+	const reference = "ghcr.io/org/sonoma:latest"
+	existing := &orkav1.Image{
+		ObjectMeta: metav1.ObjectMeta{Namespace: orka.DefaultOrkaNamespace, Name: "sonoma"},
+		Spec:       orkav1.ImageSpec{Source: "old", SourceType: orkav1.Local},
+	}
+
+	tests := []struct {
+		name       string
+		existing   bool
+		overwrite  bool
+		wantErr    string
+		wantSource string
+	}{
+		{name: "new image", wantSource: reference},
+		{name: "existing image", existing: true, wantErr: "already exists", wantSource: "old"},
+		{name: "overwrite", existing: true, overwrite: true, wantSource: reference},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &imageClient{images: map[string]*orkav1.Image{}}
+			if tt.existing {
+				c.images["sonoma"] = existing.DeepCopy()
+			}
+			p := &PostProcessor{config: Config{CopyTimeout: 1}}
+
+			err := p.pullImage(context.Background(), &packer.MockUi{}, c, &Target{ImageForceOverwrite: tt.overwrite}, reference, "sonoma")
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+
+			image := c.images["sonoma"]
+			if image.Spec.Source != tt.wantSource {
+				t.Errorf("image source = %s, want %s", image.Spec.Source, tt.wantSource)
+			}
+			if tt.wantSource == reference && (image.Spec.SourceType != orkav1.Remote || len(c.waited) != 1) {
+				t.Errorf("image = %+v, waited %v, want a pull that was waited for", image.Spec, c.waited)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package imagecopy
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+)
+
+// targetUi prefixes the messages of a target with its name, so the messages of targets copied in
+// parallel can be told apart.
+type targetUi struct {
+	packer.Ui
+	prefix string
+}
+
+func (u *targetUi) Say(message string) {
+	u.Ui.Say(fmt.Sprintf("%s %s", u.prefix, message))
+}
+
+func (u *targetUi) Message(message string) {
+	u.Ui.Message(fmt.Sprintf("%s %s", u.prefix, message))
+}
+
+func (u *targetUi) Error(message string) {
+	u.Ui.Error(fmt.Sprintf("%s %s", u.prefix, message))
+}
@@ -0,0 +1,85 @@
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+package tag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	OrkaEndpoint  string `mapstructure:"orka_endpoint" required:"true"`
+	OrkaAuthToken string `mapstructure:"orka_auth_token" required:"true"`
+
+	// Name of the image to copy. Defaults to the image built by the macstadium-orka builder.
+	ImageName string `mapstructure:"image_name"`
+
+	// Names the image is copied to, in order.
+	Names               []string `mapstructure:"names" required:"true"`
+	ImageForceOverwrite bool     `mapstructure:"image_force_overwrite"`
+
+	// Delete the image once it is copied to all names, renaming it.
+	RemoveSource bool `mapstructure:"remove_source"`
+
+	// Minutes to wait for each copy to be ready.
+	CopyTimeout int `mapstructure:"copy_timeout"`
+}
+
+func (c *Config) Prepare(raws ...interface{}) error {
+	err := config.Decode(c, &config.DecodeOpts{
+		PluginType:        "macstadium-orka-tag",
+		Interpolate:       true,
+		InterpolateFilter: &interpolate.RenderFilter{},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packer.MultiError
+
+	if !strings.HasPrefix(c.OrkaEndpoint, "http://") && !strings.HasPrefix(c.OrkaEndpoint, "https://") {
+		errs = packer.MultiErrorAppend(errs, errors.New("A valid orka_endpoint must be specified"))
+	}
+
+	if c.OrkaAuthToken == "" {
+		errs = packer.MultiErrorAppend(errs, errors.New("A valid authentication token must be specified"))
+	}
+
+	if len(c.Names) == 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("at least one name must be specified"))
+	}
+
+	seen := map[string]bool{}
+	for _, name := range c.Names {
+		if es := validation.IsDNS1123Subdomain(name); len(es) > 0 {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("name [%s] is not a valid Orka image name: %s", name, strings.Join(es, "; ")))
+		}
+		if seen[name] {
+			errs = packer.MultiErrorAppend(errs, fmt.Errorf("name [%s] is specified more than once", name))
+		}
+		seen[name] = true
+	}
+
+	if c.ImageName != "" && seen[c.ImageName] {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("image [%s] cannot be copied to itself", c.ImageName))
+	}
+
+	if c.CopyTimeout == 0 {
+		c.CopyTimeout = 120
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package tag
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfigPrepare(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     map[string]interface{}
+		wantErr string
+	}{
+		{name: "names", raw: map[string]interface{}{"names": []string{"latest", "stable"}}},
+		{name: "no names", raw: map[string]interface{}{}, wantErr: "at least one name"},
+		{name: "invalid name", raw: map[string]interface{}{"names": []string{"Latest"}}, wantErr: "not a valid Orka image name"},
+		{name: "repeated name", raw: map[string]interface{}{"names": []string{"latest", "latest"}}, wantErr: "more than once"},
+		{name: "copy to itself", raw: map[string]interface{}{"image_name": "latest", "names": []string{"latest"}}, wantErr: "cannot be copied to itself"},
+		{name: "invalid endpoint", raw: map[string]interface{}{"orka_endpoint": "10.221.188.20", "names": []string{"latest"}}, wantErr: "orka_endpoint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := map[string]interface{}{
+				"orka_endpoint":   "http://10.221.188.20",
+				"orka_auth_token": "token",
+			}
+			for k, v := range tt.raw {
+				raw[k] = v
+			}
+
+			var c Config
+			err := c.Prepare(raw)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				if c.CopyTimeout != 120 {
+					t.Errorf("copy_timeout = %d, want the default 120", c.CopyTimeout)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
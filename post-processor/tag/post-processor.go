@@ -0,0 +1,79 @@
+package tag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/macstadium/packer-plugin-macstadium-orka/builder/orka"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PostProcessor copies an Orka image to additional names in the same cluster.
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	return p.config.Prepare(raws...)
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, source packer.Artifact) (packer.Artifact, bool, bool, error) {
+	name := p.config.ImageName
+	if name == "" {
+		if source.BuilderId() != orka.BuilderId {
+			return nil, true, false, fmt.Errorf("image_name must be set to copy an artifact of builder [%s]", source.BuilderId())
+		}
+		name = source.Id()
+	}
+	if strings.ContainsAny(name, "/:@") {
+		return nil, true, false, fmt.Errorf("image [%s] was pushed to an OCI registry, only images saved to Orka can be copied", name)
+	}
+	for _, n := range p.config.Names {
+		if n == name {
+			return nil, true, false, fmt.Errorf("image [%s] cannot be copied to itself", name)
+		}
+	}
+
+	orkaClient, err := orka.GetOrkaClient(p.config.OrkaEndpoint, p.config.OrkaAuthToken, &orka.Config{})
+	if err != nil {
+		return nil, true, false, fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	for _, n := range p.config.Names {
+		ui.Say(fmt.Sprintf("Copying image [%s] to [%s]", name, n))
+
+		start := time.Now()
+		err := orka.CopyImage(ctx, orkaClient, name, n, fmt.Sprintf("Copied from %s", name), p.config.ImageForceOverwrite, p.config.CopyTimeout)
+		if err != nil {
+			return nil, true, false, err
+		}
+
+		ui.Say(fmt.Sprintf("image [%s] copied to [%s] in %s", name, n, time.Since(start).Round(time.Second)))
+	}
+
+	id := name
+	if p.config.RemoveSource {
+		ui.Say(fmt.Sprintf("Deleting image [%s]", name))
+
+		image := &orkav1.Image{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: orka.DefaultOrkaNamespace,
+				Name:      name,
+			},
+		}
+		if err := client.IgnoreNotFound(orkaClient.Delete(ctx, image)); err != nil {
+			return nil, true, false, fmt.Errorf("failed to delete image [%s]: %w", name, err)
+		}
+		id = p.config.Names[0]
+	}
+
+	return orka.NewArtifact(id, map[string]interface{}{"image_names": p.config.Names}), true, false, nil
+}
@@ -0,0 +1,80 @@
+//go:generate packer-sdc mapstructure-to-hcl2 -type Config
+
+package upload
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/packer-plugin-sdk/common"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/hashicorp/packer-plugin-sdk/template/config"
+	"github.com/hashicorp/packer-plugin-sdk/template/interpolate"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+type Config struct {
+	common.PackerConfig `mapstructure:",squash"`
+
+	OrkaEndpoint  string `mapstructure:"orka_endpoint" required:"true"`
+	OrkaAuthToken string `mapstructure:"orka_auth_token" required:"true"`
+
+	// Name of the Orka image to create.
+	ImageName           string `mapstructure:"image_name" required:"true"`
+	ImageDescription    string `mapstructure:"image_description"`
+	ImageForceOverwrite bool   `mapstructure:"image_force_overwrite"`
+
+	// Local image file to upload. Defaults to the only file of the artifact.
+	SourcePath string `mapstructure:"source_path"`
+
+	// Size in MiB of the chunks the image file is uploaded in.
+	UploadChunkSize int `mapstructure:"upload_chunk_size"`
+
+	// Minutes to wait for the upload to finish and the image to be ready.
+	UploadTimeout int `mapstructure:"upload_timeout"`
+}
+
+func (c *Config) Prepare(raws ...interface{}) error {
+	err := config.Decode(c, &config.DecodeOpts{
+		PluginType:        "macstadium-orka-upload",
+		Interpolate:       true,
+		InterpolateFilter: &interpolate.RenderFilter{},
+	}, raws...)
+	if err != nil {
+		return err
+	}
+
+	var errs *packer.MultiError
+
+	if !strings.HasPrefix(c.OrkaEndpoint, "http://") && !strings.HasPrefix(c.OrkaEndpoint, "https://") {
+		errs = packer.MultiErrorAppend(errs, errors.New("A valid orka_endpoint must be specified"))
+	}
+
+	if c.OrkaAuthToken == "" {
+		errs = packer.MultiErrorAppend(errs, errors.New("A valid authentication token must be specified"))
+	}
+
+	if c.ImageName == "" {
+		errs = packer.MultiErrorAppend(errs, errors.New("image_name must be specified"))
+	} else if es := validation.IsDNS1123Subdomain(c.ImageName); len(es) > 0 {
+		errs = packer.MultiErrorAppend(errs, fmt.Errorf("image_name is not a valid Orka image name: %s", strings.Join(es, "; ")))
+	}
+
+	if c.UploadChunkSize == 0 {
+		c.UploadChunkSize = 64
+	}
+	if c.UploadChunkSize < 0 {
+		errs = packer.MultiErrorAppend(errs, errors.New("upload_chunk_size must be positive"))
+	}
+
+	if c.UploadTimeout == 0 {
+		c.UploadTimeout = 120
+	}
+
+	if errs != nil && len(errs.Errors) > 0 {
+		return errs
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hcldec"
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/macstadium/packer-plugin-macstadium-orka/builder/orka"
+	"github.com/macstadium/packer-plugin-macstadium-orka/internal/orkaimage"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PostProcessor uploads a local image file to Orka as a new image.
+type PostProcessor struct {
+	config Config
+}
+
+func (p *PostProcessor) ConfigSpec() hcldec.ObjectSpec { return p.config.FlatMapstructure().HCL2Spec() }
+
+func (p *PostProcessor) Configure(raws ...interface{}) error {
+	return p.config.Prepare(raws...)
+}
+
+func (p *PostProcessor) PostProcess(ctx context.Context, ui packer.Ui, source packer.Artifact) (packer.Artifact, bool, bool, error) {
+	path := p.config.SourcePath
+	if path == "" {
+		files := source.Files()
+		if len(files) != 1 {
+			return nil, true, false, fmt.Errorf("source_path must be set, artifact [%s] has %d files", source.Id(), len(files))
+		}
+		path = files[0]
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, true, false, fmt.Errorf("failed to open image file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, true, false, fmt.Errorf("failed to read image file: %w", err)
+	}
+	size := info.Size()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(p.config.UploadTimeout)*time.Minute)
+	defer cancel()
+
+	orkaClient, err := orka.GetOrkaClient(p.config.OrkaEndpoint, p.config.OrkaAuthToken, &orka.Config{})
+	if err != nil {
+		return nil, true, false, fmt.Errorf("failed to create k8s client: %w", err)
+	}
+
+	api := orkaimage.API{Endpoint: p.config.OrkaEndpoint, AuthToken: p.config.OrkaAuthToken}
+	if err := p.upload(ctx, ui, orkaClient, api, f, path, size); err != nil {
+		return nil, true, false, err
+	}
+
+	return orka.NewArtifact(p.config.ImageName, map[string]interface{}{"source_path": path}), true, false, nil
+}
+
+// upload sends the image file to the image and waits for the image to be ready. An image created for an
+// upload the Orka API has no endpoint for is deleted again.
+func (p *PostProcessor) upload(ctx context.Context, ui packer.Ui, orkaClient orka.OrkaClient, api orkaimage.API, f io.ReadSeeker, path string, size int64) error {
+	name := p.config.ImageName
+	offset, err := api.PrepareUpload(ctx, orkaClient, orka.DefaultOrkaNamespace, name, p.config.ImageDescription, size, p.config.ImageForceOverwrite)
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		ui.Say(fmt.Sprintf("Resuming upload of [%s] to image [%s] at %d of %d bytes", path, name, offset, size))
+	} else {
+		ui.Say(fmt.Sprintf("Uploading [%s] to image [%s]", path, name))
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read image file: %w", err)
+	}
+	progress := ui.TrackProgress(name, offset, size, io.NopCloser(f))
+	defer progress.Close()
+
+	if err := api.Upload(ctx, progress, orka.DefaultOrkaNamespace, name, offset, size, p.config.UploadChunkSize*1024*1024); err != nil {
+		if errors.Is(err, orka.ErrUnsupportedOrkaAPI) {
+			image := &orkav1.Image{ObjectMeta: metav1.ObjectMeta{Namespace: orka.DefaultOrkaNamespace, Name: name}}
+			if deleteErr := client.IgnoreNotFound(orkaClient.Delete(ctx, image)); deleteErr != nil {
+				ui.Error(fmt.Sprintf("failed to delete image [%s]: %s", name, deleteErr))
+			}
+		}
+		return fmt.Errorf("failed to upload image [%s]: %w", name, err)
+	}
+
+	ui.Say(fmt.Sprintf("Upload finished, waiting for image [%s] to be ready", name))
+
+	if err := orkaClient.WaitForImage(ctx, name, p.config.UploadTimeout); err != nil {
+		return fmt.Errorf("failed to import image [%s]: %w", name, err)
+	}
+
+	ui.Say(fmt.Sprintf("image [%s] imported successfully", name))
+	return nil
+}
@@ -0,0 +1,127 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/packer-plugin-sdk/packer"
+	"github.com/macstadium/packer-plugin-macstadium-orka/builder/orka"
+	"github.com/macstadium/packer-plugin-macstadium-orka/internal/orkaimage"
+	orkav1 "github.com/macstadium/packer-plugin-macstadium-orka/orkaapi/api/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// imageClient stores the images it is given and reports them ready when waited for.
+type imageClient struct {
+	orka.OrkaClient
+
+	images map[string]*orkav1.Image
+	waited []string
+}
+
+func (c *imageClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	image, ok := c.images[key.Name]
+	if !ok {
+		return apierrors.NewNotFound(schema.GroupResource{Resource: "images"}, key.Name)
+	}
+	image.DeepCopyInto(obj.(*orkav1.Image))
+	return nil
+}
+
+func (c *imageClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.images[obj.GetName()] = obj.(*orkav1.Image).DeepCopy()
+	return nil
+}
+
+func (c *imageClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	delete(c.images, obj.GetName())
+	return nil
+}
+
+func (c *imageClient) WaitForImage(ctx context.Context, name string, timeout int) error {
+	c.waited = append(c.waited, name)
+	return nil
+}
+
+func TestUpload(t *testing.T) {
+	data := []byte("image data")
+	unfinished := &orkav1.Image{
+		ObjectMeta: metav1.ObjectMeta{Namespace: orka.DefaultOrkaNamespace, Name: "sonoma"},
+		Spec:       orkav1.ImageSpec{SourceType: orkav1.UserUpload},
+		Status:     orkav1.ImageStatus{State: orkav1.Updating},
+	}
+	unfinished.Spec.Size.Set(int64(len(data)))
+
+	tests := []struct {
+		name        string
+		existing    *orkav1.Image
+		received    int
+		unsupported bool
+		wantSent    string
+		wantErr     bool
+		wantImage   bool
+	}{
+		{name: "new image", wantSent: "image data", wantImage: true},
+		{name: "resume", existing: unfinished, received: 6, wantSent: "data", wantImage: true},
+		// The image created for the upload is deleted again.
+		{name: "no upload endpoint", unsupported: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.unsupported {
+					http.NotFound(w, r)
+					return
+				}
+				switch r.Method {
+				case http.MethodHead:
+					w.Header().Set("Upload-Offset", strconv.Itoa(tt.received))
+				case http.MethodPut:
+					if want := fmt.Sprintf("bytes %d-", tt.received+len(sent)); !strings.HasPrefix(r.Header.Get("Content-Range"), want) {
+						http.Error(w, `{"message":"unexpected range"}`, http.StatusRequestedRangeNotSatisfiable)
+						return
+					}
+					body, _ := io.ReadAll(r.Body)
+					sent = append(sent, body...)
+				}
+			}))
+			defer server.Close()
+
+			c := &imageClient{images: map[string]*orkav1.Image{}}
+			if tt.existing != nil {
+				c.images["sonoma"] = tt.existing.DeepCopy()
+			}
+			p := &PostProcessor{config: Config{ImageName: "sonoma", UploadChunkSize: 1, UploadTimeout: 1}}
+			api := orkaimage.API{Endpoint: server.URL, AuthToken: "token"}
+
+			err := p.upload(context.Background(), &packer.MockUi{}, c, api, bytes.NewReader(data), "sonoma.img", int64(len(data)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("upload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.unsupported && !errors.Is(err, orka.ErrUnsupportedOrkaAPI) {
+				t.Errorf("error = %v, want %v", err, orka.ErrUnsupportedOrkaAPI)
+			}
+			if string(sent) != tt.wantSent {
+				t.Errorf("sent %q, want %q", sent, tt.wantSent)
+			}
+			if _, ok := c.images["sonoma"]; ok != tt.wantImage {
+				t.Errorf("image exists = %v, want %v", ok, tt.wantImage)
+			}
+			if waited := len(c.waited) > 0; waited != tt.wantImage {
+				t.Errorf("waited for images %v, want waited %v", c.waited, tt.wantImage)
+			}
+		})
+	}
+}